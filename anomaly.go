@@ -0,0 +1,204 @@
+package warc
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CaptureSample describes a record written by the rotator,
+// as observed by an AnomalyDetector
+type CaptureSample struct {
+	Time time.Time
+	// Host of the WARC-Target-URI of the record, if any
+	Host string
+	// Type is the WARC-Type of the record
+	Type string
+	// Status is the HTTP status code of a response record, 0 otherwise
+	Status int
+	// Size is the size of the block of the record
+	Size int64
+}
+
+// Anomaly is an anomalous capture pattern found by an AnomalyDetector
+type Anomaly struct {
+	// Kind of the anomaly, e.g. AnomalyServerErrors
+	Kind string
+	// Value is the value of the metric that triggered the anomaly,
+	// Baseline its usual value
+	Value    float64
+	Baseline float64
+	// Description is a human readable description of the anomaly
+	Description string
+}
+
+// Kinds of the anomalies found by WindowDetector
+const (
+	// AnomalyServerErrors is a spike of the ratio of 5xx responses,
+	// e.g. an origin serving error pages
+	AnomalyServerErrors = "server-errors"
+	// AnomalyDedupCollapse is a drop of the ratio of revisit records,
+	// e.g. pages embedding a random token
+	AnomalyDedupCollapse = "dedup-collapse"
+	// AnomalyRecordSize is a change of the average size of the records,
+	// e.g. truncated responses or a crawler trap
+	AnomalyRecordSize = "record-size"
+)
+
+// AnomalyDetector watches the records written by the rotator to catch
+// broken crawls early, see RotatorSettings.AnomalyDetector
+type AnomalyDetector interface {
+	// Observe is called from the rotator's goroutine with each record
+	// written, it returns the anomalies found, if any
+	Observe(sample CaptureSample) []Anomaly
+}
+
+// WindowDetector is an AnomalyDetector comparing the response and revisit
+// records of each window of Window records with the average of the previous
+// windows. The zero thresholds disable the corresponding checks.
+type WindowDetector struct {
+	// Window is the number of records of a window, 1000 if zero
+	Window int
+	// ServerErrorIncrease is the increase of the ratio of 5xx responses
+	// over the baseline that makes an anomaly, e.g. 0.2 for 20 points
+	ServerErrorIncrease float64
+	// DedupDrop is the decrease of the ratio of revisit records under
+	// the baseline that makes an anomaly, e.g. 0.3 for 30 points
+	DedupDrop float64
+	// SizeFactor is the factor by which the average size of the records
+	// must differ from the baseline to make an anomaly, e.g. 2 when the
+	// average size doubles or halves
+	SizeFactor float64
+
+	current  windowCounts
+	windows  int
+	baseline windowRatios
+}
+
+// windowCounts are the counts of a window of records
+type windowCounts struct {
+	records      int
+	serverErrors int
+	revisits     int
+	bytes        int64
+}
+
+// windowRatios are the metrics of a window of records
+type windowRatios struct {
+	serverErrors float64
+	revisits     float64
+	size         float64
+}
+
+func (c windowCounts) ratios() windowRatios {
+	return windowRatios{
+		serverErrors: float64(c.serverErrors) / float64(c.records),
+		revisits:     float64(c.revisits) / float64(c.records),
+		size:         float64(c.bytes) / float64(c.records),
+	}
+}
+
+// Observe implements AnomalyDetector
+func (d *WindowDetector) Observe(sample CaptureSample) []Anomaly {
+	if sample.Type != "response" && sample.Type != "revisit" {
+		return nil
+	}
+
+	d.current.records++
+	d.current.bytes += sample.Size
+	if sample.Status >= 500 {
+		d.current.serverErrors++
+	}
+	if sample.Type == "revisit" {
+		d.current.revisits++
+	}
+
+	window := d.Window
+	if window <= 0 {
+		window = 1000
+	}
+	if d.current.records < window {
+		return nil
+	}
+
+	ratios := d.current.ratios()
+	d.current = windowCounts{}
+
+	// The first window is the baseline of the next ones
+	var anomalies []Anomaly
+	if d.windows > 0 {
+		anomalies = d.compare(ratios)
+	}
+
+	// The baseline is the average of all the windows
+	d.windows++
+	d.baseline.serverErrors += (ratios.serverErrors - d.baseline.serverErrors) / float64(d.windows)
+	d.baseline.revisits += (ratios.revisits - d.baseline.revisits) / float64(d.windows)
+	d.baseline.size += (ratios.size - d.baseline.size) / float64(d.windows)
+
+	return anomalies
+}
+
+// compare returns the anomalies of a window compared to the baseline
+func (d *WindowDetector) compare(ratios windowRatios) []Anomaly {
+	var anomalies []Anomaly
+
+	if d.ServerErrorIncrease > 0 && ratios.serverErrors-d.baseline.serverErrors >= d.ServerErrorIncrease {
+		anomalies = append(anomalies, Anomaly{
+			Kind:        AnomalyServerErrors,
+			Value:       ratios.serverErrors,
+			Baseline:    d.baseline.serverErrors,
+			Description: "5xx responses rose to " + formatPercent(ratios.serverErrors) + " from " + formatPercent(d.baseline.serverErrors),
+		})
+	}
+
+	if d.DedupDrop > 0 && d.baseline.revisits-ratios.revisits >= d.DedupDrop {
+		anomalies = append(anomalies, Anomaly{
+			Kind:        AnomalyDedupCollapse,
+			Value:       ratios.revisits,
+			Baseline:    d.baseline.revisits,
+			Description: "revisit records fell to " + formatPercent(ratios.revisits) + " from " + formatPercent(d.baseline.revisits),
+		})
+	}
+
+	if d.SizeFactor > 1 && d.baseline.size > 0 && ratios.size > 0 {
+		if factor := ratios.size / d.baseline.size; factor >= d.SizeFactor || factor <= 1/d.SizeFactor {
+			anomalies = append(anomalies, Anomaly{
+				Kind:        AnomalyRecordSize,
+				Value:       ratios.size,
+				Baseline:    d.baseline.size,
+				Description: "average record size changed to " + strconv.FormatFloat(ratios.size, 'f', 0, 64) + " bytes from " + strconv.FormatFloat(d.baseline.size, 'f', 0, 64),
+			})
+		}
+	}
+
+	return anomalies
+}
+
+func formatPercent(ratio float64) string {
+	return strconv.FormatFloat(math.Round(ratio*1000)/10, 'f', -1, 64) + "%"
+}
+
+// observe passes a record written to the AnomalyDetector, emitting an
+// Anomaly event and calling the AnomalyHook for each anomaly found
+func (r *rotatorState) observe(record *Record, status int) {
+	sample := CaptureSample{
+		Time:   time.Now(),
+		Type:   record.Header.Get("WARC-Type"),
+		Status: status,
+	}
+	sample.Size, _ = strconv.ParseInt(record.Header.Get("Content-Length"), 10, 64)
+	if target, err := url.Parse(strings.Trim(record.Header.Get("WARC-Target-URI"), "<>")); err == nil {
+		sample.Host = strings.ToLower(target.Hostname())
+	}
+
+	for _, anomaly := range r.settings.AnomalyDetector.Observe(sample) {
+		anomaly := anomaly
+		r.emit(RotatorEvent{Type: AnomalyDetected, Anomaly: &anomaly})
+		if r.settings.AnomalyHook != nil {
+			r.settings.AnomalyHook(anomaly)
+		}
+	}
+}
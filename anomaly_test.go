@@ -0,0 +1,115 @@
+package warc
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the WindowDetector type
+func TestWindowDetector(t *testing.T) {
+	detector := &WindowDetector{
+		Window:              10,
+		ServerErrorIncrease: 0.2,
+		DedupDrop:           0.3,
+		SizeFactor:          2,
+	}
+
+	observe := func(samples []CaptureSample) []Anomaly {
+		var anomalies []Anomaly
+		for _, sample := range samples {
+			anomalies = append(anomalies, detector.Observe(sample)...)
+		}
+		return anomalies
+	}
+
+	window := func(serverErrors int, revisits int, size int64) []CaptureSample {
+		var samples []CaptureSample
+		for i := 0; i < 10; i++ {
+			sample := CaptureSample{Type: "response", Status: 200, Size: size}
+			if i < serverErrors {
+				sample.Status = 503
+			} else if i < serverErrors+revisits {
+				sample.Type = "revisit"
+			}
+			samples = append(samples, sample)
+		}
+		// Other records are ignored
+		return append(samples, CaptureSample{Type: "request", Size: 1000000})
+	}
+
+	// A healthy baseline
+	for i := 0; i < 3; i++ {
+		if anomalies := observe(window(0, 5, 1000)); len(anomalies) != 0 {
+			t.Fatalf("unexpected anomalies %+v", anomalies)
+		}
+	}
+
+	// An origin serving small error pages
+	anomalies := observe(window(5, 0, 400))
+	kinds := make(map[string]bool)
+	for _, anomaly := range anomalies {
+		kinds[anomaly.Kind] = true
+	}
+
+	if len(anomalies) != 3 || !kinds[AnomalyServerErrors] || !kinds[AnomalyDedupCollapse] || !kinds[AnomalyRecordSize] {
+		t.Fatalf("expected the three kinds of anomalies, got %+v", anomalies)
+	}
+
+	for _, anomaly := range anomalies {
+		if anomaly.Kind == AnomalyServerErrors && (anomaly.Value != 0.5 || anomaly.Baseline != 0 || anomaly.Description == "") {
+			t.Errorf("unexpected anomaly %+v", anomaly)
+		}
+	}
+}
+
+// Tests that the rotator reports the anomalies found
+func TestRotatorAnomalyHook(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	var anomalies []Anomaly
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.AnomalyDetector = &WindowDetector{Window: 2, ServerErrorIncrease: 0.5}
+	rotatorSettings.AnomalyHook = func(anomaly Anomaly) {
+		anomalies = append(anomalies, anomaly)
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	batch := NewRecordBatch()
+	for _, status := range []string{"200 OK", "200 OK", "500 Internal Server Error", "502 Bad Gateway"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader("HTTP/1.1 " + status + "\r\n\r\n")
+		batch.Records = append(batch.Records, record)
+	}
+	records <- batch
+
+	close(records)
+	<-done
+
+	if len(anomalies) != 1 || anomalies[0].Kind != AnomalyServerErrors {
+		t.Fatalf("expected a server errors anomaly, got %+v", anomalies)
+	}
+
+	for event := range rotatorSettings.Events() {
+		if event.Type == AnomalyDetected {
+			if event.Anomaly == nil || event.Anomaly.Kind != AnomalyServerErrors {
+				t.Errorf("unexpected anomaly event %+v", event)
+			}
+			return
+		}
+	}
+	t.Fatal("expected an AnomalyDetected event")
+}
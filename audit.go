@@ -0,0 +1,240 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuditManifest is the fixity report of an audit, it is also the
+// checkpoint allowing an interrupted audit to be resumed
+type AuditManifest struct {
+	// Started is when the current audit started
+	Started time.Time
+	// Completed is true once all the files of the audit were audited
+	Completed bool
+	// Files are the results of the audit, by file path
+	Files map[string]*AuditFile
+}
+
+// AuditFile is the result of the audit of a WARC file
+type AuditFile struct {
+	// SHA1 of the whole file, as computed by the first audit of the file,
+	// it is then the digest the next audits compare against
+	SHA1 string
+	// Audited is when the file was last audited
+	Audited time.Time
+	// Changed is true if the SHA1 of the file changed since the first audit
+	Changed bool
+	// Records is the number of records of the file
+	Records int
+	// Verified is the number of records whose WARC-Block-Digest matched
+	Verified int
+	// Unverified is the number of records without a WARC-Block-Digest
+	// or with a digest algorithm that isn't supported
+	Unverified int
+	// Mismatches are the WARC-Record-ID of the records
+	// whose WARC-Block-Digest didn't match
+	Mismatches []string
+	// Error is set if the file couldn't be read entirely
+	Error string
+}
+
+// OK returns true if no fixity issue was found in the file
+func (f *AuditFile) OK() bool {
+	return !f.Changed && len(f.Mismatches) == 0 && f.Error == ""
+}
+
+// Audit re-computes the digests of the WARC files at paths, and compares
+// them with the digests stored in their records' WARC-Block-Digest and
+// with the file digests recorded in the manifest by the previous audits.
+// The manifest is a JSON file created if it doesn't exist, it is updated
+// after each file so that an interrupted audit resumes where it stopped
+// when Audit is called again with the same manifest.
+func Audit(paths []string, manifest string) (*AuditManifest, error) {
+	return audit(openOSFile, paths, manifest)
+}
+
+func audit(open openFileFunc, paths []string, manifest string) (*AuditManifest, error) {
+	report, err := loadAuditManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a new audit unless the previous one was interrupted
+	if report.Completed || report.Started.IsZero() {
+		report.Started = time.Now().UTC()
+		report.Completed = false
+	}
+
+	for _, path := range paths {
+		previous := report.Files[path]
+		if previous != nil && !previous.Audited.Before(report.Started) {
+			continue
+		}
+
+		result := auditFile(open, path)
+		if previous != nil && previous.SHA1 != "" {
+			result.Changed = result.SHA1 != previous.SHA1
+			result.SHA1 = previous.SHA1
+		}
+		report.Files[path] = result
+
+		if err := saveAuditManifest(manifest, report); err != nil {
+			return report, err
+		}
+	}
+
+	report.Completed = true
+
+	return report, saveAuditManifest(manifest, report)
+}
+
+// auditFile verifies the digests of all the records of a WARC file
+func auditFile(open openFileFunc, path string) *AuditFile {
+	result := &AuditFile{Audited: time.Now().UTC()}
+
+	file, err := open(path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer file.Close()
+
+	// Compute the digest of the file while reading it
+	fileHash := sha1.New()
+	reader, err := NewReader(io.TeeReader(file, fileHash))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.ReadRecord(true)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		result.Records++
+
+		match, err := verifyBlockDigest(record)
+		os.Remove(record.PayloadPath)
+		if err != nil {
+			result.Unverified++
+		} else if match {
+			result.Verified++
+		} else {
+			result.Mismatches = append(result.Mismatches, record.Header.Get("WARC-Record-ID"))
+		}
+	}
+
+	// Hash what remains after the last record, e.g. padding
+	if _, err := io.Copy(fileHash, file); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.SHA1 = base32.StdEncoding.EncodeToString(fileHash.Sum(nil))
+
+	return result
+}
+
+// verifyBlockDigest returns true if the WARC-Block-Digest of a record
+// read on disk matches its content
+func verifyBlockDigest(record *Record) (bool, error) {
+	algorithm, expected, err := parseDigest(record.Header.Get("WARC-Block-Digest"))
+	if err != nil {
+		return false, err
+	}
+
+	file, err := os.Open(record.PayloadPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	digest, err := computeDigest(algorithm, file)
+	if err != nil {
+		return false, err
+	}
+
+	_, actual, err := parseDigest(digest)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(actual, expected), nil
+}
+
+// parseDigest parses a labelled digest, e.g. "sha1:<base32 digest>",
+// hexadecimal digests are accepted too as some tools write them
+func parseDigest(value string) (algorithm string, sum []byte, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, errors.New("Malformed digest: " + value)
+	}
+
+	algorithm = strings.ToLower(parts[0])
+
+	sum, err = base32.StdEncoding.DecodeString(strings.ToUpper(parts[1]))
+	if err != nil {
+		sum, err = hex.DecodeString(parts[1])
+		if err != nil {
+			return "", nil, errors.New("Malformed digest: " + value)
+		}
+	}
+
+	return algorithm, sum, nil
+}
+
+// loadAuditManifest reads an audit manifest, returning an
+// empty one if the file doesn't exist
+func loadAuditManifest(path string) (*AuditManifest, error) {
+	report := &AuditManifest{Files: make(map[string]*AuditFile)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, errors.New("Invalid audit manifest " + path + ": " + err.Error())
+	}
+
+	if report.Files == nil {
+		report.Files = make(map[string]*AuditFile)
+	}
+
+	return report, nil
+}
+
+// saveAuditManifest writes an audit manifest, replacing
+// the previous one atomically
+func saveAuditManifest(path string, report *AuditManifest) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
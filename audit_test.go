@@ -0,0 +1,56 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests for the Audit function
+func TestAudit(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-audit-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "test.warc")
+	manifest := filepath.Join(directory, "manifest.json")
+
+	data := writeTestRecords(t, CompressionNone).Bytes()
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write WARC file: %v", err)
+	}
+
+	report, err := Audit([]string{path}, manifest)
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+
+	result := report.Files[path]
+	if !report.Completed || result == nil || !result.OK() {
+		t.Fatalf("expected a successful audit, got %+v", result)
+	}
+
+	if result.Records != len(testRecords) || result.Verified != len(testRecords) {
+		t.Errorf("expected %d verified records, got %d out of %d", len(testRecords), result.Verified, result.Records)
+	}
+
+	// Alter the content of the first record without changing its size
+	data = bytes.Replace(data, []byte("Hello, World!"), []byte("Hello, Moon!!"), 1)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write WARC file: %v", err)
+	}
+
+	report, err = Audit([]string{path}, manifest)
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+
+	result = report.Files[path]
+	if result.OK() || !result.Changed || len(result.Mismatches) != 1 {
+		t.Errorf("expected a changed file with 1 mismatch, got %+v", result)
+	}
+}
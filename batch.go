@@ -0,0 +1,93 @@
+package warc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+)
+
+// serializedRecord is the on-the-wire representation of a Record
+type serializedRecord struct {
+	Header      Header
+	Content     []byte
+	HasContent  bool
+	PayloadPath string
+}
+
+// serializedRecordBatch is the on-the-wire representation of a RecordBatch
+type serializedRecordBatch struct {
+	Records     []serializedRecord
+	CaptureTime string
+	CrawlID     string
+}
+
+// MarshalBinary serializes the record batch with encoding/gob, so that it
+// can be pushed through a queue system between capture and writer nodes.
+// In-memory content is embedded in the output, while records spooled on
+// disk are serialized as a reference to their PayloadPath, which must then
+// be reachable by the node decoding the batch. The Done channel isn't
+// serialized.
+func (b *RecordBatch) MarshalBinary() ([]byte, error) {
+	batch := serializedRecordBatch{
+		Records:     make([]serializedRecord, 0, len(b.Records)),
+		CaptureTime: b.CaptureTime,
+		CrawlID:     b.CrawlID,
+	}
+
+	for _, record := range b.Records {
+		serialized := serializedRecord{
+			Header:      record.Header,
+			PayloadPath: record.PayloadPath,
+		}
+
+		if record.PayloadPath == "" && record.Content != nil {
+			data, err := ioutil.ReadAll(record.Content)
+			if err != nil {
+				return nil, err
+			}
+			record.Content = bytes.NewReader(data)
+
+			serialized.Content = data
+			serialized.HasContent = true
+		}
+
+		batch.Records = append(batch.Records, serialized)
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := gob.NewEncoder(buffer).Encode(batch); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a record batch serialized with MarshalBinary.
+func (b *RecordBatch) UnmarshalBinary(data []byte) error {
+	var batch serializedRecordBatch
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&batch); err != nil {
+		return err
+	}
+
+	b.Records = make([]*Record, 0, len(batch.Records))
+	b.CaptureTime = batch.CaptureTime
+	b.CrawlID = batch.CrawlID
+
+	for _, serialized := range batch.Records {
+		record := &Record{
+			Header:      serialized.Header,
+			PayloadPath: serialized.PayloadPath,
+		}
+		if record.Header == nil {
+			record.Header = NewHeader()
+		}
+		if serialized.HasContent {
+			record.Content = bytes.NewReader(serialized.Content)
+		}
+
+		b.Records = append(b.Records, record)
+	}
+
+	return nil
+}
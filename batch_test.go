@@ -0,0 +1,65 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// Tests for the RecordBatch binary serialization
+func TestRecordBatchMarshalBinary(t *testing.T) {
+	batch := NewRecordBatch()
+
+	memoryRecord := NewRecord()
+	memoryRecord.Header.Set("WARC-Type", "resource")
+	memoryRecord.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	diskRecord := NewRecord()
+	diskRecord.Header.Set("WARC-Type", "response")
+	diskRecord.PayloadPath = "/tmp/warc-payload"
+
+	batch.Records = append(batch.Records, memoryRecord, diskRecord)
+
+	data, err := batch.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal record batch: %v", err)
+	}
+
+	decoded := new(RecordBatch)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("failed to unmarshal record batch: %v", err)
+	}
+
+	if decoded.CaptureTime != batch.CaptureTime {
+		t.Errorf("expected capture time %q, got %q", batch.CaptureTime, decoded.CaptureTime)
+	}
+
+	if len(decoded.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(decoded.Records))
+	}
+
+	if decoded.Records[0].Header.Get("WARC-Type") != "resource" {
+		t.Error("Failed to decode record header")
+	}
+
+	content, err := ioutil.ReadAll(decoded.Records[0].Content)
+	if err != nil {
+		t.Fatalf("failed to read record content: %v", err)
+	}
+	if string(content) != "Hello, World!" {
+		t.Errorf("expected %q, got %q", "Hello, World!", content)
+	}
+
+	if decoded.Records[1].Content != nil || decoded.Records[1].PayloadPath != "/tmp/warc-payload" {
+		t.Error("Failed to decode spooled record reference")
+	}
+
+	// The original record must still be readable after serialization
+	content, err = ioutil.ReadAll(memoryRecord.Content)
+	if err != nil {
+		t.Fatalf("failed to read record content: %v", err)
+	}
+	if string(content) != "Hello, World!" {
+		t.Errorf("expected %q, got %q", "Hello, World!", content)
+	}
+}
@@ -0,0 +1,59 @@
+package warc
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// URLCanonicalizer turns a URL into the key used to index and deduplicate
+// captures of that URL, so that equivalent URLs share the same key.
+type URLCanonicalizer func(rawURL string) (string, error)
+
+// wwwPrefix matches the www subdomains stripped by SURT
+var wwwPrefix = regexp.MustCompile(`^www\d*\.`)
+
+// SURT is the default URLCanonicalizer, it returns the Sort-friendly URI
+// Reordering Transform of a URL, as used by CDX indexes: the scheme,
+// www subdomain, default port and fragment are removed, the host labels
+// are reversed, query parameters are sorted and everything is lower-cased.
+// E.g. http://www.Example.com/Path?b=2&a=1 becomes com,example)/path?a=1&b=2
+func SURT(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if ip := net.ParseIP(host); ip == nil {
+		host = wwwPrefix.ReplaceAllString(host, "")
+
+		labels := strings.Split(host, ".")
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		host = strings.Join(labels, ",")
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.Strings(params)
+		path += "?" + strings.Join(params, "&")
+	}
+
+	return strings.ToLower(host + ")" + path), nil
+}
@@ -0,0 +1,31 @@
+package warc
+
+import "testing"
+
+// Tests for the SURT function
+func TestSURT(t *testing.T) {
+	var tests = map[string]string{
+		"http://www.Example.com/Path?b=2&a=1#fragment": "com,example)/path?a=1&b=2",
+		"https://example.com":                          "com,example)/",
+		"https://www2.sub.example.com:443/":            "com,example,sub)/",
+		"http://example.com:8080/index.html":           "com,example:8080)/index.html",
+		"https://[2001:db8::1]:8443/":                  "[2001:db8::1]:8443)/",
+		"http://127.0.0.1/":                            "127.0.0.1)/",
+	}
+
+	for rawURL, expected := range tests {
+		surt, err := SURT(rawURL)
+		if err != nil {
+			t.Errorf("failed to canonicalize %q: %v", rawURL, err)
+			continue
+		}
+
+		if surt != expected {
+			t.Errorf("expected %q for %q, got %q", expected, rawURL, surt)
+		}
+	}
+
+	if _, err := SURT("http://[::1"); err == nil {
+		t.Error("expected an error for an invalid URL")
+	}
+}
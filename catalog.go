@@ -0,0 +1,108 @@
+package warc
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// CatalogEntry is a record written by the rotator, as stored in a Catalog
+type CatalogEntry struct {
+	URL       string
+	Date      string
+	Status    int
+	MediaType string
+	Digest    string
+	// File is the name of the WARC file the record is written to,
+	// Offset and Length locate its compressed member in the file
+	File   string
+	Offset int64
+	Length int64
+	// Collection is the collection the record is part of, written in
+	// its CDXJ line, see RotatorSettings.Collection
+	Collection string
+}
+
+// Catalog stores the records written by the rotator in the captures
+// table of an SQL database, e.g. an SQLite database opened with the
+// driver of your choice, see RotatorSettings.Catalog
+type Catalog struct {
+	db *sql.DB
+}
+
+// catalogSchema creates the captures table if it doesn't exist
+const catalogSchema = `CREATE TABLE IF NOT EXISTS captures (
+	url TEXT NOT NULL,
+	date TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	mime TEXT NOT NULL,
+	digest TEXT NOT NULL,
+	file TEXT NOT NULL,
+	"offset" INTEGER NOT NULL,
+	"length" INTEGER NOT NULL
+)`
+
+// NewCatalog returns a Catalog storing the records in db,
+// the captures table being created if needed
+func NewCatalog(db *sql.DB) (*Catalog, error) {
+	if _, err := db.Exec(catalogSchema); err != nil {
+		return nil, err
+	}
+
+	return &Catalog{db: db}, nil
+}
+
+// Add stores entries in a single transaction, so that
+// the records of a batch are cataloged all at once
+func (c *Catalog) Add(entries []CatalogEntry) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO captures (url, date, status, mime, digest, file, "offset", "length") VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		_, err := stmt.Exec(entry.URL, entry.Date, entry.Status, entry.MediaType, entry.Digest, entry.File, entry.Offset, entry.Length)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// newCatalogEntry returns the catalog entry of a record, before it is
+// written so that its content can still be read
+func newCatalogEntry(record *Record) CatalogEntry {
+	return CatalogEntry{
+		URL:       strings.Trim(record.Header.Get("WARC-Target-URI"), "<>"),
+		Status:    recordStatusCode(record),
+		MediaType: recordMediaType(record),
+	}
+}
+
+// complete sets the fields of the catalog entry
+// of a record known once it has been written
+func (e *CatalogEntry) complete(record *Record) {
+	e.Date = record.Header.Get("WARC-Date")
+	e.Digest = record.Header.Get("WARC-Payload-Digest")
+	if e.Digest == "" {
+		e.Digest = record.Header.Get("WARC-Block-Digest")
+	}
+}
+
+// recordStatusCode returns the HTTP status code of the
+// response stored in a record, 0 for other records
+func recordStatusCode(record *Record) int {
+	startLine, err := record.HTTPStartLine()
+	if err != nil || !startLine.IsResponse() {
+		return 0
+	}
+	return startLine.StatusCode
+}
@@ -0,0 +1,146 @@
+package warc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// catalogDriver is an SQL driver keeping the committed rows in memory
+type catalogDriver struct {
+	mu      sync.Mutex
+	rows    [][]driver.Value
+	commits int
+}
+
+type catalogConn struct {
+	driver  *catalogDriver
+	pending [][]driver.Value
+}
+
+type catalogStmt struct {
+	conn  *catalogConn
+	query string
+}
+
+func (d *catalogDriver) Open(name string) (driver.Conn, error) {
+	return &catalogConn{driver: d}, nil
+}
+
+func (c *catalogConn) Prepare(query string) (driver.Stmt, error) {
+	return &catalogStmt{conn: c, query: query}, nil
+}
+
+func (c *catalogConn) Close() error { return nil }
+
+func (c *catalogConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *catalogConn) Commit() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.rows = append(c.driver.rows, c.pending...)
+	c.driver.commits++
+	c.pending = nil
+	return nil
+}
+
+func (c *catalogConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (s *catalogStmt) Close() error { return nil }
+
+func (s *catalogStmt) NumInput() int { return strings.Count(s.query, "?") }
+
+func (s *catalogStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.HasPrefix(s.query, "INSERT") {
+		s.conn.pending = append(s.conn.pending, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *catalogStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var testCatalogDriver = &catalogDriver{}
+
+func init() {
+	sql.Register("warc-catalog-test", testCatalogDriver)
+}
+
+// Tests that the rotator catalogs the records it writes
+func TestRotatorCatalog(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	testCatalogDriver.mu.Lock()
+	testCatalogDriver.rows = nil
+	testCatalogDriver.commits = 0
+	testCatalogDriver.mu.Unlock()
+
+	db, err := sql.Open("warc-catalog-test", "")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	catalog, err := NewCatalog(db)
+	if err != nil {
+		t.Fatalf("failed to create catalog: %v", err)
+	}
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.Catalog = catalog
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	batch := NewRecordBatch()
+	for _, status := range []string{"200 OK", "404 Not Found"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/"+status[:3])
+		record.Header.Set("Content-Type", "application/http; msgtype=response")
+		record.Content = strings.NewReader("HTTP/1.1 " + status + "\r\nContent-Type: text/html\r\n\r\n<html></html>")
+		batch.Records = append(batch.Records, record)
+	}
+	records <- batch
+
+	close(records)
+	<-done
+
+	if testCatalogDriver.commits != 1 || len(testCatalogDriver.rows) != 2 {
+		t.Fatalf("expected 2 rows in 1 transaction, got %d rows in %d", len(testCatalogDriver.rows), testCatalogDriver.commits)
+	}
+
+	for i, row := range testCatalogDriver.rows {
+		if row[2].(int64) != []int64{200, 404}[i] || row[3].(string) != "text/html" {
+			t.Errorf("unexpected row %v", row)
+		}
+
+		record, err := ReadRecordAt(filepath.Join(outputDirectory, row[5].(string)), row[6].(int64))
+		if err != nil {
+			t.Fatalf("failed to read cataloged record: %v", err)
+		}
+
+		if record.Header.Get("WARC-Target-URI") != row[0].(string) {
+			t.Errorf("expected %s at offset %d, got %s", row[0], row[6], record.Header.Get("WARC-Target-URI"))
+		}
+		os.Remove(record.PayloadPath)
+	}
+}
@@ -0,0 +1,59 @@
+package warc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// cdxjFields are the JSON fields of a CDXJ line
+type cdxjFields struct {
+	URL        string `json:"url"`
+	MIME       string `json:"mime,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Length     string `json:"length"`
+	Offset     string `json:"offset"`
+	Filename   string `json:"filename"`
+	Collection string `json:"collection,omitempty"`
+}
+
+// CDXJ returns the CDXJ line of the record, as read by pywb: its SURT
+// key, its 14 digits timestamp, then its fields as JSON, e.g.
+//
+//	com,example)/ 20210504101112 {"url":"https://example.com/","mime":"text/html",...}
+func (e CatalogEntry) CDXJ() (string, error) {
+	urlKey, err := SURT(e.URL)
+	if err != nil {
+		return "", err
+	}
+
+	date, err := ParseDate(e.Date)
+	if err != nil {
+		return "", err
+	}
+
+	fields := cdxjFields{
+		URL:        e.URL,
+		MIME:       e.MediaType,
+		Digest:     e.Digest,
+		Length:     strconv.FormatInt(e.Length, 10),
+		Offset:     strconv.FormatInt(e.Offset, 10),
+		Filename:   e.File,
+		Collection: e.Collection,
+	}
+	if e.Status != 0 {
+		fields.Status = strconv.Itoa(e.Status)
+	}
+
+	// URLs are kept as is, without escaping their & as \u0026
+	data := new(bytes.Buffer)
+	encoder := json.NewEncoder(data)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(fields); err != nil {
+		return "", err
+	}
+
+	return urlKey + " " + date.UTC().Format("20060102150405") + " " + strings.TrimSuffix(data.String(), "\n"), nil
+}
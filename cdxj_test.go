@@ -0,0 +1,196 @@
+package warc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests for the CatalogEntry.CDXJ method
+func TestCatalogEntryCDXJ(t *testing.T) {
+	entry := CatalogEntry{
+		URL:       "https://www.Example.com/path?b=2&a=1",
+		Date:      "2021-05-04T10:11:12Z",
+		Status:    200,
+		MediaType: "text/html",
+		Digest:    "sha1:3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ",
+		File:      "test.warc.gz",
+		Offset:    123,
+		Length:    456,
+	}
+
+	line, err := entry.CDXJ()
+	if err != nil {
+		t.Fatalf("failed to format CDXJ line: %v", err)
+	}
+
+	expected := `com,example)/path?a=1&b=2 20210504101112 {"url":"https://www.Example.com/path?b=2&a=1","mime":"text/html","status":"200",` +
+		`"digest":"sha1:3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ","length":"456","offset":"123","filename":"test.warc.gz"}`
+	if line != expected {
+		t.Errorf("expected %s, got %s", expected, line)
+	}
+
+	entry.Date = "not a date"
+	if _, err := entry.CDXJ(); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
+
+// Tests that the rotator writes the CDXJ index of its WARC files
+func TestRotatorCDXJ(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.CDXJ = true
+	rotatorSettings.Collection = "tests"
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	for _, url := range []string{"http://example.org/", "http://example.com/"} {
+		request := NewRecord()
+		request.Header.Set("WARC-Type", "request")
+		request.Header.Set("WARC-Target-URI", url)
+		request.Content = strings.NewReader("GET / HTTP/1.1\r\n\r\n")
+
+		response := NewRecord()
+		response.Header.Set("WARC-Type", "response")
+		response.Header.Set("WARC-Target-URI", url)
+		response.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + url)
+
+		batch := NewRecordBatch()
+		batch.Records = []*Record{request, response}
+		records <- batch
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	index, err := ioutil.ReadFile(paths[0] + ".cdxj")
+	if err != nil {
+		t.Fatalf("failed to read CDXJ index: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(index)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 index lines, got %q", lines)
+	}
+
+	if !strings.HasPrefix(lines[0], "com,example)/ ") || !strings.HasPrefix(lines[3], "org,example)/ ") {
+		t.Errorf("expected the index to be sorted, got %q", lines)
+	}
+
+	// The records can be read from the offsets in the index
+	for _, line := range lines {
+		var fields cdxjFields
+		if err := json.Unmarshal([]byte(line[strings.Index(line, "{"):]), &fields); err != nil {
+			t.Fatalf("failed to parse index line: %v", err)
+		}
+
+		if fields.Filename != filepath.Base(paths[0]) {
+			t.Errorf("unexpected filename %s", fields.Filename)
+		}
+
+		if fields.Collection != "tests" {
+			t.Errorf("expected the collection of the rotator, got %q", fields.Collection)
+		}
+
+		offset, _ := strconv.ParseInt(fields.Offset, 10, 64)
+		record, err := ReadRecordAt(paths[0], offset)
+		if err != nil {
+			t.Fatalf("failed to read record at %d: %v", offset, err)
+		}
+
+		if record.Header.Get("WARC-Target-URI") != fields.URL {
+			t.Errorf("expected the record of %s at %d, got %s", fields.URL, offset, record.Header.Get("WARC-Target-URI"))
+		}
+
+		if record.Header.Get("WARC-Type") == "response" && fields.Status != "200" {
+			t.Errorf("expected status 200, got %s", fields.Status)
+		}
+	}
+}
+
+// Tests that the records are indexed in the CDXJ index of the WARC file
+// they are written to when the file is rotated while a batch is pending
+func TestRotatorCDXJRotationWithPendingBatch(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.CDXJ = true
+	rotatorSettings.CoalesceLatency = time.Hour
+
+	// While the first batch is written, a rotation
+	// is requested for the second batch
+	var once sync.Once
+	rotatorSettings.EnrichmentHook = func(record *Record) {
+		once.Do(func() {
+			rotatorSettings.SetWarcinfoContent(Header{"operator": "night shift"})
+			time.Sleep(100 * time.Millisecond)
+		})
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	written := queueBatches(records, []string{"http://example.com/a", "http://example.com/b"})
+	if !written[0] || !written[1] {
+		t.Fatalf("expected the batches to be written, got %v", written)
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("expected 2 WARC files, got %v, %v", paths, err)
+	}
+	sort.Strings(paths)
+
+	for i, url := range []string{"http://example.com/a", "http://example.com/b"} {
+		index, err := ioutil.ReadFile(paths[i] + ".cdxj")
+		if err != nil {
+			t.Fatalf("failed to read CDXJ index: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(index)), "\n")
+		if len(lines) != 1 || !strings.Contains(lines[0], "{") {
+			t.Fatalf("expected 1 index line in %s, got %q", paths[i], lines)
+		}
+
+		var fields cdxjFields
+		if err := json.Unmarshal([]byte(lines[0][strings.Index(lines[0], "{"):]), &fields); err != nil {
+			t.Fatalf("failed to parse index line: %v", err)
+		}
+
+		if fields.URL != url || fields.Filename != filepath.Base(paths[i]) {
+			t.Errorf("expected %s indexed in %s, got %+v", url, filepath.Base(paths[i]), fields)
+		}
+	}
+}
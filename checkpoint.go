@@ -0,0 +1,161 @@
+package warc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// RotatorCheckpoint is the state of a rotator saved to
+// RotatorSettings.CheckpointPath, see ResumeRotator
+type RotatorCheckpoint struct {
+	// Serial is the serial number of the last WARC file opened
+	Serial int `json:"serial"`
+	// CrawlID is the crawl ID of the rotator
+	CrawlID string `json:"crawlID,omitempty"`
+	// Hosts are the statistics of the records written, see HostStats
+	Hosts []HostStats `json:"hosts"`
+	// Digests are the payload digests of the Dedup store, if it is a
+	// MemoryDedupStore, and the records first written with them. They are
+	// saved next to the checkpoint, see digestsPath, each time a WARC file
+	// is closed rather than after each flush.
+	Digests map[string]RefersTo `json:"-"`
+	// Saved is when the checkpoint was saved
+	Saved time.Time `json:"saved"`
+}
+
+// LoadRotatorCheckpoint reads a checkpoint saved by a rotator
+func LoadRotatorCheckpoint(path string) (*RotatorCheckpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := new(RotatorCheckpoint)
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, errors.New("Invalid rotator checkpoint " + path + ": " + err.Error())
+	}
+
+	data, err = ioutil.ReadFile(digestsPath(path))
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &checkpoint.Digests); err != nil {
+		return nil, errors.New("Invalid rotator checkpoint digests " + digestsPath(path) + ": " + err.Error())
+	}
+
+	return checkpoint, nil
+}
+
+// digestsPath returns the path the digests of
+// the checkpoint at path are saved to
+func digestsPath(path string) string {
+	return path + ".digests"
+}
+
+// ResumeRotator starts a rotator like NewWARCRotator, resuming from the
+// checkpoint at path if it exists: the serial numbers of the WARC files
+// continue from the checkpoint, whose crawl ID is used unless CrawlID is
+// set, and whose host statistics are kept. The payload digests of the
+// checkpoint are added to Dedup, a MemoryDedupStore being created if it
+// is nil, so that the payloads already written aren't written again. A
+// Dedup store of another type is expected to persist its digests itself,
+// and is left as is. The state of the rotator is
+// then saved to path, CheckpointPath being set to it.
+func (s *RotatorSettings) ResumeRotator(path string) (recordWriterChannel chan *RecordBatch, done chan bool, err error) {
+	checkpoint, err := LoadRotatorCheckpoint(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if checkpoint != nil {
+		rotator := s.nextRotator()
+		rotator.firstSerial = checkpoint.Serial + 1
+
+		if s.CrawlID == "" {
+			s.CrawlID = checkpoint.CrawlID
+		}
+
+		rotator.stats.mu.Lock()
+		rotator.stats.hosts = make(map[string]*HostStats)
+		for _, host := range checkpoint.Hosts {
+			host := host
+			rotator.stats.hosts[host.Host] = &host
+		}
+		rotator.stats.mu.Unlock()
+
+		if len(checkpoint.Digests) > 0 {
+			if s.Dedup == nil {
+				s.Dedup = NewMemoryDedupStore()
+			}
+
+			if store, ok := s.Dedup.(*MemoryDedupStore); ok {
+				for digest, original := range checkpoint.Digests {
+					store.AddDigest(digest, original)
+				}
+			}
+		}
+	}
+
+	s.CheckpointPath = path
+
+	return s.NewWARCRotator()
+}
+
+// saveCheckpoint saves the state of the rotator to CheckpointPath, with
+// the statistics of hosts, if set, replacing the previous checkpoint
+// atomically
+func (r *rotatorState) saveCheckpoint(serial int, hosts []HostStats) error {
+	s := r.settings
+	if s.CheckpointPath == "" {
+		return nil
+	}
+
+	checkpoint := &RotatorCheckpoint{
+		Serial:  serial,
+		CrawlID: s.CrawlID,
+		Hosts:   hosts,
+		Saved:   time.Now().UTC(),
+	}
+
+	return writeJSONFile(s.CheckpointPath, checkpoint)
+}
+
+// saveCheckpointDigests saves the payload digests of the Dedup store, if
+// it is a MemoryDedupStore, next to the checkpoint. The whole store being
+// copied, it is only saved when a WARC file is closed: missing the digests
+// written since makes their duplicates written in full.
+func (r *rotatorState) saveCheckpointDigests() error {
+	s := r.settings
+	if s.CheckpointPath == "" {
+		return nil
+	}
+
+	store, ok := s.Dedup.(*MemoryDedupStore)
+	if !ok {
+		return nil
+	}
+
+	return writeJSONFile(digestsPath(s.CheckpointPath), store.snapshot())
+}
+
+// writeJSONFile writes v as JSON to path, replacing the
+// previous file atomically
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
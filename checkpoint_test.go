@@ -0,0 +1,161 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Tests that a rotator resumed from a checkpoint continues
+// the serial numbers and statistics of the previous one
+func TestResumeRotator(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	checkpointPath := filepath.Join(outputDirectory, "rotator.json")
+
+	for _, crawlID := range []string{"weekly", ""} {
+		rotatorSettings := NewRotatorSettings()
+		rotatorSettings.OutputDirectory = outputDirectory
+		rotatorSettings.CrawlID = crawlID
+
+		records, done, err := rotatorSettings.ResumeRotator(checkpointPath)
+		if err != nil {
+			t.Fatalf("failed to resume rotator: %v", err)
+		}
+
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		records <- batch
+
+		close(records)
+		<-done
+	}
+
+	checkpoint, err := LoadRotatorCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatalf("failed to load checkpoint: %v", err)
+	}
+
+	if checkpoint.Serial != 2 || checkpoint.CrawlID != "weekly" {
+		t.Errorf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	if len(checkpoint.Hosts) != 1 || checkpoint.Hosts[0].Records != 2 {
+		t.Errorf("expected the statistics of both runs, got %+v", checkpoint.Hosts)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("expected 2 WARC files, got %v, %v", paths, err)
+	}
+	sort.Strings(paths)
+
+	for i, serial := range []string{"-00001-", "-00002-"} {
+		if !strings.Contains(paths[i], serial) {
+			t.Errorf("expected serial %s in %s", serial, paths[i])
+		}
+	}
+}
+
+// Tests that a rotator resumed from a checkpoint keeps
+// deduplicating the payloads written by the previous one
+func TestResumeRotatorDedup(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	checkpointPath := filepath.Join(outputDirectory, "rotator.json")
+
+	for i, url := range []string{"http://example.com/", "http://example.org/mirror"} {
+		rotatorSettings := NewRotatorSettings()
+		rotatorSettings.OutputDirectory = outputDirectory
+		if i == 0 {
+			rotatorSettings.Dedup = NewMemoryDedupStore()
+		}
+
+		records, done, err := rotatorSettings.ResumeRotator(checkpointPath)
+		if err != nil {
+			t.Fatalf("failed to resume rotator: %v", err)
+		}
+
+		store, ok := rotatorSettings.Dedup.(*MemoryDedupStore)
+		if !ok || store.Len() != i {
+			t.Fatalf("run %d: expected %d payload digests restored, got %+v", i, i, rotatorSettings.Dedup)
+		}
+
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", url)
+		record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\nHello, World!")
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool)
+		records <- batch
+		<-batch.Done
+
+		// The digests are saved once the WARC file is closed, not after each flush
+		if i == 0 {
+			if _, err := os.Stat(checkpointPath + ".digests"); !os.IsNotExist(err) {
+				t.Errorf("expected no digests saved before the WARC file is closed, got %v", err)
+			}
+		}
+
+		close(records)
+		<-done
+
+		checkpoint, err := LoadRotatorCheckpoint(checkpointPath)
+		if err != nil || len(checkpoint.Digests) != 1 {
+			t.Fatalf("run %d: expected 1 payload digest saved, got %+v, %v", i, checkpoint, err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*-00002-*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected the WARC file of the resumed rotator, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var types []string
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		types = append(types, record.Header.Get("WARC-Type"))
+	}
+
+	if len(types) != 2 || types[1] != "revisit" {
+		t.Errorf("expected the payload written by the previous rotator revisited, got %v", types)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	fairuse "github.com/fairuse/warc"
 	"github.com/slyrz/warc"
 	"io"
 	"log"
@@ -38,12 +39,29 @@ func filterWarc(writer *warc.Writer, filename string, filterKey string,
 	}
 }
 
+func listWarc(filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Fatalln(err, "opening", filename)
+	}
+	defer file.Close()
+	frames, err := fairuse.ReadRecordFrames(file)
+	if err != nil {
+		log.Fatalln(err, "listing records of", filename)
+	}
+	for _, frame := range frames {
+		fmt.Printf("%s\t%d\t%d\t%d\n", filename, frame.Offset,
+			frame.CompressedSize, frame.Size)
+	}
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s SUBCOMMAND [arguments]\n", os.Args[0])
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintf(os.Stderr, "Subcommands:\n")
 		fmt.Fprintf(os.Stderr, "\tfilter: filter input warcs to create new warcs\n")
+		fmt.Fprintf(os.Stderr, "\tls: list the records of zstd warcs with skippable frames\n")
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintf(os.Stderr, "Use %s SUBCOMMAND --help for more information about a command\n", os.Args[0])
 		flag.PrintDefaults()
@@ -62,6 +80,14 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\t%s filter warc-type:response foo.warc.gz bar.warc.gz\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t\tWrite response records from the input files to stdout\n")
 	}
+	lsCommand := flag.NewFlagSet("ls", flag.ExitOnError)
+	lsCommand.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s ls WARCFILE...\n", os.Args[0])
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "Lists the records of .warc.zst files written with skippable frames,\n")
+		fmt.Fprintf(os.Stderr, "without decompressing them, one per line: file, offset,\n")
+		fmt.Fprintf(os.Stderr, "compressed size and size\n")
+	}
 	if len(os.Args) < 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -69,11 +95,23 @@ func main() {
 	switch os.Args[1] {
 	case "filter":
 		filterCommand.Parse(os.Args[2:])
+	case "ls":
+		lsCommand.Parse(os.Args[2:])
 	default:
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if lsCommand.Parsed() {
+		if lsCommand.NArg() < 1 {
+			lsCommand.Usage()
+			os.Exit(1)
+		}
+		for i := 0; i < lsCommand.NArg(); i++ {
+			listWarc(lsCommand.Arg(i))
+		}
+	}
+
 	if filterCommand.Parsed() {
 		if filterCommand.NArg() < 2 {
 			filterCommand.Usage()
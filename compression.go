@@ -0,0 +1,106 @@
+package warc
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression algorithms supported out of the box, other algorithms
+// can be added with RegisterCompression. An empty compression means
+// that the WARC files are not compressed. ZSTD isn't available when
+// building with the nozstd tag, unless registered with RegisterCompression.
+const (
+	CompressionNone = ""
+	CompressionGZIP = "GZIP"
+	CompressionZSTD = "ZSTD"
+)
+
+// NewCompressionWriterFunc returns a writer compressing
+// the data written to it into w
+type NewCompressionWriterFunc func(w io.Writer) (io.WriteCloser, error)
+
+// NewCompressionReaderFunc returns a reader decompressing
+// the data read from r
+type NewCompressionReaderFunc func(r io.Reader) (io.ReadCloser, error)
+
+// compressionCodec is a registered compression algorithm
+type compressionCodec struct {
+	extension string
+	newWriter NewCompressionWriterFunc
+	newReader NewCompressionReaderFunc
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = make(map[string]compressionCodec)
+)
+
+func init() {
+	registerCompression(CompressionGZIP, ".gz",
+		func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+}
+
+// RegisterCompression registers a compression algorithm that can then be
+// used as the compression of a Writer, a MemberWriter, the rotator or a
+// Reader. WARC files using it get the ".warc.<lowercase name>" extension.
+// Since such files are read as a stream of records, the reader returned
+// by newReader must decompress concatenated members as a single stream,
+// like gzip.Reader does.
+// Registering an already registered name replaces it.
+func RegisterCompression(name string, newWriter NewCompressionWriterFunc, newReader NewCompressionReaderFunc) error {
+	if name == "" {
+		return errors.New("Compression name can't be empty")
+	}
+
+	if newWriter == nil || newReader == nil {
+		return errors.New("Compression " + name + " needs both a writer and a reader")
+	}
+
+	registerCompression(name, "."+strings.ToLower(name), newWriter, newReader)
+
+	return nil
+}
+
+func registerCompression(name string, extension string, newWriter NewCompressionWriterFunc, newReader NewCompressionReaderFunc) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+
+	compressions[name] = compressionCodec{
+		extension: extension,
+		newWriter: newWriter,
+		newReader: newReader,
+	}
+}
+
+// lookupCompression returns the registered compression algorithm
+// named name, if any
+func lookupCompression(name string) (compressionCodec, error) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+
+	codec, ok := compressions[name]
+	if !ok {
+		return codec, errors.New("Invalid compression algorithm: " + name)
+	}
+
+	return codec, nil
+}
+
+// checkCompression returns an error if compression isn't
+// empty nor a registered compression algorithm
+func checkCompression(compression string) error {
+	if compression == CompressionNone {
+		return nil
+	}
+
+	_, err := lookupCompression(compression)
+	return err
+}
@@ -0,0 +1,132 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestRecords writes testRecords to a buffer, each
+// record in its own member compressed with compression
+func writeTestRecords(t *testing.T, compression string) *bytes.Buffer {
+	buffer := new(bytes.Buffer)
+
+	memberWriter, err := NewMemberWriter(buffer, compression)
+	if err != nil {
+		t.Fatalf("failed to create member writer: %v", err)
+	}
+
+	writer, err := NewWriter(memberWriter, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+
+	for _, testRecord := range testRecords {
+		record := NewRecord()
+		for key, value := range testRecord.Header {
+			record.Header.Set(key, value)
+		}
+		record.Content = bytes.NewReader(testRecord.Content)
+
+		if err := memberWriter.Begin(); err != nil {
+			t.Fatalf("failed to begin member: %v", err)
+		}
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("error while writing test record: %v", err)
+		}
+		if err := memberWriter.End(); err != nil {
+			t.Fatalf("failed to end member: %v", err)
+		}
+	}
+
+	return buffer
+}
+
+// readTestRecords reads testRecords back from reader
+func readTestRecords(t *testing.T, reader *Reader) {
+	for i, testRecord := range testRecords {
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("expected record %d, got %v", i, err)
+		}
+
+		for key, val := range testRecord.Header {
+			if record.Header.Get(key) != val {
+				t.Errorf("expected %q = %q, got %q", key, val, record.Header.Get(key))
+			}
+		}
+
+		content, err := ioutil.ReadAll(record.Content)
+		if err != nil {
+			t.Fatalf("failed reading the test record: %v", err)
+		}
+
+		if !bytes.Equal(content, testRecord.Content) {
+			t.Errorf("expected %q, got %q", testRecord.Content, content)
+		}
+	}
+
+	if _, err := reader.ReadRecord(false); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+// testCompressions returns the compression algorithms built in, ZSTD
+// being left out when building with the nozstd tag
+func testCompressions() []string {
+	compressions := []string{CompressionNone, CompressionGZIP}
+	if _, err := lookupCompression(CompressionZSTD); err == nil {
+		compressions = append(compressions, CompressionZSTD)
+	}
+	return compressions
+}
+
+// Tests for the compression detection of the Reader
+func TestReaderCompressionDetection(t *testing.T) {
+	for _, compression := range testCompressions() {
+		t.Logf("compression %q", compression)
+
+		reader, err := NewReader(writeTestRecords(t, compression))
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+
+		readTestRecords(t, reader)
+		reader.Close()
+	}
+}
+
+// Tests for the RegisterCompression function
+func TestRegisterCompression(t *testing.T) {
+	err := RegisterCompression("TESTGZIP",
+		func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+	if err != nil {
+		t.Fatalf("failed to register compression: %v", err)
+	}
+
+	if err := RegisterCompression("NOREADER", nil, nil); err == nil {
+		t.Error("expected an error when registering a compression without writer and reader")
+	}
+
+	if fileName, _ := GenerateWarcFileName(&RotatorSettings{Prefix: "WARC", Compression: "TESTGZIP"}, 1, time.Now()); !strings.HasSuffix(fileName, ".warc.testgzip") {
+		t.Errorf("unexpected file name %q", fileName)
+	}
+
+	// Files using a registered compression are read as a stream of records
+	reader, err := NewReaderWithOptions(writeTestRecords(t, "TESTGZIP"), ReaderOptions{Compression: "TESTGZIP"})
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	readTestRecords(t, reader)
+}
@@ -0,0 +1,30 @@
+package warc
+
+import "context"
+
+// CrawlIDField is the header field set by the rotator to the crawl ID
+// of each record when RotatorSettings.CrawlIDField is set
+const CrawlIDField = "WARC-Crawl-ID"
+
+// crawlIDKey is the context key of the crawl ID
+type crawlIDKey struct{}
+
+// WithCrawlID returns a copy of ctx carrying a crawl ID, overriding
+// RotatorSettings.CrawlID for the batches created with NewRecordBatchContext
+func WithCrawlID(ctx context.Context, crawlID string) context.Context {
+	return context.WithValue(ctx, crawlIDKey{}, crawlID)
+}
+
+// CrawlIDFromContext returns the crawl ID carried by ctx, if any
+func CrawlIDFromContext(ctx context.Context) (string, bool) {
+	crawlID, ok := ctx.Value(crawlIDKey{}).(string)
+	return crawlID, ok
+}
+
+// NewRecordBatchContext creates a record batch like NewRecordBatch,
+// using the crawl ID carried by ctx, if any
+func NewRecordBatchContext(ctx context.Context) *RecordBatch {
+	batch := NewRecordBatch()
+	batch.CrawlID, _ = CrawlIDFromContext(ctx)
+	return batch
+}
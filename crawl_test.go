@@ -0,0 +1,88 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the rotator stamps the crawl ID in the warcinfo
+// record and in the records, with per-batch overrides
+func TestRotatorCrawlID(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.CrawlID = "weekly"
+	rotatorSettings.CrawlIDField = true
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	for _, ctx := range []context.Context{context.Background(), WithCrawlID(context.Background(), "urgent")} {
+		record := NewRecord()
+		record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+		batch := NewRecordBatchContext(ctx)
+		batch.Records = append(batch.Records, record)
+		records <- batch
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	warcinfo, err := reader.Warcinfo()
+	if err != nil {
+		t.Fatalf("failed to read warcinfo: %v", err)
+	}
+
+	if warcinfo.Get("crawlID") != "weekly" {
+		t.Errorf("expected crawlID weekly in warcinfo, got %q", warcinfo.Get("crawlID"))
+	}
+
+	var crawlIDs []string
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		if record.Header.Get("WARC-Type") != "warcinfo" {
+			crawlIDs = append(crawlIDs, record.Header.Get(CrawlIDField))
+		}
+	}
+
+	if len(crawlIDs) != 2 || crawlIDs[0] != "weekly" || crawlIDs[1] != "urgent" {
+		t.Errorf("unexpected crawl IDs %q", crawlIDs)
+	}
+}
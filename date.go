@@ -0,0 +1,47 @@
+package warc
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// WARC format versions, as written in the first line of the records
+const (
+	Version10 = "WARC/1.0"
+	Version11 = "WARC/1.1"
+)
+
+// dateLayouts are the W3C-ISO8601 layouts accepted for WARC-Date,
+// from the most to the least precise
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseDate parses a WARC-Date, with second precision as in WARC 1.0 or
+// with fractional seconds as allowed by WARC 1.1. Less precise dates,
+// e.g. "2006-01-02", are accepted too.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, errors.New("Malformed WARC-Date: " + value)
+}
+
+// FormatDate formats t as a WARC-Date in UTC, with second precision for
+// WARC 1.0 and microsecond precision for WARC 1.1.
+func FormatDate(t time.Time, version string) string {
+	if version == Version11 {
+		return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+	}
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,42 @@
+package warc
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests for the ParseDate function
+func TestParseDate(t *testing.T) {
+	for value, expected := range map[string]time.Time{
+		"2021-05-04T10:11:12Z":        time.Date(2021, 5, 4, 10, 11, 12, 0, time.UTC),
+		"2021-05-04T10:11:12.345678Z": time.Date(2021, 5, 4, 10, 11, 12, 345678000, time.UTC),
+		"2021-05-04T12:11:12+02:00":   time.Date(2021, 5, 4, 10, 11, 12, 0, time.UTC),
+		"2021-05-04T10:11Z":           time.Date(2021, 5, 4, 10, 11, 0, 0, time.UTC),
+		"2021-05-04":                  time.Date(2021, 5, 4, 0, 0, 0, 0, time.UTC),
+		"2021":                        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		date, err := ParseDate(value)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", value, err)
+		} else if !date.Equal(expected) {
+			t.Errorf("expected %v for %q, got %v", expected, value, date)
+		}
+	}
+
+	if _, err := ParseDate("yesterday"); err == nil {
+		t.Error("expected an error for a malformed date")
+	}
+}
+
+// Tests for the FormatDate function
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2021, 5, 4, 12, 11, 12, 345678900, time.FixedZone("CEST", 2*60*60))
+
+	if formatted := FormatDate(date, Version10); formatted != "2021-05-04T10:11:12Z" {
+		t.Errorf("unexpected WARC 1.0 date %q", formatted)
+	}
+
+	if formatted := FormatDate(date, Version11); formatted != "2021-05-04T10:11:12.345678Z" {
+		t.Errorf("unexpected WARC 1.1 date %q", formatted)
+	}
+}
@@ -0,0 +1,180 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// emptyPayloadDigest returns the digest of an empty payload, such
+// payloads are never deduplicated
+func emptyPayloadDigest(algorithm string) string {
+	digest, _ := computeDigest(algorithm, bytes.NewReader(nil))
+	return digest
+}
+
+// DedupStore keeps track of the payload digests of the response records
+// written during a crawl, so that identical payloads are only written
+// once, whatever their URL, see RotatorSettings.Dedup
+type DedupStore interface {
+	// LookupDigest returns the reference to the record first written
+	// with a payload digest, ok is false if there is none
+	LookupDigest(digest string) (original RefersTo, ok bool, err error)
+	// AddDigest records the record written with a payload digest
+	AddDigest(digest string, original RefersTo) error
+}
+
+// MemoryDedupStore is a DedupStore kept in memory,
+// it can be shared by several rotators
+type MemoryDedupStore struct {
+	mu      sync.RWMutex
+	digests map[string]RefersTo
+}
+
+// NewMemoryDedupStore returns an empty MemoryDedupStore
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{digests: make(map[string]RefersTo)}
+}
+
+// LookupDigest implements DedupStore
+func (s *MemoryDedupStore) LookupDigest(digest string) (RefersTo, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	original, ok := s.digests[digest]
+	return original, ok, nil
+}
+
+// AddDigest implements DedupStore, the first record
+// written with a digest is kept
+func (s *MemoryDedupStore) AddDigest(digest string, original RefersTo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.digests[digest]; !ok {
+		s.digests[digest] = original
+	}
+	return nil
+}
+
+// Len returns the number of payload digests in the store
+func (s *MemoryDedupStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.digests)
+}
+
+// snapshot returns a copy of the payload digests in the store
+func (s *MemoryDedupStore) snapshot() map[string]RefersTo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digests := make(map[string]RefersTo, len(s.digests))
+	for digest, original := range s.digests {
+		digests[digest] = original
+	}
+	return digests
+}
+
+// NewRevisitRecord returns a revisit record standing for a response record
+// whose payload is identical to the one of original, with the
+// identical-payload-digest profile. The block of the revisit record is the
+// HTTP head of the response, its payload being left out. The profile is
+// the WARC 1.0 one, the version of the records written by Writer.
+func NewRevisitRecord(record *Record, original RefersTo, payloadDigest string) (*Record, error) {
+	if warcType := record.Header.Get("WARC-Type"); warcType != "response" {
+		return nil, errors.New("Only response records can be deduplicated: " + warcType)
+	}
+
+	head, err := record.HTTPHead()
+	if err != nil {
+		return nil, err
+	}
+
+	revisit := &Record{Header: record.Header.Clone()}
+	for _, key := range []string{"WARC-Block-Digest", "Content-Length", DeclaredContentLengthField} {
+		revisit.Header.Del(key)
+	}
+	revisit.Header.Set("WARC-Type", "revisit")
+	revisit.Header.Set("WARC-Payload-Digest", payloadDigest)
+	revisit.Header.Set("Content-Type", "application/http; msgtype=response")
+	revisit.Content = bytes.NewReader(head)
+
+	if err := revisit.SetRevisitProfile(ProfileIdenticalPayloadDigest10); err != nil {
+		return nil, err
+	}
+	if err := revisit.SetRefersTo(original); err != nil {
+		return nil, err
+	}
+
+	return revisit, nil
+}
+
+// NewCacheHitRecord returns a revisit record standing for a fetch of
+// targetURI answered by an HTTP cache, rather than by the origin server,
+// with a response stored by original, so that the fetch isn't missing
+// from the archive. head is the HTTP head of the cached response, the
+// block of the revisit record, and payloadDigest the WARC-Payload-Digest
+// of original. The revisit record has the WARC 1.0 identical-payload-digest
+// profile.
+func NewCacheHitRecord(targetURI string, head []byte, original RefersTo, payloadDigest string) (*Record, error) {
+	if payloadDigest == "" {
+		return nil, errors.New("Cache hit needs the payload digest of the original record")
+	}
+
+	revisit := NewRecord()
+	revisit.Header.Set("WARC-Type", "revisit")
+	revisit.Header.Set("WARC-Target-URI", targetURI)
+	revisit.Header.Set("WARC-Payload-Digest", payloadDigest)
+	revisit.Header.Set("Content-Type", "application/http; msgtype=response")
+	revisit.Content = bytes.NewReader(head)
+
+	if err := revisit.SetRevisitProfile(ProfileIdenticalPayloadDigest10); err != nil {
+		return nil, err
+	}
+	if err := revisit.SetRefersTo(original); err != nil {
+		return nil, err
+	}
+
+	return revisit, nil
+}
+
+// dedupRecord returns the revisit record to write instead of a response
+// record whose payload was already written, or the record itself with its
+// WARC-Payload-Digest set. The digest is only returned for the records to
+// add to the store once written. Digests are computed with algorithm.
+func dedupRecord(store DedupStore, record *Record, algorithm string) (*Record, string, error) {
+	if record.Header.Get("WARC-Type") != "response" {
+		return record, "", nil
+	}
+
+	digests, err := record.payloadDigests(algorithm)
+	if err != nil {
+		// Not an HTTP response, it is written as is
+		return record, "", nil
+	}
+
+	if digests.Payload == emptyPayloadDigest(algorithm) {
+		return record, "", nil
+	}
+
+	original, ok, err := store.LookupDigest(digests.Payload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ok {
+		revisit, err := NewRevisitRecord(record, original, digests.Payload)
+		if err != nil {
+			return nil, "", err
+		}
+		return revisit, "", nil
+	}
+
+	if record.Header.Get("WARC-Payload-Digest") == "" {
+		record.Header.Set("WARC-Payload-Digest", digests.Payload)
+	}
+
+	return record, digests.Payload, nil
+}
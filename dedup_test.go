@@ -0,0 +1,132 @@
+package warc
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that the rotator writes revisit records
+// for the payloads it already wrote
+func TestRotatorDedup(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	store := NewMemoryDedupStore()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.Dedup = store
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	for _, capture := range []struct {
+		url  string
+		body string
+	}{
+		{"http://example.com/", "Hello, World!"},
+		{"http://example.org/mirror", "Hello, World!"},
+		{"http://example.com/other", "Goodbye!"},
+		{"http://example.com/empty", ""},
+		{"http://example.com/empty-too", ""},
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", capture.url)
+		record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nX-URL: " + capture.url + "\r\n\r\n" + capture.body)
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool)
+		records <- batch
+		<-batch.Done
+	}
+
+	close(records)
+	<-done
+
+	if store.Len() != 2 {
+		t.Errorf("expected 2 payload digests in the store, got %d", store.Len())
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	written := make(map[string]*Record)
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		written[record.Header.Get("WARC-Target-URI")] = record
+	}
+
+	original := written["http://example.com/"]
+	revisit := written["http://example.org/mirror"]
+	if original.Header.Get("WARC-Type") != "response" || revisit.Header.Get("WARC-Type") != "revisit" {
+		t.Fatalf("expected a response and its revisit, got %s and %s", original.Header.Get("WARC-Type"), revisit.Header.Get("WARC-Type"))
+	}
+
+	if revisit.RefersTo() != NewRefersTo(original) {
+		t.Errorf("expected the revisit to refer to %+v, got %+v", NewRefersTo(original), revisit.RefersTo())
+	}
+
+	if revisit.RevisitProfile() != ProfileIdenticalPayloadDigest10 {
+		t.Errorf("unexpected revisit profile %s", revisit.RevisitProfile())
+	}
+
+	if revisit.Header.Get("WARC-Payload-Digest") != original.Header.Get("WARC-Payload-Digest") || revisit.Header.Get("WARC-Payload-Digest") == "" {
+		t.Errorf("expected identical payload digests, got %s and %s", original.Header.Get("WARC-Payload-Digest"), revisit.Header.Get("WARC-Payload-Digest"))
+	}
+
+	content, err := ioutil.ReadAll(revisit.Content)
+	if err != nil {
+		t.Fatalf("failed to read revisit content: %v", err)
+	}
+	if string(content) != "HTTP/1.1 200 OK\r\nX-URL: http://example.org/mirror\r\n\r\n" {
+		t.Errorf("expected the HTTP head of the revisited response, got %q", content)
+	}
+
+	for _, url := range []string{"http://example.com/other", "http://example.com/empty", "http://example.com/empty-too"} {
+		if warcType := written[url].Header.Get("WARC-Type"); warcType != "response" {
+			t.Errorf("expected a response record for %s, got %s", url, warcType)
+		}
+	}
+}
+
+// Tests that NewRevisitRecord only accepts response records
+func TestNewRevisitRecord(t *testing.T) {
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "resource")
+	record.Content = strings.NewReader("Hello, World!")
+
+	if _, err := NewRevisitRecord(record, RefersTo{}, "sha1:"+GetSHA1([]byte("Hello, World!"))); err == nil {
+		t.Error("expected an error for a resource record")
+	}
+}
@@ -0,0 +1,129 @@
+package warc
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Digest algorithms supported out of the box
+const (
+	DigestSHA1   = "sha1"
+	DigestSHA256 = "sha256"
+)
+
+var (
+	digestAlgorithmsMu sync.RWMutex
+	digestHashes       = map[string]func() hash.Hash{
+		DigestSHA1:   sha1.New,
+		DigestSHA256: sha256.New,
+	}
+)
+
+// RegisterDigestAlgorithm registers a hash function under the label
+// written in the digests computed with it, e.g. "blake3", so that it
+// can be used as the DigestAlgorithm of a Writer or of the rotator and
+// that the digests using it can be verified by ValidateFile. sha1 and
+// sha256 are supported out of the box. Registering an already registered
+// algorithm replaces it.
+func RegisterDigestAlgorithm(name string, newHash func() hash.Hash) error {
+	if name == "" || newHash == nil {
+		return errors.New("Digest algorithm needs a name and a hash function")
+	}
+
+	digestAlgorithmsMu.Lock()
+	defer digestAlgorithmsMu.Unlock()
+
+	digestHashes[normalizeDigestAlgorithm(name)] = newHash
+
+	return nil
+}
+
+// lookupDigestAlgorithm returns the hash function of a digest
+// algorithm, SHA1 being the default one
+func lookupDigestAlgorithm(name string) (func() hash.Hash, error) {
+	if name == "" {
+		name = DigestSHA1
+	}
+
+	digestAlgorithmsMu.RLock()
+	defer digestAlgorithmsMu.RUnlock()
+
+	newHash, ok := digestHashes[normalizeDigestAlgorithm(name)]
+	if !ok {
+		return nil, errors.New("Unsupported digest algorithm: " + name)
+	}
+	return newHash, nil
+}
+
+// normalizeDigestAlgorithm returns the label of a digest algorithm
+// as it is written in digests, e.g. "sha256" for "SHA-256"
+func normalizeDigestAlgorithm(name string) string {
+	return strings.ToLower(strings.Replace(name, "-", "", -1))
+}
+
+// formatDigest returns the labelled digest of a hash sum. Digests are
+// encoded in base32 whatever the algorithm, as recommended by the WARC
+// specification for SHA1 and done by most tools for the others.
+func formatDigest(algorithm string, sum []byte) string {
+	if algorithm == "" {
+		algorithm = DigestSHA1
+	}
+	return normalizeDigestAlgorithm(algorithm) + ":" + base32.StdEncoding.EncodeToString(sum)
+}
+
+// computeDigest returns the labelled digest of the data read from reader
+func computeDigest(algorithm string, reader io.Reader) (string, error) {
+	newHash, err := lookupDigestAlgorithm(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	hash := newHash()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return formatDigest(algorithm, hash.Sum(nil)), nil
+}
+
+// setPayloadDigest sets the WARC-Payload-Digest of a response or resource
+// record, the records whose payload can't be read are left as is
+func setPayloadDigest(record *Record, algorithm string) {
+	if digest, err := record.payloadDigest(algorithm); err == nil {
+		record.Header.Set("WARC-Payload-Digest", digest)
+	}
+}
+
+// payloadDigest computes the digest of the payload of a response or
+// resource record: the entity body of the HTTP response, without its
+// transfer encoding but with its content encoding, or the block of the
+// resource record. The record content can still be read afterwards.
+func (r *Record) payloadDigest(algorithm string) (string, error) {
+	warcType := r.Header.Get("WARC-Type")
+	if warcType != "response" && warcType != "resource" {
+		return "", errors.New("Record has no payload: " + warcType)
+	}
+
+	block, err := r.blockReader()
+	if err != nil {
+		return "", err
+	}
+	defer block.Close()
+
+	if warcType == "resource" {
+		return computeDigest(algorithm, block)
+	}
+
+	resp, err := readHTTPResponse(block)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	return computeDigest(algorithm, resp.Body)
+}
@@ -0,0 +1,195 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that the rotator computes the block and payload
+// digests with its DigestAlgorithm
+func TestRotatorDigestAlgorithm(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.DigestAlgorithm = DigestSHA256
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\nHello, World!")
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	for {
+		written, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("expected a response record: %v", err)
+		}
+		if written.Header.Get("WARC-Type") != "response" {
+			continue
+		}
+
+		block := sha256.Sum256([]byte("HTTP/1.1 200 OK\r\n\r\nHello, World!"))
+		if expected := "sha256:" + base32.StdEncoding.EncodeToString(block[:]); written.Header.Get("WARC-Block-Digest") != expected {
+			t.Errorf("expected block digest %s, got %s", expected, written.Header.Get("WARC-Block-Digest"))
+		}
+
+		payload := sha256.Sum256([]byte("Hello, World!"))
+		if expected := "sha256:" + base32.StdEncoding.EncodeToString(payload[:]); written.Header.Get("WARC-Payload-Digest") != expected {
+			t.Errorf("expected payload digest %s, got %s", expected, written.Header.Get("WARC-Payload-Digest"))
+		}
+		break
+	}
+
+	invalid, err := ValidateFile(paths[0])
+	if err != nil || len(invalid) != 0 {
+		t.Errorf("expected a valid WARC file, got %+v, %v", invalid, err)
+	}
+}
+
+// Tests that ValidateFile checks SHA256 digests
+func TestValidateFileSHA256(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-validate-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	writer.DigestAlgorithm = "SHA-256"
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "resource")
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Content = strings.NewReader("Hello, World!")
+	setPayloadDigest(record, DigestSHA256)
+	record.Content = strings.NewReader("Goodbye, World")
+	if _, err := writer.WriteRecord(record); err != nil {
+		t.Fatalf("failed to write record: %v", err)
+	}
+
+	if !strings.HasPrefix(record.Header.Get("WARC-Block-Digest"), "sha256:") {
+		t.Errorf("expected a sha256 block digest, got %s", record.Header.Get("WARC-Block-Digest"))
+	}
+
+	path := filepath.Join(directory, "test.warc")
+	if err := ioutil.WriteFile(path, output.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write WARC file: %v", err)
+	}
+
+	invalid, err := ValidateFile(path)
+	if err != nil {
+		t.Fatalf("failed to validate WARC file: %v", err)
+	}
+
+	if len(invalid) != 1 || len(invalid[0].Problems) != 1 || !strings.Contains(invalid[0].Problems[0], "WARC-Payload-Digest") {
+		t.Errorf("expected a payload digest problem, got %+v", invalid)
+	}
+}
+
+// Tests that records aren't written with an unsupported digest algorithm
+func TestWriterUnsupportedDigestAlgorithm(t *testing.T) {
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	writer.DigestAlgorithm = "crc32"
+
+	record := NewRecord()
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Content = strings.NewReader("Hello, World!")
+	if _, err := writer.WriteRecord(record); err == nil {
+		t.Errorf("expected an unsupported digest algorithm error")
+	}
+
+	writer.FileWriter.Flush()
+	if output.Len() != 0 {
+		t.Errorf("expected nothing written, got %q", output.String())
+	}
+}
+
+// Tests that the records digested with a registered
+// algorithm are valid, even with StrictSpec
+func TestWriterRegisteredDigestAlgorithm(t *testing.T) {
+	if err := RegisterDigestAlgorithm("sha384", sha512.New384); err != nil {
+		t.Fatalf("failed to register digest algorithm: %v", err)
+	}
+
+	writer, err := NewWriter(new(bytes.Buffer), "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	writer.DigestAlgorithm = "sha384"
+	writer.StrictSpec = true
+
+	record := NewRecord()
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Content = strings.NewReader("Hello, World!")
+	if _, err := writer.WriteRecord(record); err != nil {
+		t.Fatalf("expected the record to be written, got %v", err)
+	}
+
+	if digest := record.Header.Get("WARC-Block-Digest"); !strings.HasPrefix(digest, "sha384:") {
+		t.Errorf("expected a sha384 block digest, got %s", digest)
+	}
+
+	// A record written with the registered algorithm validates
+	if err := record.Validate(); err != nil {
+		t.Errorf("expected a valid record, got %v", err)
+	}
+}
+
+// Tests that the rotator doesn't start with an unsupported digest algorithm
+func TestRotatorUnsupportedDigestAlgorithm(t *testing.T) {
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = os.TempDir()
+	rotatorSettings.DigestAlgorithm = "crc32"
+
+	if _, _, err := rotatorSettings.NewWARCRotator(); err == nil {
+		t.Errorf("expected an unsupported digest algorithm error")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package warc
+
+// diskFreeSpace isn't supported on this platform
+func diskFreeSpace(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,153 @@
+package warc
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// DigestLocation is a record found by BuildDigestManifest
+type DigestLocation struct {
+	RecordLocation
+	Collection string
+	TargetURI  string
+	// Size is the Content-Length of the record
+	Size int64
+}
+
+// DigestManifest maps the payload digests of the records
+// of many collections to the records having them
+type DigestManifest struct {
+	Locations map[string][]DigestLocation
+}
+
+// CollectionPair is a pair of collections, A sorting before B
+type CollectionPair struct {
+	A, B string
+}
+
+// DuplicationStats are the duplication statistics of a DigestManifest
+type DuplicationStats struct {
+	// Records is the number of records with a payload
+	Records int
+	// UniqueDigests is the number of distinct payload digests
+	UniqueDigests int
+	// DuplicateRecords is the number of records whose payload
+	// was already stored by another record
+	DuplicateRecords int
+	// DuplicateBytes is the size of the duplicate records
+	DuplicateBytes int64
+	// CrossCollectionDigests is the number of payload digests
+	// stored in more than one collection
+	CrossCollectionDigests int
+	// SharedDigests is the number of payload digests
+	// stored by each pair of collections
+	SharedDigests map[CollectionPair]int
+}
+
+// BuildDigestManifest reads the response and resource records of the WARC
+// files of each collection, given as a map of collection names to paths,
+// and returns the manifest of their payload digests. Records without a
+// WARC-Payload-Digest get their SHA1 payload digest computed.
+func BuildDigestManifest(collections map[string][]string) (*DigestManifest, error) {
+	manifest := &DigestManifest{Locations: make(map[string][]DigestLocation)}
+
+	for collection, paths := range collections {
+		for _, path := range paths {
+			if err := manifest.addFile(collection, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return manifest, nil
+}
+
+func (m *DigestManifest) addFile(collection string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.ReadRecord(true)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		warcType := record.Header.Get("WARC-Type")
+		if warcType != "response" && warcType != "resource" {
+			os.Remove(record.PayloadPath)
+			continue
+		}
+
+		digest := record.Header.Get("WARC-Payload-Digest")
+		if digest == "" {
+			digests, err := record.PayloadDigests()
+			if err != nil {
+				os.Remove(record.PayloadPath)
+				return err
+			}
+			digest = digests.Payload
+		}
+		os.Remove(record.PayloadPath)
+
+		size, _ := strconv.ParseInt(record.Header.Get("Content-Length"), 10, 64)
+
+		m.Locations[digest] = append(m.Locations[digest], DigestLocation{
+			RecordLocation: RecordLocation{Path: path, Offset: reader.RecordOffset()},
+			Collection:     collection,
+			TargetURI:      record.Header.Get("WARC-Target-URI"),
+			Size:           size,
+		})
+	}
+}
+
+// Stats returns the duplication statistics of the manifest
+func (m *DigestManifest) Stats() DuplicationStats {
+	stats := DuplicationStats{
+		UniqueDigests: len(m.Locations),
+		SharedDigests: make(map[CollectionPair]int),
+	}
+
+	for _, locations := range m.Locations {
+		stats.Records += len(locations)
+		stats.DuplicateRecords += len(locations) - 1
+		for _, location := range locations[1:] {
+			stats.DuplicateBytes += location.Size
+		}
+
+		var collections []string
+		seen := make(map[string]bool)
+		for _, location := range locations {
+			if !seen[location.Collection] {
+				seen[location.Collection] = true
+				collections = append(collections, location.Collection)
+			}
+		}
+		sort.Strings(collections)
+
+		if len(collections) > 1 {
+			stats.CrossCollectionDigests++
+		}
+
+		for i := range collections {
+			for j := i + 1; j < len(collections); j++ {
+				stats.SharedDigests[CollectionPair{A: collections[i], B: collections[j]}]++
+			}
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,33 @@
+package warc
+
+import "testing"
+
+// Tests for the BuildDigestManifest function
+func TestBuildDigestManifest(t *testing.T) {
+	manifest, err := BuildDigestManifest(map[string][]string{
+		"first":  {"testdata/test.warc.gz"},
+		"second": {"testdata/test.warc.gz"},
+	})
+	if err != nil {
+		t.Fatalf("failed to build digest manifest: %v", err)
+	}
+
+	stats := manifest.Stats()
+
+	// The test file has 9 responses
+	if stats.Records != 18 {
+		t.Errorf("expected 18 records, got %d", stats.Records)
+	}
+
+	if stats.DuplicateRecords != stats.Records-stats.UniqueDigests {
+		t.Errorf("expected %d duplicate records, got %d", stats.Records-stats.UniqueDigests, stats.DuplicateRecords)
+	}
+
+	if stats.CrossCollectionDigests != stats.UniqueDigests {
+		t.Errorf("expected all %d digests to be in both collections, got %d", stats.UniqueDigests, stats.CrossCollectionDigests)
+	}
+
+	if shared := stats.SharedDigests[CollectionPair{A: "first", B: "second"}]; shared != stats.UniqueDigests {
+		t.Errorf("expected %d shared digests, got %d", stats.UniqueDigests, shared)
+	}
+}
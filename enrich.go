@@ -0,0 +1,81 @@
+package warc
+
+import (
+	"strings"
+	"sync"
+)
+
+// EnrichmentPolicy selects the captures to enrich, e.g. with screenshots,
+// DOM snapshots or text extraction, so that the cost of enrichment stays
+// proportional to a sample of the crawl. Enrich is called by the rotator
+// for each response and resource record, in the order they are written,
+// before their content is consumed.
+type EnrichmentPolicy interface {
+	Enrich(record *Record) bool
+}
+
+// EnrichmentPolicyFunc is an EnrichmentPolicy calling a function
+type EnrichmentPolicyFunc func(record *Record) bool
+
+// Enrich implements EnrichmentPolicy
+func (f EnrichmentPolicyFunc) Enrich(record *Record) bool {
+	return f(record)
+}
+
+// SamplingPolicy is an EnrichmentPolicy selecting one capture out of
+// Every among the ones matching its rules. The captures are counted,
+// rather than sampled in time, so that the same crawl is enriched the
+// same way whatever its speed.
+type SamplingPolicy struct {
+	// Filter, if set, selects the captures that can be enriched, e.g.
+	// compiled from `mime="text/html" and status=200`, see CompileFilter
+	Filter RecordFilter
+	// Seeds, if set, restricts the captures that can be enriched to the
+	// ones of these URLs, compared by their SURT
+	Seeds []string
+	// Every is the number of matching captures for one to be enriched,
+	// starting with the first one, all of them are enriched if it is
+	// lower than 2
+	Every int
+
+	mu      sync.Mutex
+	matched int
+	seeds   map[string]bool
+}
+
+// Enrich implements EnrichmentPolicy
+func (p *SamplingPolicy) Enrich(record *Record) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.Seeds) > 0 {
+		if p.seeds == nil {
+			p.seeds = make(map[string]bool, len(p.Seeds))
+			for _, seed := range p.Seeds {
+				p.seeds[seedKey(seed)] = true
+			}
+		}
+
+		if !p.seeds[seedKey(record.Header.Get("WARC-Target-URI"))] {
+			return false
+		}
+	}
+
+	if p.Filter != nil && !p.Filter(record) {
+		return false
+	}
+
+	p.matched++
+	return p.Every < 2 || (p.matched-1)%p.Every == 0
+}
+
+// seedKey returns the SURT of a seed URL,
+// or the URL itself if it can't be parsed
+func seedKey(targetURI string) string {
+	targetURI = strings.TrimSuffix(strings.TrimPrefix(targetURI, "<"), ">")
+
+	if key, err := SURT(targetURI); err == nil {
+		return key
+	}
+	return targetURI
+}
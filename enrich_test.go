@@ -0,0 +1,107 @@
+package warc
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the SamplingPolicy rules
+func TestSamplingPolicy(t *testing.T) {
+	filter, err := CompileFilter(`mime="text/html"`)
+	if err != nil {
+		t.Fatalf("failed to compile filter: %v", err)
+	}
+
+	newCapture := func(url, mediaType string) *Record {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", url)
+		record.Header.Set("Content-Type", "application/http; msgtype=response")
+		record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: " + mediaType + "\r\n\r\n")
+		return record
+	}
+
+	// Every other HTML page
+	policy := &SamplingPolicy{Filter: filter, Every: 2}
+	var enriched []bool
+	for _, capture := range []struct {
+		url       string
+		mediaType string
+	}{
+		{"http://example.com/1", "text/html"},
+		{"http://example.com/style.css", "text/css"},
+		{"http://example.com/2", "text/html; charset=utf-8"},
+		{"http://example.com/3", "text/html"},
+		{"http://example.com/4", "text/html"},
+	} {
+		enriched = append(enriched, policy.Enrich(newCapture(capture.url, capture.mediaType)))
+	}
+
+	expected := []bool{true, false, false, true, false}
+	for i := range expected {
+		if enriched[i] != expected[i] {
+			t.Errorf("capture %d: expected %v, got %v", i, expected[i], enriched[i])
+		}
+	}
+
+	// Only seeds, whatever the form of their URL
+	policy = &SamplingPolicy{Seeds: []string{"http://www.Example.com/"}}
+	if !policy.Enrich(newCapture("http://example.com/", "text/html")) {
+		t.Errorf("expected the seed to be enriched")
+	}
+	if policy.Enrich(newCapture("http://example.com/other", "text/html")) {
+		t.Errorf("expected a page other than the seed not to be enriched")
+	}
+}
+
+// Tests that the rotator only enriches the captures
+// selected by its EnrichmentPolicy
+func TestRotatorEnrichmentPolicy(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	var hooked []string
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.EnrichmentPolicy = &SamplingPolicy{Every: 3}
+	rotatorSettings.EnrichmentHook = func(record *Record) {
+		if record.Header.Get("WARC-Record-ID") == "" {
+			t.Errorf("expected the record ID to be set")
+		}
+		hooked = append(hooked, record.Header.Get("WARC-Target-URI"))
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	batch := NewRecordBatch()
+	for _, url := range []string{"http://example.com/1", "http://example.com/2", "http://example.com/3", "http://example.com/4"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", url)
+		record.Content = strings.NewReader("Hello, World!")
+		batch.Records = append(batch.Records, record)
+	}
+
+	// Records other than captures are never enriched
+	metadata := NewRecord()
+	metadata.Header.Set("WARC-Type", "metadata")
+	metadata.Header.Set("WARC-Target-URI", "http://example.com/1")
+	metadata.Content = strings.NewReader("via: http://example.com/")
+	batch.Records = append(batch.Records, metadata)
+
+	records <- batch
+	close(records)
+	<-done
+
+	if len(hooked) != 2 || hooked[0] != "http://example.com/1" || hooked[1] != "http://example.com/4" {
+		t.Errorf("expected the first and fourth captures to be enriched, got %v", hooked)
+	}
+}
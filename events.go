@@ -0,0 +1,108 @@
+package warc
+
+import (
+	"sync"
+	"time"
+)
+
+// RotatorEventType is the type of a RotatorEvent
+type RotatorEventType int
+
+// Types of the events emitted by the rotator
+const (
+	// FileOpened is emitted once a new WARC file has been created
+	// and its warcinfo record written
+	FileOpened RotatorEventType = iota
+	// FileClosed is emitted once a WARC file has been closed
+	// and moved to its final path
+	FileClosed
+	// RotationTriggered is emitted when the current WARC file is
+	// about to be closed for a new one to be opened
+	RotationTriggered
+	// WriteError is emitted when the rotator fails to write
+	WriteError
+	// Backpressure is emitted when writing a batch took longer than
+	// backpressureThreshold, blocking the senders of the next batches
+	Backpressure
+	// AnomalyDetected is emitted when the AnomalyDetector
+	// finds an anomalous capture pattern
+	AnomalyDetected
+)
+
+// backpressureThreshold is the time a batch can take to be
+// written before a Backpressure event is emitted
+const backpressureThreshold = time.Second
+
+// eventsBufferSize is the number of events kept when nobody
+// is receiving from the events channel
+const eventsBufferSize = 64
+
+// RotatorEvent is an event emitted by the rotator
+type RotatorEvent struct {
+	Type RotatorEventType
+	Time time.Time
+	// Path of the WARC file the event is about
+	Path string
+	// Reason of a RotationTriggered event
+	Reason string
+	// Err is the error of a WriteError event
+	Err error
+	// Duration is the time the batch took to be
+	// written, for a Backpressure event
+	Duration time.Duration
+	// Anomaly is the anomaly of an AnomalyDetected event
+	Anomaly *Anomaly
+}
+
+// rotatorEvents is the events channel of a rotator
+type rotatorEvents struct {
+	once   sync.Once
+	events chan RotatorEvent
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (e *rotatorEvents) channel() chan RotatorEvent {
+	e.once.Do(func() {
+		e.events = make(chan RotatorEvent, eventsBufferSize)
+	})
+	return e.events
+}
+
+// close closes the events channel, the events emitted afterwards are dropped
+func (e *rotatorEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.closed {
+		e.closed = true
+		close(e.channel())
+	}
+}
+
+// Events returns a channel receiving the events of the last rotator started
+// with the settings, or of the next one if none was started yet, so that
+// they can be reacted to without polling the file system. Events are
+// dropped rather than blocking the rotator when the channel is full. The
+// channel is closed once the rotator stopped, after its channel is closed.
+func (s *RotatorSettings) Events() <-chan RotatorEvent {
+	return s.currentRotator().events.channel()
+}
+
+// emit sends an event on the events channel, without blocking
+func (r *rotatorState) emit(event RotatorEvent) {
+	event.Time = time.Now()
+
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	if r.events.closed {
+		return
+	}
+
+	select {
+	case r.events.channel() <- event:
+	default:
+	}
+}
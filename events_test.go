@@ -0,0 +1,58 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Tests that the events channel is closed once the rotator stopped,
+// so that ranging over it terminates
+func TestRotatorEventsClosed(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	received := make(chan []RotatorEventType)
+	go func() {
+		var types []RotatorEventType
+		for event := range rotatorSettings.Events() {
+			types = append(types, event.Type)
+		}
+		received <- types
+	}()
+
+	record := NewRecord()
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	select {
+	case types := <-received:
+		if len(types) != 2 || types[0] != FileOpened || types[1] != FileClosed {
+			t.Errorf("expected FileOpened and FileClosed events, got %v", types)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the events channel to be closed")
+	}
+
+	// Events emitted once the channel is closed are dropped
+	rotatorSettings.currentRotator().emit(RotatorEvent{Type: WriteError})
+}
@@ -0,0 +1,219 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TextExtractor extracts the text of record payloads, e.g. to write
+// WET-style conversion records or to feed a search index
+type TextExtractor interface {
+	// ExtractText returns the text of a payload of the given media type,
+	// ok is false if the extractor doesn't support the media type
+	ExtractText(mediaType string, payload io.Reader) (text string, ok bool, err error)
+}
+
+// whitespaces matches the runs of whitespaces collapsed in extracted texts
+var whitespaces = regexp.MustCompile(`\s+`)
+
+// HTMLExtractor is a TextExtractor extracting the
+// text of HTML and plain text payloads
+type HTMLExtractor struct{}
+
+// ExtractText implements TextExtractor
+func (HTMLExtractor) ExtractText(mediaType string, payload io.Reader) (string, bool, error) {
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/plain":
+	default:
+		return "", false, nil
+	}
+
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return "", false, err
+	}
+
+	if mediaType != "text/plain" {
+		data = htmlMarkup.ReplaceAll(data, []byte(" "))
+	}
+
+	text := html.UnescapeString(string(data))
+	return strings.TrimSpace(whitespaces.ReplaceAllString(text, " ")), true, nil
+}
+
+// CommandExtractor is a TextExtractor running an external command, e.g.
+// pdftotext, with the payload on its standard input and reading the text
+// from its standard output
+type CommandExtractor struct {
+	// MediaTypes supported by the command
+	MediaTypes []string
+	// Command and its arguments, e.g. []string{"pdftotext", "-", "-"}
+	Command []string
+}
+
+// ExtractText implements TextExtractor
+func (c *CommandExtractor) ExtractText(mediaType string, payload io.Reader) (string, bool, error) {
+	supported := false
+	for _, supportedType := range c.MediaTypes {
+		if supportedType == mediaType {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return "", false, nil
+	}
+
+	if len(c.Command) == 0 {
+		return "", false, errors.New("CommandExtractor has no command")
+	}
+
+	cmd := exec.Command(c.Command[0], c.Command[1:]...)
+	cmd.Stdin = payload
+
+	output := new(bytes.Buffer)
+	cmd.Stdout = output
+
+	if err := cmd.Run(); err != nil {
+		return "", false, err
+	}
+
+	return output.String(), true, nil
+}
+
+// MultiExtractor is a TextExtractor using the
+// first of its extractors supporting a media type
+type MultiExtractor []TextExtractor
+
+// ExtractText implements TextExtractor
+func (m MultiExtractor) ExtractText(mediaType string, payload io.Reader) (string, bool, error) {
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, extractor := range m {
+		text, ok, err := extractor.ExtractText(mediaType, bytes.NewReader(data))
+		if err != nil || ok {
+			return text, ok, err
+		}
+	}
+
+	return "", false, nil
+}
+
+// ExtractText extracts the text of the payload of a response or resource
+// record with extractor. ok is false if the payload can't be extracted.
+// The record content can still be read from the start afterwards.
+func (r *Record) ExtractText(extractor TextExtractor) (text string, ok bool, err error) {
+	mediaType, payload, err := r.decodedPayload()
+	if err != nil || payload == nil {
+		return "", false, err
+	}
+	defer payload.Close()
+
+	return extractor.ExtractText(mediaType, payload)
+}
+
+// NewConversionRecord returns a WET-style conversion record
+// storing the text extracted from record
+func NewConversionRecord(record *Record, text string) *Record {
+	conversion := NewRecord()
+	conversion.Header.Set("WARC-Type", "conversion")
+	conversion.Header.Set("WARC-Target-URI", record.Header.Get("WARC-Target-URI"))
+	conversion.Header.Set("WARC-Refers-To", record.Header.Get("WARC-Record-ID"))
+	conversion.Header.Set("Content-Type", "text/plain")
+	if date := record.Header.Get("WARC-Date"); date != "" {
+		conversion.Header.Set("WARC-Date", date)
+	}
+	conversion.Content = strings.NewReader(text)
+
+	return conversion
+}
+
+// TextSink receives the text extracted from a record
+type TextSink func(record *Record, text string) error
+
+// ExtractionPool extracts the text of records in a bounded pool of
+// workers, decoupled from the writing of the records
+type ExtractionPool struct {
+	extractor TextExtractor
+	sink      TextSink
+	records   chan *Record
+	wg        sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewExtractionPool starts workers goroutines extracting the text of the
+// records submitted to the pool and passing it to sink, queueSize records
+// waiting at most to be extracted.
+func NewExtractionPool(extractor TextExtractor, workers int, queueSize int, sink TextSink) *ExtractionPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &ExtractionPool{
+		extractor: extractor,
+		sink:      sink,
+		records:   make(chan *Record, queueSize),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *ExtractionPool) work() {
+	defer p.wg.Done()
+
+	for record := range p.records {
+		text, ok, err := record.ExtractText(p.extractor)
+		if err == nil && ok {
+			err = p.sink(record, text)
+		}
+
+		if err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Submit queues a record for extraction, the record must not be used by
+// the caller anymore, use Record.Clone beforehand if needed. Submit doesn't
+// block: it returns false if the queue is full and the record is skipped.
+func (p *ExtractionPool) Submit(record *Record) bool {
+	select {
+	case p.records <- record:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close waits for the queued records to be extracted, and returns
+// the first error returned by the extractor or the sink, if any.
+func (p *ExtractionPool) Close() error {
+	close(p.records)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
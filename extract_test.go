@@ -0,0 +1,71 @@
+package warc
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Tests for the HTMLExtractor type
+func TestHTMLExtractor(t *testing.T) {
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" +
+		"<html><script>var a = 1;</script><body><h1>Hello,</h1>\n<p>World &amp; all!</p></body></html>")
+
+	text, ok, err := record.ExtractText(HTMLExtractor{})
+	if err != nil || !ok {
+		t.Fatalf("expected text, got %v, %v", ok, err)
+	}
+
+	if text != "Hello, World & all!" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+// Tests for the ExtractionPool type
+func TestExtractionPool(t *testing.T) {
+	var mu sync.Mutex
+	var conversions []*Record
+
+	pool := NewExtractionPool(MultiExtractor{
+		&CommandExtractor{MediaTypes: []string{"application/x-test"}, Command: []string{"tr", "a-z", "A-Z"}},
+		HTMLExtractor{},
+	}, 2, 10, func(record *Record, text string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conversions = append(conversions, NewConversionRecord(record, text))
+		return nil
+	})
+
+	for _, contentType := range []string{"text/plain", "application/x-test", "image/gif"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("Content-Type", contentType)
+		record.Content = strings.NewReader("hello")
+
+		if !pool.Submit(record) {
+			t.Fatal("expected the record to be queued")
+		}
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+
+	texts := map[string]bool{}
+	for _, conversion := range conversions {
+		if conversion.Header.Get("WARC-Type") != "conversion" {
+			t.Errorf("expected a conversion record, got %s", conversion.Header.Get("WARC-Type"))
+		}
+		text := new(strings.Builder)
+		buf := make([]byte, 64)
+		n, _ := conversion.Content.Read(buf)
+		text.Write(buf[:n])
+		texts[text.String()] = true
+	}
+
+	if len(conversions) != 2 || !texts["hello"] || !texts["HELLO"] {
+		t.Errorf("unexpected extracted texts %v", texts)
+	}
+}
@@ -0,0 +1,77 @@
+package warc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// RotatorShutdownError is the error a rotator was shut down with by its
+// failure policy, see RotatorSettings.FailAfter and FailOnDiskFull. The
+// rotator never panics on write failures: it shuts down instead, its
+// done channel receiving false.
+type RotatorShutdownError struct {
+	// Failures is the number of consecutive batches that failed
+	Failures int
+	// Err is the last error
+	Err error
+}
+
+func (e *RotatorShutdownError) Error() string {
+	return "Rotator shut down after " + strconv.Itoa(e.Failures) + " consecutive write failures: " + e.Err.Error()
+}
+
+func (e *RotatorShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// rotatorFailures tracks the consecutive failures of a rotator
+type rotatorFailures struct {
+	mu          sync.Mutex
+	consecutive int
+	err         error
+}
+
+// Err returns the *RotatorShutdownError the rotator was shut
+// down with by its failure policy, nil if it wasn't
+func (s *RotatorSettings) Err() error {
+	return s.currentRotator().failures.get()
+}
+
+// get returns the error the rotator was shut down with
+func (f *rotatorFailures) get() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// recordFailure applies the failure policy to a failed batch,
+// returning true if the rotator must shut down
+func (r *rotatorState) recordFailure(err error) bool {
+	r.failures.mu.Lock()
+	defer r.failures.mu.Unlock()
+
+	r.failures.consecutive++
+
+	if (r.settings.FailOnDiskFull && isDiskFull(err)) || r.failures.consecutive >= r.settings.FailAfter {
+		r.failures.err = &RotatorShutdownError{Failures: r.failures.consecutive, Err: err}
+		return true
+	}
+
+	return false
+}
+
+// recordSuccess resets the count of consecutive failures
+func (r *rotatorState) recordSuccess() {
+	r.failures.mu.Lock()
+	defer r.failures.mu.Unlock()
+
+	r.failures.consecutive = 0
+}
+
+// isDiskFull returns true if err is caused by a full disk
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
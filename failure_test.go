@@ -0,0 +1,331 @@
+package warc
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingReader is a record content failing to be read with its error
+type failingReader struct {
+	err error
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+// sendPayloads sends a batch per payload to the rotator, and returns the
+// values received on their Done channels. The content of the records
+// whose payload is the message of failure fails to be read with it.
+func sendPayloads(records chan *RecordBatch, payloads []string, failure error) []bool {
+	var written []bool
+
+	for _, payload := range payloads {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader(payload)
+		if payload == failure.Error() {
+			record.Content = failingReader{err: failure}
+		}
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool)
+
+		records <- batch
+		written = append(written, <-batch.Done)
+	}
+
+	return written
+}
+
+// Tests for the RotatorSettings.FailAfter policy
+func TestRotatorFailAfter(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FailAfter = 2
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	written := sendPayloads(records, []string{"ok", "fail", "ok", "fail", "fail", "ok"}, errors.New("fail"))
+
+	for i, expected := range []bool{true, false, true, false, false, false} {
+		if written[i] != expected {
+			t.Errorf("expected batch %d written: %v, got %v", i, expected, written[i])
+		}
+	}
+
+	close(records)
+	<-done
+
+	var shutdownErr *RotatorShutdownError
+	if !errors.As(rotatorSettings.Err(), &shutdownErr) || shutdownErr.Failures != 2 {
+		t.Fatalf("expected a shutdown after 2 failures, got %v", rotatorSettings.Err())
+	}
+
+	// A new file is opened for the batch following each failure
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 3 {
+		t.Errorf("expected 3 WARC files, got %v, %v", paths, err)
+	}
+}
+
+// Tests for the RotatorSettings.FailOnDiskFull policy
+func TestRotatorFailOnDiskFull(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FailOnDiskFull = true
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	full := &os.PathError{Op: "write", Path: "full", Err: syscall.ENOSPC}
+	written := sendPayloads(records, []string{"ok", full.Error(), "ok"}, full)
+
+	close(records)
+	<-done
+
+	if !written[0] || written[1] || written[2] {
+		t.Errorf("expected the batches after the disk is full to be dropped, got %v", written)
+	}
+
+	if !errors.Is(rotatorSettings.Err(), syscall.ENOSPC) {
+		t.Errorf("expected a shutdown because of the full disk, got %v", rotatorSettings.Err())
+	}
+}
+
+// Tests that without failure policy, the rotator shuts
+// down on the first failure instead of panicking
+func TestRotatorShutdownWithoutPolicy(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	written := sendPayloads(records, []string{"ok", "fail", "ok"}, errors.New("fail"))
+	if !written[0] || written[1] || written[2] {
+		t.Errorf("expected only the first batch to be written, got %v", written)
+	}
+
+	close(records)
+	if <-done {
+		t.Error("expected the done channel to receive false")
+	}
+
+	var shutdownErr *RotatorShutdownError
+	if !errors.As(rotatorSettings.Err(), &shutdownErr) || shutdownErr.Failures != 1 || shutdownErr.Err.Error() != "fail" {
+		t.Errorf("unexpected error %v", rotatorSettings.Err())
+	}
+}
+
+// queueBatches sends a batch per target URI to the rotator back to back,
+// without waiting for them to be written, and returns the values received
+// on their Done channels. A batch is still pending when the next one is
+// written if writing it takes longer than queueing the next one.
+func queueBatches(records chan *RecordBatch, targetURIs []string) []bool {
+	batches := make([]*RecordBatch, len(targetURIs))
+	for i, targetURI := range targetURIs {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", targetURI)
+		record.Content = strings.NewReader("Hello, World!")
+
+		batches[i] = NewRecordBatch()
+		batches[i].Records = append(batches[i].Records, record)
+		batches[i].Done = make(chan bool, 1)
+	}
+
+	for _, batch := range batches {
+		records <- batch
+	}
+
+	var written []bool
+	for _, batch := range batches {
+		written = append(written, <-batch.Done)
+	}
+
+	return written
+}
+
+// Tests that the rotator doesn't crash when the file can't be opened
+// after a rotation while a batch is pending, see CoalesceLatency
+func TestRotatorRotationFailureWithPendingBatch(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	spilloverDirectory, err := ioutil.TempDir("", "warc-spillover-*")
+	if err != nil {
+		t.Fatalf("failed to create spillover directory: %v", err)
+	}
+	defer os.RemoveAll(spilloverDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.SpilloverDirectories = []string{spilloverDirectory}
+	rotatorSettings.DirectoryQuota = 0.000001
+	rotatorSettings.CoalesceLatency = time.Hour
+
+	// While the first batch is written, the next file is made impossible
+	// to create and a rotation is requested for the second batch
+	var once sync.Once
+	rotatorSettings.EnrichmentHook = func(record *Record) {
+		once.Do(func() {
+			os.RemoveAll(spilloverDirectory)
+			rotatorSettings.SetWarcinfoContent(Header{"operator": "night shift"})
+			time.Sleep(100 * time.Millisecond)
+		})
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	written := queueBatches(records, []string{"http://example.com/a", "http://example.com/b"})
+	if !written[0] || written[1] {
+		t.Errorf("expected only the batch before the rotation to be written, got %v", written)
+	}
+
+	close(records)
+	<-done
+
+	if rotatorSettings.Err() == nil {
+		t.Error("expected the rotator to shut down")
+	}
+}
+
+// Tests that the records of a failed batch written before the failure are
+// dropped from the file and from the Dedup store, so that the batch can be
+// sent again without duplicating them
+func TestRotatorFailedBatchDropped(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	store := NewMemoryDedupStore()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.Dedup = store
+	rotatorSettings.FailAfter = 2
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	send := func(fail bool) bool {
+		batch := NewRecordBatch()
+		batch.Done = make(chan bool)
+
+		for _, targetURI := range []string{"http://example.com/a", "http://example.com/b"} {
+			record := NewRecord()
+			record.Header.Set("WARC-Type", "response")
+			record.Header.Set("WARC-Target-URI", targetURI)
+			record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\n" + targetURI)
+			if fail && targetURI == "http://example.com/b" {
+				record.Content = failingReader{err: errors.New("fail")}
+			}
+			batch.Records = append(batch.Records, record)
+		}
+
+		records <- batch
+		return <-batch.Done
+	}
+
+	if send(true) {
+		t.Fatal("expected the failing batch not to be written")
+	}
+	if store.Len() != 0 {
+		t.Errorf("expected no digest of the failed batch in the store, got %d", store.Len())
+	}
+
+	// The batch is sent again
+	if !send(false) {
+		t.Fatal("expected the batch sent again to be written")
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("expected 2 WARC files, got %v, %v", paths, err)
+	}
+
+	written := make(map[string]string)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open WARC file: %v", err)
+		}
+
+		reader, err := NewReader(file)
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+
+		for {
+			record, err := reader.ReadRecord(false)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read record of %s: %v", path, err)
+			}
+
+			if targetURI := record.Header.Get("WARC-Target-URI"); targetURI != "" {
+				written[targetURI] += record.Header.Get("WARC-Type") + " "
+			}
+		}
+
+		reader.Close()
+		file.Close()
+	}
+
+	for _, targetURI := range []string{"http://example.com/a", "http://example.com/b"} {
+		if written[targetURI] != "response " {
+			t.Errorf("expected a single response record for %s, got %q", targetURI, written[targetURI])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package warc
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ParseWarcFields parses an application/warc-fields block, as found in
+// warcinfo and metadata records. Continuation lines (starting with a space
+// or a tab) are appended to the value of the previous field, lines that
+// aren't valid fields are ignored.
+func ParseWarcFields(reader io.Reader) (Header, error) {
+	fields := NewHeader()
+	scanner := bufio.NewScanner(reader)
+	lastKey := ""
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		// Continuation of the previous field's value
+		if (line[0] == ' ' || line[0] == '\t') && lastKey != "" {
+			fields.Set(lastKey, fields.Get(lastKey)+" "+strings.TrimSpace(line))
+			continue
+		}
+
+		key, value := splitKeyValue(line)
+		if key == "" {
+			lastKey = ""
+			continue
+		}
+		fields.Set(key, value)
+		lastKey = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// WriteWarcFields serializes fields as an application/warc-fields block,
+// sorted by field name. Multi-line values are written as continuation lines.
+func WriteWarcFields(writer io.Writer, fields Header) error {
+	for _, key := range fields.Keys() {
+		value := strings.Replace(fields[key], "\r\n", "\n", -1)
+		value = strings.Replace(value, "\n", "\r\n ", -1)
+
+		if _, err := io.WriteString(writer, key+": "+value+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package warc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Tests for the ParseWarcFields function
+func TestParseWarcFields(t *testing.T) {
+	block := "software: Zeno\r\ndescription: a multi-line\r\n  description\r\nnot a field\r\nhttp-header-user-agent: Mozilla/5.0 (é)\r\n"
+
+	fields, err := ParseWarcFields(strings.NewReader(block))
+	if err != nil {
+		t.Fatalf("failed to parse warc-fields: %v", err)
+	}
+
+	expected := map[string]string{
+		"software":               "Zeno",
+		"description":            "a multi-line description",
+		"http-header-user-agent": "Mozilla/5.0 (é)",
+	}
+
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d fields, got %d", len(expected), len(fields))
+	}
+
+	for key, value := range expected {
+		if fields.Get(key) != value {
+			t.Errorf("expected %q = %q, got %q", key, value, fields.Get(key))
+		}
+	}
+}
+
+// Tests for the WriteWarcFields function
+func TestWriteWarcFields(t *testing.T) {
+	fields := NewHeader()
+	fields.Set("software", "Zeno")
+	fields.Set("description", "first line\nsecond line")
+
+	buffer := new(bytes.Buffer)
+	if err := WriteWarcFields(buffer, fields); err != nil {
+		t.Fatalf("failed to write warc-fields: %v", err)
+	}
+
+	expected := "description: first line\r\n second line\r\nsoftware: Zeno\r\n"
+	if buffer.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buffer.String())
+	}
+
+	parsed, err := ParseWarcFields(buffer)
+	if err != nil {
+		t.Fatalf("failed to parse warc-fields: %v", err)
+	}
+
+	if parsed.Get("description") != "first line second line" {
+		t.Errorf("unexpected round-tripped description %q", parsed.Get("description"))
+	}
+}
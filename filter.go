@@ -0,0 +1,331 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RecordFilter returns true for the records to keep
+type RecordFilter func(record *Record) bool
+
+// CompileFilter compiles a filter expression into a RecordFilter, e.g.
+//
+//	type=response and status=200 and mime~"text/html" and url~"example.com"
+//
+// A comparison is a field, an operator and a value. The operators are
+// = and != for equality, ~ and !~ for regular expression matching, and
+// <, <=, > and >= for numbers. The fields are:
+//
+//	type    the WARC-Type
+//	url     the WARC-Target-URI
+//	status  the HTTP status code, 0 for records other than responses
+//	mime    the media type of the HTTP response, or of the record block
+//	length  the Content-Length
+//	date    the WARC-Date
+//
+// any other field being a header field of the record, e.g. WARC-Record-ID.
+// Values can be quoted with double quotes. Comparisons are combined with
+// and, or and not, and grouped with parentheses.
+func CompileFilter(expression string) (RecordFilter, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.position < len(p.tokens) {
+		return nil, errors.New("Unexpected " + p.tokens[p.position].value + " in filter: " + expression)
+	}
+
+	return filter, nil
+}
+
+// filterToken is a token of a filter expression
+type filterToken struct {
+	value  string
+	quoted bool
+}
+
+// filterOperators are the comparison operators, the
+// two characters ones first so that they match first
+var filterOperators = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+func tokenizeFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{value: string(c)})
+			i++
+		case c == '"':
+			value, length, err := unquoteFilterValue(expression[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{value: value, quoted: true})
+			i += length
+		default:
+			operator := ""
+			for _, op := range filterOperators {
+				if strings.HasPrefix(expression[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator != "" {
+				tokens = append(tokens, filterToken{value: operator})
+				i += len(operator)
+				continue
+			}
+
+			start := i
+			for i < len(expression) && !strings.ContainsRune(" \t\r\n()\"=!~<>", rune(expression[i])) {
+				i++
+			}
+			if start == i {
+				return nil, errors.New("Unexpected character in filter: " + string(c))
+			}
+			tokens = append(tokens, filterToken{value: expression[start:i]})
+		}
+	}
+
+	return tokens, nil
+}
+
+// unquoteFilterValue reads the quoted value at the start of s,
+// returning it with the number of characters it spans
+func unquoteFilterValue(s string) (string, int, error) {
+	var value strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, errors.New("Unterminated quoted value in filter: " + s)
+}
+
+// filterParser is a recursive descent parser of filter expressions
+type filterParser struct {
+	tokens   []filterToken
+	position int
+}
+
+// peek returns the next unquoted token, lower-cased, if any
+func (p *filterParser) peek() string {
+	if p.position >= len(p.tokens) || p.tokens[p.position].quoted {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.position].value)
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.position >= len(p.tokens) {
+		return filterToken{}, errors.New("Unexpected end of filter")
+	}
+	p.position++
+	return p.tokens[p.position-1], nil
+}
+
+func (p *filterParser) parseOr() (RecordFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter(left, right)
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (RecordFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.position++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter(left, right)
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (RecordFilter, error) {
+	switch p.peek() {
+	case "not":
+		p.position++
+		filter, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(record *Record) bool { return !filter(record) }, nil
+	case "(":
+		p.position++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("Missing ) in filter")
+		}
+		p.position++
+		return filter, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (RecordFilter, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	getter := filterField(strings.ToLower(field.value), field.value)
+
+	switch operator.value {
+	case "=":
+		return func(record *Record) bool { return getter(record) == value.value }, nil
+	case "!=":
+		return func(record *Record) bool { return getter(record) != value.value }, nil
+	case "~", "!~":
+		pattern, err := regexp.Compile(value.value)
+		if err != nil {
+			return nil, err
+		}
+		match := operator.value == "~"
+		return func(record *Record) bool { return pattern.MatchString(getter(record)) == match }, nil
+	case "<", "<=", ">", ">=":
+		number, err := strconv.ParseFloat(value.value, 64)
+		if err != nil {
+			return nil, errors.New("Expected a number after " + operator.value + " in filter, got " + value.value)
+		}
+		return numberFilter(getter, operator.value, number), nil
+	}
+
+	return nil, errors.New("Expected an operator after " + field.value + " in filter, got " + operator.value)
+}
+
+func andFilter(left, right RecordFilter) RecordFilter {
+	return func(record *Record) bool { return left(record) && right(record) }
+}
+
+func orFilter(left, right RecordFilter) RecordFilter {
+	return func(record *Record) bool { return left(record) || right(record) }
+}
+
+func numberFilter(getter func(*Record) string, operator string, number float64) RecordFilter {
+	return func(record *Record) bool {
+		value, err := strconv.ParseFloat(getter(record), 64)
+		if err != nil {
+			return false
+		}
+
+		switch operator {
+		case "<":
+			return value < number
+		case "<=":
+			return value <= number
+		case ">":
+			return value > number
+		default:
+			return value >= number
+		}
+	}
+}
+
+// filterField returns the function getting the value of a field
+func filterField(field string, name string) func(*Record) string {
+	switch field {
+	case "type":
+		return func(record *Record) string { return record.Header.Get("WARC-Type") }
+	case "url":
+		return func(record *Record) string { return strings.Trim(record.Header.Get("WARC-Target-URI"), "<>") }
+	case "length":
+		return func(record *Record) string { return record.Header.Get("Content-Length") }
+	case "date":
+		return func(record *Record) string { return record.Header.Get("WARC-Date") }
+	case "status":
+		return func(record *Record) string { return strconv.Itoa(recordStatusCode(record)) }
+	case "mime":
+		return recordMediaType
+	}
+
+	return func(record *Record) string { return record.Header.Get(name) }
+}
+
+// recordMediaType returns the media type of the HTTP response stored in a
+// record, or the media type of the record block for other records
+func recordMediaType(record *Record) string {
+	contentType := record.Header.Get("Content-Type")
+
+	if strings.HasPrefix(contentType, "application/http") {
+		contentType = ""
+
+		block, err := record.peek(sniffSize)
+		if err == nil {
+			resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+			if err == nil {
+				contentType = resp.Header.Get("Content-Type")
+				resp.Body.Close()
+			}
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return mediaType
+}
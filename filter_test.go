@@ -0,0 +1,75 @@
+package warc
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// Tests for the CompileFilter function
+func TestCompileFilter(t *testing.T) {
+	for expression, expected := range map[string]int{
+		`type=response`:                                    9,
+		`type=response and status=200`:                     5,
+		`TYPE = response AND NOT status = 200`:             4,
+		`type=response and (status=301 or status>=302)`:    4,
+		`type=response and mime~"^text/html$"`:             7,
+		`type=request and url~"google\.de"`:                1,
+		`type=response and url!~"google" or type=warcinfo`: 2,
+		`WARC-Type=request and Content-Length < 0`:         0,
+		`software="Zeno"`:                                  0,
+		`type=warcinfo and mime="application/warc-fields"`: 1,
+	} {
+		filter, err := CompileFilter(expression)
+		if err != nil {
+			t.Fatalf("failed to compile %q: %v", expression, err)
+		}
+
+		if count := countFiltered(t, filter); count != expected {
+			t.Errorf("expected %d records for %q, got %d", expected, expression, count)
+		}
+	}
+
+	for _, expression := range []string{
+		`type=`,
+		`type response`,
+		`(type=response`,
+		`status>abc`,
+		`url~"["`,
+		`type="response`,
+		`type=response status=200`,
+	} {
+		if _, err := CompileFilter(expression); err == nil {
+			t.Errorf("expected an error for %q", expression)
+		}
+	}
+}
+
+func countFiltered(t *testing.T, filter RecordFilter) int {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	count := 0
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			return count
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		if filter(record) {
+			count++
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package warc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// recordFrameMagic is the magic number of the zstd skippable frames
+// written by MemberWriter before each record frame, zstd reserving
+// 0x184D2A50 to 0x184D2A5F for skippable frames
+const recordFrameMagic = 0x184D2A50
+
+// recordFrameSize is the size of the data of a record frame's skippable
+// frame: the compressed and decompressed sizes of the record frame
+const recordFrameSize = 16
+
+// zstdFrameMagic is the magic number of the zstd frames
+const zstdFrameMagic = 0xFD2FB528
+
+// RecordFrame is the frame of a record in a .warc.zst file
+// written with MemberWriter.SkippableFrames
+type RecordFrame struct {
+	// Offset of the zstd frame of the record in the file, the record
+	// can be read from it like from the offsets of a CDX index
+	Offset int64
+	// CompressedSize is the size of the zstd frame
+	CompressedSize int64
+	// Size is the size of the record once decompressed
+	Size int64
+}
+
+// writeRecordFrame writes the skippable frame describing a record frame,
+// followed by the record frame itself
+func writeRecordFrame(writer io.Writer, frame []byte, size int64) error {
+	header := make([]byte, 8+recordFrameSize)
+	binary.LittleEndian.PutUint32(header[0:], recordFrameMagic)
+	binary.LittleEndian.PutUint32(header[4:], recordFrameSize)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(frame)))
+	binary.LittleEndian.PutUint64(header[16:], uint64(size))
+
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(frame)
+	return err
+}
+
+// ReadRecordFrames lists the record frames of a .warc.zst file written
+// with MemberWriter.SkippableFrames, e.g. by a rotator with
+// RotatorSettings.SkippableFrames, by reading the skippable frames
+// preceding them only, so that the records of a large file are listed
+// without decompressing them. Other skippable frames, like a dictionary,
+// are ignored, and a zstd frame without a skippable frame before it is
+// an error.
+func ReadRecordFrames(file io.ReadSeeker) ([]RecordFrame, error) {
+	var frames []RecordFrame
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			if err == io.EOF {
+				return frames, nil
+			}
+			return nil, err
+		}
+		offset += 8
+
+		magic := binary.LittleEndian.Uint32(header[0:])
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+
+		if magic == zstdFrameMagic {
+			return nil, errors.New("Record frame without skippable frame at offset " + strconv.FormatInt(offset-8, 10))
+		}
+		if magic&0xFFFFFFF0 != recordFrameMagic {
+			return nil, errors.New("Invalid zstd frame at offset " + strconv.FormatInt(offset-8, 10))
+		}
+
+		if magic != recordFrameMagic || size != recordFrameSize {
+			// Another skippable frame
+			if offset, err = file.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data := make([]byte, recordFrameSize)
+		if _, err := io.ReadFull(file, data); err != nil {
+			return nil, err
+		}
+		offset += recordFrameSize
+
+		frame := RecordFrame{
+			Offset:         offset,
+			CompressedSize: int64(binary.LittleEndian.Uint64(data[0:])),
+			Size:           int64(binary.LittleEndian.Uint64(data[8:])),
+		}
+		frames = append(frames, frame)
+
+		if offset, err = file.Seek(frame.CompressedSize, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// frameBuffer holds the compressed record being written
+// by a MemberWriter using skippable frames
+type frameBuffer struct {
+	bytes.Buffer
+	size int64
+}
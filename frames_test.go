@@ -0,0 +1,118 @@
+//go:build !nozstd
+// +build !nozstd
+
+package warc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Tests for the ReadRecordFrames function
+func TestReadRecordFrames(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	members, err := NewMemberWriter(output, CompressionZSTD)
+	if err != nil {
+		t.Fatalf("failed to create member writer: %v", err)
+	}
+	members.SkippableFrames = true
+
+	writer, err := NewWriter(members, "test.warc.zst", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	contents := []string{"first", strings.Repeat("second", 1000), "third"}
+	var sizes []int64
+	for _, content := range contents {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", "http://example.com/"+content[:5])
+		record.Content = strings.NewReader(content)
+
+		start := int64(output.Len())
+		if err := members.Begin(); err != nil {
+			t.Fatalf("failed to begin member: %v", err)
+		}
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+		if err := members.End(); err != nil {
+			t.Fatalf("failed to end member: %v", err)
+		}
+		sizes = append(sizes, int64(output.Len())-start)
+	}
+
+	data := output.Bytes()
+
+	frames, err := ReadRecordFrames(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read record frames: %v", err)
+	}
+
+	if len(frames) != len(contents) {
+		t.Fatalf("expected %d frames, got %d", len(contents), len(frames))
+	}
+
+	for i, frame := range frames {
+		if frame.CompressedSize+8+recordFrameSize != sizes[i] {
+			t.Errorf("frame %d: expected compressed size %d, got %d", i, sizes[i]-8-recordFrameSize, frame.CompressedSize)
+		}
+
+		// The record can be read from the frame offset alone
+		reader, err := NewReader(bytes.NewReader(data[frame.Offset : frame.Offset+frame.CompressedSize]))
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("failed to read record of frame %d: %v", i, err)
+		}
+		reader.Close()
+
+		if record.Header.Get("WARC-Target-URI") != "http://example.com/"+contents[i][:5] {
+			t.Errorf("frame %d: unexpected record %s", i, record.Header.Get("WARC-Target-URI"))
+		}
+
+		if frame.Size < int64(len(contents[i])) || frame.Size > int64(len(contents[i]))+512 {
+			t.Errorf("frame %d: unexpected size %d", i, frame.Size)
+		}
+	}
+
+	// Readers skip the skippable frames
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	records := 0
+	for {
+		_, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		records++
+	}
+
+	if records != len(contents) {
+		t.Errorf("expected %d records, got %d", len(contents), records)
+	}
+
+	// Files without skippable frames can't be listed
+	plain := new(bytes.Buffer)
+	members, _ = NewMemberWriter(plain, CompressionZSTD)
+	members.Begin()
+	io.WriteString(members, "WARC/1.0\r\n\r\n\r\n\r\n")
+	members.End()
+
+	if _, err := ReadRecordFrames(bytes.NewReader(plain.Bytes())); err == nil {
+		t.Error("expected an error for a frame without skippable frame")
+	}
+}
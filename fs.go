@@ -0,0 +1,63 @@
+//go:build go1.16
+// +build go1.16
+
+package warc
+
+import (
+	"io"
+	"io/fs"
+)
+
+// fsOpener returns the openFileFunc of the files of fsys
+func fsOpener(fsys fs.FS) openFileFunc {
+	return func(path string) (io.ReadCloser, error) {
+		return fsys.Open(path)
+	}
+}
+
+// OpenFS returns a Reader reading the records of the WARC file name of
+// fsys, e.g. a zip.Reader or an embed.FS. The file is closed when the
+// Reader is closed.
+func OpenFS(fsys fs.FS, name string) (*Reader, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+
+	return reader, nil
+}
+
+// IndexFS is like IndexFiles for the WARC files of fsys, ResolveRevisit
+// reading the records located with the index from fsys too
+func IndexFS(fsys fs.FS, paths []string) (*MemoryIndex, error) {
+	return indexFiles(fsOpener(fsys), paths)
+}
+
+// ReadRecordAtFS is like ReadRecordAt for a WARC file of fsys, the
+// file is read up to offset if it doesn't implement io.Seeker
+func ReadRecordAtFS(fsys fs.FS, path string, offset int64) (*Record, error) {
+	return readRecordAt(fsOpener(fsys), path, offset)
+}
+
+// AuditFS is like Audit for the WARC files of fsys,
+// the manifest being a file of the file system
+func AuditFS(fsys fs.FS, paths []string, manifest string) (*AuditManifest, error) {
+	return audit(fsOpener(fsys), paths, manifest)
+}
+
+// SampleFS is like Sample for the WARC files of fsys
+func SampleFS(fsys fs.FS, paths []string, rate float64, seed int64, fn func(record *Record) error) error {
+	return sample(fsOpener(fsys), paths, rate, seed, fn)
+}
+
+// ValidateFS is like ValidateFile for a WARC file of fsys
+func ValidateFS(fsys fs.FS, path string) ([]RecordValidation, error) {
+	return validateFile(fsOpener(fsys), path)
+}
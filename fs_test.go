@@ -0,0 +1,164 @@
+//go:build go1.16
+// +build go1.16
+
+package warc
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Tests for the reading of WARC files from an fs.FS
+func TestReadFS(t *testing.T) {
+	data := new(bytes.Buffer)
+
+	members, err := NewMemberWriter(data, CompressionGZIP)
+	if err != nil {
+		t.Fatalf("failed to create member writer: %v", err)
+	}
+
+	writer, err := NewWriter(members, "test.warc.gz", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	response := NewRecord()
+	response.Header.Set("WARC-Type", "response")
+	response.Header.Set("WARC-Target-URI", "https://example.com/")
+	response.Header.Set("WARC-Date", "2021-05-04T10:11:12Z")
+	response.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\nHello, World!")
+
+	revisit := NewRecord()
+	revisit.Header.Set("WARC-Type", "revisit")
+	revisit.Header.Set("WARC-Target-URI", "https://example.com/")
+	revisit.Header.Set("WARC-Date", "2021-06-04T10:11:12Z")
+	revisit.Header.Set("WARC-Profile", ProfileIdenticalPayloadDigest)
+	revisit.Header.Set("WARC-Refers-To-Target-URI", "https://example.com/")
+	revisit.Header.Set("WARC-Refers-To-Date", "2021-05-04T10:11:12Z")
+	revisit.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\n")
+
+	for _, record := range []*Record{response, revisit} {
+		members.Begin()
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+		members.End()
+	}
+
+	// A collection packaged in a zip file, whose
+	// compressed entries can't seek
+	archive := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(archive)
+	entry, err := zipWriter.Create("collection/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	entry.Write(data.Bytes())
+	zipWriter.Close()
+
+	zipFS, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("failed to read zip file: %v", err)
+	}
+
+	for _, fsys := range []struct {
+		name string
+		fs   fs.FS
+	}{
+		{"zip", zipFS},
+		{"map", fstest.MapFS{"collection/test.warc.gz": &fstest.MapFile{Data: data.Bytes()}}},
+	} {
+		index, err := IndexFS(fsys.fs, []string{"collection/test.warc.gz"})
+		if err != nil {
+			t.Fatalf("%s: failed to index WARC file: %v", fsys.name, err)
+		}
+
+		location, err := index.LookupRecord(revisit.Header.Get("WARC-Record-ID"))
+		if err != nil {
+			t.Fatalf("%s: failed to look up revisit record: %v", fsys.name, err)
+		}
+
+		record, err := ReadRecordAtFS(fsys.fs, location.Path, location.Offset)
+		if err != nil {
+			t.Fatalf("%s: failed to read revisit record: %v", fsys.name, err)
+		}
+
+		resolved, err := ResolveRevisit(record, index)
+		if err != nil {
+			t.Fatalf("%s: failed to resolve revisit record: %v", fsys.name, err)
+		}
+
+		if content, _ := ioutil.ReadAll(resolved.Content); string(content) != "HTTP/1.1 200 OK\r\n\r\nHello, World!" {
+			t.Errorf("%s: unexpected resolved content %q", fsys.name, content)
+		}
+
+		reader, err := OpenFS(fsys.fs, "collection/test.warc.gz")
+		if err != nil {
+			t.Fatalf("%s: failed to open WARC file: %v", fsys.name, err)
+		}
+		records := 0
+		for {
+			if _, err := reader.ReadRecord(false); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: failed to read record: %v", fsys.name, err)
+			}
+			records++
+		}
+		reader.Close()
+
+		if records != 2 {
+			t.Errorf("%s: expected 2 records, got %d", fsys.name, records)
+		}
+	}
+}
+
+// Tests that AuditFS and SampleFS read the same
+// records as Audit and Sample
+func TestAuditSampleFS(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-audit-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	report, err := AuditFS(os.DirFS("testdata"), []string{"test.warc.gz"}, filepath.Join(directory, "fs.json"))
+	if err != nil {
+		t.Fatalf("failed to audit WARC file: %v", err)
+	}
+
+	expected, err := Audit([]string{"testdata/test.warc.gz"}, filepath.Join(directory, "os.json"))
+	if err != nil {
+		t.Fatalf("failed to audit WARC file: %v", err)
+	}
+
+	got, want := report.Files["test.warc.gz"], expected.Files["testdata/test.warc.gz"]
+	if got == nil || want == nil || got.Records != want.Records || got.SHA1 != want.SHA1 || got.Verified != want.Verified {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	var sampled, expectedSampled int
+	if err := SampleFS(os.DirFS("testdata"), []string{"test.warc.gz"}, 0.5, 42, func(*Record) error {
+		sampled++
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to sample WARC file: %v", err)
+	}
+
+	Sample([]string{"testdata/test.warc.gz"}, 0.5, 42, func(*Record) error {
+		expectedSampled++
+		return nil
+	})
+
+	if sampled != expectedSampled || sampled == 0 {
+		t.Errorf("expected %d sampled records, got %d", expectedSampled, sampled)
+	}
+}
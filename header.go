@@ -1,6 +1,10 @@
 package warc
 
-import "strings"
+import (
+	"sort"
+	"strings"
+	"sync"
+)
 
 // Header provides information about the WARC record. It stores WARC record
 // field names and their values. Since WARC field names are case-insensitive,
@@ -27,3 +31,126 @@ func (h Header) Del(key string) {
 func NewHeader() Header {
 	return make(map[string]string)
 }
+
+// Clone returns a copy of the header that shares no state with h.
+func (h Header) Clone() Header {
+	clone := make(Header, len(h))
+	for key, value := range h {
+		clone[key] = value
+	}
+	return clone
+}
+
+// Keys returns the header field names, sorted.
+func (h Header) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// canonicalFieldOrder is the order in which the WARC named fields
+// defined by the specifications are written, other fields are written
+// after them, sorted alphabetically
+var canonicalFieldOrder = []string{
+	"warc-type",
+	"warc-record-id",
+	"warc-date",
+	"warc-target-uri",
+	"content-length",
+	"content-type",
+	"warc-concurrent-to",
+	"warc-block-digest",
+	"warc-payload-digest",
+	"warc-ip-address",
+	"warc-refers-to",
+	"warc-refers-to-target-uri",
+	"warc-refers-to-date",
+	"warc-truncated",
+	"warc-warcinfo-id",
+	"warc-filename",
+	"warc-profile",
+	"warc-identified-payload-type",
+	"warc-segment-number",
+	"warc-segment-origin-id",
+	"warc-segment-total-length",
+}
+
+// canonicalKeys returns the header field names in the canonical
+// order they are serialized in, so that the same header always
+// produces the same bytes
+func (h Header) canonicalKeys() []string {
+	keys := make([]string, 0, len(h))
+	known := make(map[string]bool, len(canonicalFieldOrder))
+
+	for _, key := range canonicalFieldOrder {
+		known[key] = true
+		if _, ok := h[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range h.Keys() {
+		if !known[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// SyncHeader is a Header that is safe for concurrent use,
+// e.g. by enrichment code running in parallel on the same record.
+type SyncHeader struct {
+	mu     sync.RWMutex
+	header Header
+}
+
+// NewSyncHeader creates a new concurrent-safe WARC header.
+func NewSyncHeader() *SyncHeader {
+	return &SyncHeader{header: NewHeader()}
+}
+
+// Set sets the header field associated with key to value.
+func (h *SyncHeader) Set(key, value string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header.Set(key, value)
+}
+
+// Get returns the value associated with the given key.
+// If there is no value associated with the key, Get returns "".
+func (h *SyncHeader) Get(key string) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.header.Get(key)
+}
+
+// Del deletes the value associated with key.
+func (h *SyncHeader) Del(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header.Del(key)
+}
+
+// Keys returns the header field names, sorted.
+func (h *SyncHeader) Keys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.header.Keys()
+}
+
+// Clone returns a copy of the header that shares no state with h.
+func (h *SyncHeader) Clone() *SyncHeader {
+	return &SyncHeader{header: h.Header()}
+}
+
+// Header returns a snapshot of the header as a plain Header,
+// that can be used as a Record's Header.
+func (h *SyncHeader) Header() Header {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.header.Clone()
+}
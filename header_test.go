@@ -1,6 +1,10 @@
 package warc
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
 // Tests for the Header methods and NewHeader
 func TestHeaderMethods(t *testing.T) {
@@ -20,3 +24,48 @@ func TestHeaderMethods(t *testing.T) {
 		t.Error("Failed to delete warcinfo header")
 	}
 }
+
+// Tests for the Header.Clone method
+func TestHeaderClone(t *testing.T) {
+	header := NewHeader()
+	header.Set("test-header", "test-value")
+
+	clone := header.Clone()
+	clone.Set("test-header", "other-value")
+
+	if header.Get("test-header") != "test-value" {
+		t.Error("Modifying the clone modified the original header")
+	}
+}
+
+// Tests for the SyncHeader methods
+func TestSyncHeaderMethods(t *testing.T) {
+	header := NewSyncHeader()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			header.Set(fmt.Sprintf("X-Header-%d", i), "value")
+			header.Get("X-Header-0")
+		}(i)
+	}
+	wg.Wait()
+
+	keys := header.Keys()
+	if len(keys) != 10 || keys[0] != "x-header-0" || keys[9] != "x-header-9" {
+		t.Errorf("unexpected header keys %v", keys)
+	}
+
+	clone := header.Clone()
+	header.Del("X-Header-0")
+
+	if header.Get("X-Header-0") != "" {
+		t.Error("Failed to delete header")
+	}
+
+	if clone.Get("X-Header-0") != "value" || clone.Header().Get("X-Header-0") != "value" {
+		t.Error("Modifying the header modified its clone")
+	}
+}
@@ -0,0 +1,170 @@
+package warc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthStatus is the state of a rotator, as reported by Health
+type HealthStatus struct {
+	// Running is true between the start of the rotator
+	// and the closing of its channel
+	Running bool
+	// LastWrite is when the last batch was written
+	LastWrite time.Time
+	// LastError is the error of the rotator since the last batch
+	// written, it is cleared once a batch is written again
+	LastError string
+	// Directory is the directory the current WARC file is written to
+	Directory string
+	// FreeSpace is the free space in MegaBytes of Directory,
+	// it is -1 if it can't be retrieved on this system
+	FreeSpace float64
+	// PendingBatches is the number of batches written to the current WARC
+	// file but not flushed nor acknowledged yet, see CoalesceLatency, and
+	// PendingRecords the number of their records
+	PendingBatches int
+	PendingRecords int
+}
+
+// rotatorHealth tracks the state of a rotator
+type rotatorHealth struct {
+	mu        sync.Mutex
+	running   bool
+	lastWrite time.Time
+	lastError error
+	directory string
+
+	pendingBatches int
+	pendingRecords int
+}
+
+func (h *rotatorHealth) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.running = true
+}
+
+func (h *rotatorHealth) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.running = false
+}
+
+func (h *rotatorHealth) opened(directory string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.directory = directory
+}
+
+func (h *rotatorHealth) written() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastWrite = time.Now()
+	h.lastError = nil
+}
+
+func (h *rotatorHealth) queued(batches, records int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pendingBatches = batches
+	h.pendingRecords = records
+}
+
+func (h *rotatorHealth) failed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastError = err
+}
+
+// Health returns the state of the rotator.
+func (s *RotatorSettings) Health() HealthStatus {
+	health := &s.currentRotator().health
+
+	health.mu.Lock()
+	status := HealthStatus{
+		Running:   health.running,
+		LastWrite: health.lastWrite,
+		Directory: health.directory,
+		FreeSpace: -1,
+
+		PendingBatches: health.pendingBatches,
+		PendingRecords: health.pendingRecords,
+	}
+	if health.lastError != nil {
+		status.LastError = health.lastError.Error()
+	}
+	health.mu.Unlock()
+
+	if status.Directory != "" {
+		if freeSpace, ok := diskFreeSpace(status.Directory); ok {
+			status.FreeSpace = float64(freeSpace) / 1024 / 1024
+		}
+	}
+
+	return status
+}
+
+// Healthy returns an error if the rotator isn't running, if it failed since
+// the last batch written, or if the directory it writes to is below
+// MinFreeSpace with no spillover directory left.
+func (s *RotatorSettings) Healthy() error {
+	status := s.Health()
+
+	if status.LastError != "" {
+		return errors.New("Rotator failed: " + status.LastError)
+	}
+
+	if !status.Running {
+		return errors.New("Rotator isn't running")
+	}
+
+	if s.MinFreeSpace > 0 && status.FreeSpace >= 0 && status.FreeSpace < s.MinFreeSpace {
+		return errors.New("Not enough free space in " + status.Directory)
+	}
+
+	return nil
+}
+
+// LivenessHandler returns an http.Handler responding with the Health of
+// the rotator, with a 503 status code if the rotator shut down because of
+// its failures, see Err. The failures tolerated by FailAfter don't make
+// the rotator unalive.
+func (s *RotatorSettings) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusOK
+		if s.Err() != nil {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeHealth(w, code, s.Health())
+	})
+}
+
+// ReadinessHandler returns an http.Handler responding with the Health of
+// the rotator, with a 503 status code if it isn't Healthy.
+func (s *RotatorSettings) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusOK
+		if s.Healthy() != nil {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeHealth(w, code, s.Health())
+	})
+}
+
+func writeHealth(w http.ResponseWriter, code int, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
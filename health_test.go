@@ -0,0 +1,184 @@
+package warc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveHealth returns the status code and the HealthStatus
+// served by a health handler
+func serveHealth(t *testing.T, handler http.Handler) (int, HealthStatus) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var status HealthStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode health status: %v", err)
+	}
+
+	return recorder.Code, status
+}
+
+// Tests that the rotator recovers its health once a
+// batch is written after a tolerated failure
+func TestRotatorHealth(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FailAfter = 2
+
+	if rotatorSettings.Healthy() == nil {
+		t.Error("expected the rotator unhealthy before it started")
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	liveness := rotatorSettings.LivenessHandler()
+	readiness := rotatorSettings.ReadinessHandler()
+
+	failure := errors.New("fail")
+	for i, test := range []struct {
+		payload   string
+		healthy   bool
+		readiness int
+	}{
+		{"ok", true, http.StatusOK},
+		{"fail", false, http.StatusServiceUnavailable},
+		{"ok", true, http.StatusOK},
+	} {
+		sendPayloads(records, []string{test.payload}, failure)
+
+		if err := rotatorSettings.Healthy(); (err == nil) != test.healthy {
+			t.Errorf("batch %d: expected healthy %v, got %v", i, test.healthy, err)
+		}
+
+		code, status := serveHealth(t, readiness)
+		if code != test.readiness {
+			t.Errorf("batch %d: expected readiness %d, got %d", i, test.readiness, code)
+		}
+		if !status.Running || status.LastWrite.IsZero() || filepath.Clean(status.Directory) != outputDirectory {
+			t.Errorf("batch %d: unexpected health status %+v", i, status)
+		}
+		if (status.LastError == "") != test.healthy {
+			t.Errorf("batch %d: unexpected last error %q", i, status.LastError)
+		}
+
+		// A tolerated failure doesn't make the rotator unalive
+		if code, _ := serveHealth(t, liveness); code != http.StatusOK {
+			t.Errorf("batch %d: expected liveness %d, got %d", i, http.StatusOK, code)
+		}
+	}
+
+	close(records)
+	<-done
+
+	code, status := serveHealth(t, readiness)
+	if code != http.StatusServiceUnavailable || status.Running {
+		t.Errorf("expected a stopped rotator not ready, got %d, %+v", code, status)
+	}
+}
+
+// Tests that the liveness handler fails once the rotator shut down
+func TestRotatorLivenessShutdown(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	sendPayloads(records, []string{"fail"}, errors.New("fail"))
+
+	code, status := serveHealth(t, rotatorSettings.LivenessHandler())
+	if code != http.StatusServiceUnavailable || status.LastError == "" {
+		t.Errorf("expected the rotator unalive after its shutdown, got %d, %+v", code, status)
+	}
+
+	close(records)
+	<-done
+}
+
+// blockingDedupStore is a DedupStore whose AddDigest
+// blocks until release is closed
+type blockingDedupStore struct {
+	*MemoryDedupStore
+	adding  chan bool
+	release chan bool
+}
+
+func (s *blockingDedupStore) AddDigest(digest string, original RefersTo) error {
+	s.adding <- true
+	<-s.release
+	return s.MemoryDedupStore.AddDigest(digest, original)
+}
+
+// Tests that the health status reports the batches waiting to be flushed
+func TestRotatorHealthPending(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	store := &blockingDedupStore{MemoryDedupStore: NewMemoryDedupStore(), adding: make(chan bool), release: make(chan bool)}
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.Dedup = store
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	batch := NewRecordBatch()
+	for _, warcType := range []string{"request", "response"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", warcType)
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\nHello, World!")
+		batch.Records = append(batch.Records, record)
+	}
+	batch.Done = make(chan bool)
+	records <- batch
+
+	// The batch is pending until its digest is added to the store
+	<-store.adding
+	if status := rotatorSettings.Health(); status.PendingBatches != 1 || status.PendingRecords != 2 {
+		t.Errorf("expected 1 pending batch of 2 records, got %+v", status)
+	}
+	close(store.release)
+
+	if !<-batch.Done {
+		t.Fatalf("expected the batch to be written")
+	}
+
+	if status := rotatorSettings.Health(); status.PendingBatches != 0 || status.PendingRecords != 0 {
+		t.Errorf("expected no pending batch, got %+v", status)
+	}
+
+	close(records)
+	<-done
+}
@@ -0,0 +1,259 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HTTPStartLine is the parsed first line of the HTTP message stored in
+// a request or response record.
+type HTTPStartLine struct {
+	// Proto is the protocol version, e.g. "HTTP/1.1"
+	Proto string
+	// StatusCode and Reason are set for responses
+	StatusCode int
+	Reason     string
+	// Method and RequestURI are set for requests
+	Method     string
+	RequestURI string
+}
+
+// IsResponse returns true if the start line is a response status line.
+func (l *HTTPStartLine) IsResponse() bool {
+	return l.StatusCode != 0
+}
+
+// IsAbsoluteForm returns true if the start line is a request line whose
+// request target is an absolute URI, as sent to a proxy, e.g.
+// "GET http://example.com/index.html HTTP/1.1".
+func (l *HTTPStartLine) IsAbsoluteForm() bool {
+	return !l.IsResponse() && strings.Contains(l.RequestURI, "://")
+}
+
+// OriginForm returns the request target of a request line in origin form,
+// i.e. the path and query of absolute-form request targets, as they
+// would have been sent without a proxy.
+func (l *HTTPStartLine) OriginForm() string {
+	if !l.IsAbsoluteForm() {
+		return l.RequestURI
+	}
+
+	target, err := url.Parse(l.RequestURI)
+	if err != nil {
+		return l.RequestURI
+	}
+
+	if target.RequestURI() == "" {
+		return "/"
+	}
+	return target.RequestURI()
+}
+
+// RequestTargetURI returns the absolute URI requested by the HTTP request
+// stored in a request record, whether the request line was sent directly
+// in origin form or to a proxy in absolute form, so that both give the same
+// WARC-Target-URI. Origin-form targets are resolved against the Host field,
+// using the scheme of the record's WARC-Target-URI, http by default. The
+// record content can still be read from the start afterwards.
+func (r *Record) RequestTargetURI() (string, error) {
+	startLine, err := r.HTTPStartLine()
+	if err != nil {
+		return "", err
+	}
+
+	if startLine.IsResponse() {
+		return "", errors.New("Record doesn't store an HTTP request")
+	}
+
+	if startLine.IsAbsoluteForm() {
+		target, err := url.Parse(startLine.RequestURI)
+		if err != nil {
+			return "", err
+		}
+		target.Fragment = ""
+		return target.String(), nil
+	}
+
+	block, err := r.peek(sniffSize)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(block)))
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "http"
+	if target, err := url.Parse(strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")); err == nil && target.Scheme != "" {
+		scheme = target.Scheme
+	}
+
+	return scheme + "://" + req.Host + startLine.OriginForm(), nil
+}
+
+// HTTPStartLine parses the first line of the HTTP message stored in the
+// record's block, the record content can still be read from the start
+// afterwards.
+func (r *Record) HTTPStartLine() (*HTTPStartLine, error) {
+	line, err := r.readFirstLine()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHTTPStartLine(strings.TrimRight(line, "\r\n"))
+}
+
+// HTTPHead returns the head of the HTTP message stored in the record's
+// block, i.e. its start line and header fields up to and including the
+// empty line ending them, exactly as they were received: duplicate,
+// folded or malformed fields are kept as is, as the block is stored
+// verbatim and never re-serialized from the parsed header. The record
+// content can still be read from the start afterwards.
+func (r *Record) HTTPHead() ([]byte, error) {
+	block, err := r.blockReader()
+	if err != nil {
+		return nil, err
+	}
+	defer block.Close()
+
+	reader := bufio.NewReader(block)
+	head := new(bytes.Buffer)
+
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, errors.New("Truncated HTTP head: " + err.Error())
+		}
+		head.WriteString(line)
+
+		if line == "\r\n" || line == "\n" {
+			return head.Bytes(), nil
+		}
+		if !strings.HasSuffix(line, "\n") {
+			return nil, errors.New("Truncated HTTP head")
+		}
+	}
+}
+
+// requestMethods returns the methods of the HTTP requests stored in the
+// request records of a batch, by the WARC-Record-ID of their responses,
+// the records concurrent to them
+func requestMethods(records []*Record) map[string]string {
+	methods := make(map[string]string)
+
+	for _, request := range records {
+		if request.Header.Get("WARC-Type") != "request" {
+			continue
+		}
+
+		line, err := request.HTTPStartLine()
+		if err != nil || line.IsResponse() {
+			continue
+		}
+
+		// The request refers to its response, or the other way around
+		requestID := request.Header.Get("WARC-Record-ID")
+		for _, response := range records {
+			responseID := response.Header.Get("WARC-Record-ID")
+			if responseID == "" || response == request {
+				continue
+			}
+
+			if concurrentTo(request, responseID) || (requestID != "" && concurrentTo(response, requestID)) {
+				methods[responseID] = line.Method
+			}
+		}
+	}
+
+	return methods
+}
+
+// concurrentTo returns whether a record is concurrent
+// to the record whose WARC-Record-ID is recordID
+func concurrentTo(r *Record, recordID string) bool {
+	for _, id := range strings.Split(r.Header.Get("WARC-Concurrent-To"), ",") {
+		if strings.TrimSpace(id) == recordID {
+			return true
+		}
+	}
+	return false
+}
+
+// readFirstLine reads the first line of the record's block,
+// without consuming the record content
+func (r *Record) readFirstLine() (string, error) {
+	if r.PayloadPath != "" {
+		file, err := os.Open(r.PayloadPath)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		return readLine(bufio.NewReader(file))
+	}
+
+	if r.Content == nil {
+		return "", errors.New("Record has no content")
+	}
+
+	// Read the line, then put it back in front of the content
+	reader := bufio.NewReader(r.Content)
+	line, err := readLine(reader)
+	r.Content = io.MultiReader(bytes.NewReader([]byte(line)), reader)
+
+	return line, err
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return line, err
+}
+
+// parseHTTPStartLine parses an HTTP request line or status line
+func parseHTTPStartLine(line string) (*HTTPStartLine, error) {
+	parts := strings.SplitN(line, " ", 3)
+
+	// Status line: HTTP-version SP status-code SP [ reason-phrase ]
+	if strings.HasPrefix(line, "HTTP/") {
+		if len(parts) < 2 {
+			return nil, errors.New("Malformed HTTP status line: " + line)
+		}
+
+		statusCode, err := strconv.Atoi(parts[1])
+		if err != nil || len(parts[1]) != 3 {
+			return nil, errors.New("Malformed HTTP status line: " + line)
+		}
+
+		startLine := &HTTPStartLine{
+			Proto:      parts[0],
+			StatusCode: statusCode,
+		}
+		if len(parts) == 3 {
+			startLine.Reason = parts[2]
+		}
+
+		return startLine, nil
+	}
+
+	// Request line: method SP request-target SP HTTP-version
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return nil, errors.New("Malformed HTTP request line: " + line)
+	}
+
+	return &HTTPStartLine{
+		Method:     parts[0],
+		RequestURI: parts[1],
+		Proto:      parts[2],
+	}, nil
+}
@@ -0,0 +1,214 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the Record.HTTPStartLine method
+func TestRecordHTTPStartLine(t *testing.T) {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	// Skip the warcinfo record
+	reader.ReadRecord(false)
+
+	record, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected record, got %v", err)
+	}
+
+	startLine, err := record.HTTPStartLine()
+	if err != nil {
+		t.Fatalf("failed to parse start line: %v", err)
+	}
+
+	if !startLine.IsResponse() || startLine.StatusCode != 301 || startLine.Reason != "Moved Permanently" || startLine.Proto != "HTTP/1.1" {
+		t.Errorf("unexpected start line %+v", startLine)
+	}
+
+	// The content must still be complete
+	content, err := ioutil.ReadAll(record.Content)
+	if err != nil {
+		t.Fatalf("failed to read record content: %v", err)
+	}
+
+	if hash := "sha1:" + GetSHA1(content); hash != record.Header.Get("WARC-Block-Digest") {
+		t.Errorf("expected %s, got %s", record.Header.Get("WARC-Block-Digest"), hash)
+	}
+}
+
+// Tests for the parsing of HTTP request lines
+func TestRecordHTTPRequestLine(t *testing.T) {
+	record := NewRecord()
+	record.Content = strings.NewReader("GET /index.html HTTP/1.0\r\nHost: example.com\r\n\r\n")
+
+	startLine, err := record.HTTPStartLine()
+	if err != nil {
+		t.Fatalf("failed to parse start line: %v", err)
+	}
+
+	if startLine.IsResponse() || startLine.Method != "GET" || startLine.RequestURI != "/index.html" || startLine.Proto != "HTTP/1.0" {
+		t.Errorf("unexpected start line %+v", startLine)
+	}
+
+	record.Content = strings.NewReader("not an HTTP message")
+	if _, err := record.HTTPStartLine(); err == nil {
+		t.Error("expected an error for a malformed start line")
+	}
+}
+
+// Tests that requests sent directly and through a proxy are written as
+// sent, while giving the same target URI
+func TestRecordRequestTargetURI(t *testing.T) {
+	for _, request := range []string{
+		"GET /search?q=warc HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"GET https://example.com/search?q=warc HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "request")
+		record.Header.Set("WARC-Target-URI", "https://example.com/search?q=warc")
+		record.Content = strings.NewReader(request)
+
+		target, err := record.RequestTargetURI()
+		if err != nil {
+			t.Fatalf("failed to get request target: %v", err)
+		}
+
+		if target != "https://example.com/search?q=warc" {
+			t.Errorf("unexpected target %s for %q", target, request)
+		}
+
+		startLine, err := record.HTTPStartLine()
+		if err != nil {
+			t.Fatalf("failed to parse start line: %v", err)
+		}
+
+		if startLine.OriginForm() != "/search?q=warc" {
+			t.Errorf("unexpected origin form %s", startLine.OriginForm())
+		}
+
+		buffer := new(bytes.Buffer)
+		writer, err := NewWriter(buffer, "test.warc", "")
+		if err != nil {
+			t.Fatalf("failed to initialize a new writer: %v", err)
+		}
+
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+
+		if !strings.Contains(buffer.String(), "\r\n\r\n"+request+"\r\n\r\n") {
+			t.Errorf("expected the request to be written as sent, got %q", buffer.String())
+		}
+	}
+}
+
+// Tests that the HTTP heads of hostile responses are stored and
+// read back byte for byte, whatever their header fields
+func TestRecordHTTPHeadVerbatim(t *testing.T) {
+	for name, head := range map[string]string{
+		"duplicate Content-Length": "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Length: 13\r\n\r\n",
+		"obs-fold":                 "HTTP/1.1 200 OK\r\nX-Folded: first\r\n  second\r\n\tthird\r\nContent-Length: 13\r\n\r\n",
+		"smuggling":                "HTTP/1.1 200 OK\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding : identity\r\n\r\n",
+		"bare LF":                  "HTTP/1.1 200 OK\nContent-Length: 13\nX-Header:value\n\n",
+		"mixed case and spacing":   "HTTP/1.1 200 OK\r\ncOnTeNt-LeNgTh:13   \r\nSet-Cookie: a=1\r\nset-cookie: b=2\r\n\r\n",
+	} {
+		block := head + "Hello, World!"
+
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader(block)
+
+		output := new(bytes.Buffer)
+		writer, err := NewWriter(output, "test.warc", "")
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("%s: failed to write record: %v", name, err)
+		}
+
+		reader, err := NewReader(output)
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+
+		read, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("%s: failed to read record: %v", name, err)
+		}
+
+		readHead, err := read.HTTPHead()
+		if err != nil {
+			t.Fatalf("%s: failed to read HTTP head: %v", name, err)
+		}
+		if string(readHead) != head {
+			t.Errorf("%s: expected head %q, got %q", name, head, readHead)
+		}
+
+		content, err := ioutil.ReadAll(read.Content)
+		if err != nil {
+			t.Fatalf("%s: failed to read record content: %v", name, err)
+		}
+		if string(content) != block {
+			t.Errorf("%s: expected block %q, got %q", name, block, content)
+		}
+		reader.Close()
+	}
+
+	record := NewRecord()
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 13\r\n")
+	if _, err := record.HTTPHead(); err == nil {
+		t.Error("expected an error for a truncated head")
+	}
+}
+
+// Tests that the rotator infers the method of the request
+// answered by a response from the records of its batch
+func TestRequestMethods(t *testing.T) {
+	response := NewRecord()
+	response.Header.Set("WARC-Type", "response")
+	response.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000000>")
+	response.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 1234\r\n\r\n")
+
+	request := NewRecord()
+	request.Header.Set("WARC-Type", "request")
+	request.Header.Set("WARC-Concurrent-To", response.Header.Get("WARC-Record-ID"))
+	request.Content = strings.NewReader("HEAD / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+	methods := requestMethods([]*Record{response, request})
+	if methods[response.Header.Get("WARC-Record-ID")] != http.MethodHead {
+		t.Errorf("expected the HEAD method of the response, got %v", methods)
+	}
+
+	// The response can refer to its request too
+	request.Header.Del("WARC-Concurrent-To")
+	request.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000001>")
+	response.Header.Set("WARC-Concurrent-To", request.Header.Get("WARC-Record-ID"))
+
+	methods = requestMethods([]*Record{request, response})
+	if methods[response.Header.Get("WARC-Record-ID")] != http.MethodHead {
+		t.Errorf("expected the HEAD method of the response, got %v", methods)
+	}
+
+	// The content of the request can still be read
+	if content, _ := ioutil.ReadAll(request.Content); !strings.HasPrefix(string(content), "HEAD / HTTP/1.1\r\n") {
+		t.Errorf("expected the request content to be kept, got %q", content)
+	}
+}
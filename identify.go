@@ -0,0 +1,260 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// sniffSize is the number of bytes of the block read to identify the
+// payload type, large enough to skip the HTTP headers of most responses
+const sniffSize = 32 * 1024
+
+// PayloadIdentifier identifies the format of record payloads, e.g. to
+// set the WARC-Identified-Payload-Type field of the records. The payload
+// is given as its first bytes, see sniffSize.
+type PayloadIdentifier interface {
+	// IdentifyPayload returns the media type of the payload, or an
+	// empty string if it can't be identified
+	IdentifyPayload(payload []byte) (string, error)
+}
+
+// SniffingIdentifier is a PayloadIdentifier sniffing the payload's
+// magic bytes, as described by http.DetectContentType
+type SniffingIdentifier struct{}
+
+// IdentifyPayload implements PayloadIdentifier
+func (SniffingIdentifier) IdentifyPayload(payload []byte) (string, error) {
+	contentType := http.DetectContentType(payload)
+	if contentType == "application/octet-stream" {
+		return "", nil
+	}
+	return contentType, nil
+}
+
+// TikaIdentifier is a PayloadIdentifier sending the payloads to the
+// detector of an Apache Tika server, which gives more precise types
+// than sniffing
+type TikaIdentifier struct {
+	// URL of the Tika server, e.g. "http://localhost:9998"
+	URL string
+	// Client used to send the requests, default is http.DefaultClient
+	Client *http.Client
+}
+
+// IdentifyPayload implements PayloadIdentifier
+func (t *TikaIdentifier) IdentifyPayload(payload []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(t.URL, "/")+"/detect/stream", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/plain")
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("Unexpected HTTP status from Tika server: " + resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := strings.TrimSpace(string(body))
+	if contentType == "application/octet-stream" {
+		return "", nil
+	}
+
+	return contentType, nil
+}
+
+// IdentifyPayloadType identifies the type of the record's payload from its
+// first bytes, independently of the declared Content-Type, as described by
+// http.DetectContentType. Only response and resource records are identified,
+// an empty string is returned for other records or when the payload type
+// can't be identified. Content-encoded payloads are identified as is.
+// The record content can still be read from the start afterwards.
+func (r *Record) IdentifyPayloadType() (string, error) {
+	return r.identifyPayload(SniffingIdentifier{})
+}
+
+// identifyPayload identifies the type of the record's payload with identifier
+func (r *Record) identifyPayload(identifier PayloadIdentifier) (string, error) {
+	warcType := r.Header.Get("WARC-Type")
+	if warcType != "response" && warcType != "resource" {
+		return "", nil
+	}
+
+	block, err := r.peek(sniffSize)
+	if err != nil {
+		return "", err
+	}
+
+	payload := block
+	if warcType == "response" && bytes.HasPrefix(block, []byte("HTTP/")) {
+		end := bytes.Index(block, []byte("\r\n\r\n"))
+		if end == -1 {
+			return "", nil
+		}
+		payload = block[end+4:]
+	}
+
+	if len(payload) == 0 {
+		return "", nil
+	}
+
+	return identifier.IdentifyPayload(payload)
+}
+
+// identifyPayloadType sets the WARC-Identified-Payload-Type field
+// of the record if it isn't set and the type is identified
+func (r *Record) identifyPayloadType(identifier PayloadIdentifier) error {
+	if r.Header.Get("WARC-Identified-Payload-Type") != "" {
+		return nil
+	}
+
+	payloadType, err := r.identifyPayload(identifier)
+	if err != nil {
+		return err
+	}
+
+	if payloadType != "" {
+		r.Header.Set("WARC-Identified-Payload-Type", payloadType)
+	}
+
+	return nil
+}
+
+// IdentificationSink receives the payload type identified for a record,
+// e.g. to add it to the CDX entry or the catalog entry of the record
+type IdentificationSink func(record *Record, payloadType string) error
+
+// IdentificationPool identifies the payload types of records in a bounded
+// pool of workers, decoupled from the writing of the records, so that a
+// slow or unavailable identifier, e.g. a Tika server, doesn't block the
+// writer. The records whose payload type can't be identified aren't given
+// to the sink.
+type IdentificationPool struct {
+	identifier PayloadIdentifier
+	sink       IdentificationSink
+	records    chan *Record
+	wg         sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewIdentificationPool starts workers goroutines identifying the payload
+// types of the records submitted to the pool with identifier and passing
+// them to sink, queueSize records waiting at most to be identified.
+func NewIdentificationPool(identifier PayloadIdentifier, workers int, queueSize int, sink IdentificationSink) *IdentificationPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &IdentificationPool{
+		identifier: identifier,
+		sink:       sink,
+		records:    make(chan *Record, queueSize),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *IdentificationPool) work() {
+	defer p.wg.Done()
+
+	for record := range p.records {
+		payloadType, err := record.identifyPayload(p.identifier)
+		if err == nil && payloadType != "" {
+			err = p.sink(record, payloadType)
+		}
+
+		if err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Submit queues a record for identification, the record must not be used
+// by the caller anymore, use Record.Clone beforehand if needed. Submit
+// doesn't block: it returns false if the queue is full and the record is
+// skipped.
+func (p *IdentificationPool) Submit(record *Record) bool {
+	select {
+	case p.records <- record:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close waits for the queued records to be identified, and returns
+// the first error returned by the identifier or the sink, if any.
+func (p *IdentificationPool) Close() error {
+	close(p.records)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+// peek reads up to n bytes of the record's block,
+// without consuming the record content
+func (r *Record) peek(n int) ([]byte, error) {
+	var reader io.Reader
+
+	if r.PayloadPath != "" {
+		file, err := os.Open(r.PayloadPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		reader = file
+	} else if r.Content != nil {
+		reader = r.Content
+	} else {
+		return nil, nil
+	}
+
+	data := make([]byte, n)
+	read, err := io.ReadFull(reader, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	data = data[:read]
+
+	// Put the data back in front of the content
+	if r.PayloadPath == "" {
+		r.Content = io.MultiReader(bytes.NewReader(data), r.Content)
+	}
+
+	return data, err
+}
@@ -0,0 +1,166 @@
+package warc
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Tests for the Record.IdentifyPayloadType method
+func TestRecordIdentifyPayloadType(t *testing.T) {
+	png := "\x89PNG\x0D\x0A\x1A\x0A" + strings.Repeat("\x00", 16)
+
+	for _, test := range []struct {
+		warcType string
+		block    string
+		expected string
+	}{
+		{"response", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + png, "image/png"},
+		{"response", "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\n\r\n<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+		{"response", "HTTP/1.1 204 No Content\r\n\r\n", ""},
+		{"resource", png, "image/png"},
+		{"request", "GET / HTTP/1.1\r\n\r\n", ""},
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", test.warcType)
+		record.Content = strings.NewReader(test.block)
+
+		payloadType, err := record.IdentifyPayloadType()
+		if err != nil {
+			t.Fatalf("failed to identify payload type: %v", err)
+		}
+
+		if payloadType != test.expected {
+			t.Errorf("expected payload type %q, got %q", test.expected, payloadType)
+		}
+
+		// The content must still be readable from the start
+		content, err := ioutil.ReadAll(record.Content)
+		if err != nil {
+			t.Fatalf("failed to read content: %v", err)
+		}
+
+		if string(content) != test.block {
+			t.Errorf("content changed after identification: %q", content)
+		}
+	}
+}
+
+// Tests for the TikaIdentifier type
+func TestTikaIdentifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/detect/stream" {
+			http.NotFound(w, r)
+			return
+		}
+
+		payload, _ := ioutil.ReadAll(r.Body)
+		if string(payload) == "%PDF-1.7" {
+			io.WriteString(w, "application/pdf\n")
+			return
+		}
+		io.WriteString(w, "application/octet-stream")
+	}))
+	defer server.Close()
+
+	identifier := &TikaIdentifier{URL: server.URL + "/"}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\n%PDF-1.7")
+
+	if err := record.identifyPayloadType(identifier); err != nil {
+		t.Fatalf("failed to identify payload type: %v", err)
+	}
+
+	if payloadType := record.Header.Get("WARC-Identified-Payload-Type"); payloadType != "application/pdf" {
+		t.Errorf("expected application/pdf, got %q", payloadType)
+	}
+
+	payloadType, err := identifier.IdentifyPayload([]byte("unknown"))
+	if err != nil {
+		t.Fatalf("failed to identify payload type: %v", err)
+	}
+
+	if payloadType != "" {
+		t.Errorf("expected unidentified payload, got %q", payloadType)
+	}
+}
+
+// failingIdentifier is a PayloadIdentifier failing as an unavailable server
+type failingIdentifier struct{}
+
+func (failingIdentifier) IdentifyPayload(payload []byte) (string, error) {
+	return "", errors.New("identifier unavailable")
+}
+
+// Tests that the rotator gives the records written to its
+// IdentificationPool, whose failures don't fail the writes
+func TestRotatorIdentificationPool(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	for _, identifier := range []PayloadIdentifier{SniffingIdentifier{}, failingIdentifier{}} {
+		var mu sync.Mutex
+		identified := make(map[string]string)
+
+		pool := NewIdentificationPool(identifier, 2, 10, func(record *Record, payloadType string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			identified[record.Header.Get("WARC-Record-ID")] = payloadType
+			return nil
+		})
+
+		rotatorSettings := NewRotatorSettings()
+		rotatorSettings.OutputDirectory = outputDirectory
+		rotatorSettings.IdentificationPool = pool
+
+		records, done, err := rotatorSettings.NewWARCRotator()
+		if err != nil {
+			t.Fatalf("failed to start rotator: %v", err)
+		}
+
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader("<!DOCTYPE html><html></html>")
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool)
+		records <- batch
+
+		if !<-batch.Done {
+			t.Errorf("%T: expected the batch to be written", identifier)
+		}
+
+		close(records)
+		<-done
+
+		err = pool.Close()
+		if _, failing := identifier.(failingIdentifier); failing {
+			if err == nil || len(identified) != 0 {
+				t.Errorf("expected the identifier error only, got %v, %v", identified, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("failed to identify payload types: %v", err)
+		}
+
+		if payloadType := identified[record.Header.Get("WARC-Record-ID")]; payloadType != "text/html; charset=utf-8" {
+			t.Errorf("expected the written record identified as text/html, got %v", identified)
+		}
+	}
+}
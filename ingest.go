@@ -0,0 +1,40 @@
+package warc
+
+import (
+	"io"
+	"os"
+)
+
+// Ingest reads all the records of reader and sends them to a rotator
+// channel, one batch per record, so that records produced by other tools
+// are re-archived with the rotator's settings (compression, rotation...).
+// The records keep their WARC-Record-ID and WARC-Date, while their
+// WARC-Warcinfo-ID is replaced by the one of the file they are written to.
+// Payloads are spooled on disk, and removed once they have been written.
+// Ingest returns the number of records sent.
+func Ingest(reader *Reader, records chan<- *RecordBatch) (int, error) {
+	total := 0
+
+	for {
+		record, err := reader.ReadRecord(true)
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+
+		batch := NewRecordBatch()
+		if date := record.Header.Get("WARC-Date"); date != "" {
+			batch.CaptureTime = date
+		}
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool)
+
+		records <- batch
+		<-batch.Done
+
+		os.Remove(record.PayloadPath)
+		total++
+	}
+}
@@ -0,0 +1,99 @@
+package warc
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests for the Ingest function
+func TestIngest(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-ingest-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	// The records are compressed with the last algorithm built in
+	compressions := testCompressions()
+	rotatorSettings.Compression = compressions[len(compressions)-1]
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	total, err := Ingest(reader, records)
+	if err != nil {
+		t.Fatalf("failed to ingest records: %v", err)
+	}
+
+	close(records)
+	<-done
+
+	if total != 19 {
+		t.Errorf("expected 19 records, got %d", total)
+	}
+
+	// Check the records of the new file against the original ones
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc*"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v (%v)", paths, err)
+	}
+
+	ingested, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open ingested file: %v", err)
+	}
+	defer ingested.Close()
+
+	ingestedReader, err := NewReader(ingested)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer ingestedReader.Close()
+
+	// Skip the new warcinfo record
+	ingestedReader.ReadRecord(false)
+
+	file.Seek(0, io.SeekStart)
+	originalReader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer originalReader.Close()
+
+	for i := 0; i < 19; i++ {
+		original, err := originalReader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("expected original record %d, got %v", i, err)
+		}
+
+		record, err := ingestedReader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("expected ingested record %d, got %v", i, err)
+		}
+
+		for _, key := range []string{"WARC-Record-ID", "WARC-Date", "WARC-Block-Digest"} {
+			if record.Header.Get(key) != original.Header.Get(key) {
+				t.Errorf("expected %s %q, got %q", key, original.Header.Get(key), record.Header.Get(key))
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build go1.23
+// +build go1.23
+
+package warc
+
+import (
+	"io"
+	"iter"
+	"os"
+)
+
+// Records returns an iterator over the records of the reader, reading
+// them in memory like ReadRecord(false):
+//
+//	for record, err := range reader.Records() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The iteration stops after the first error, io.EOF ending it without
+// error. Breaking out of the loop leaves the remaining records unread,
+// the reader can then still be used with ReadRecord.
+func (r *Reader) Records() iter.Seq2[*Record, error] {
+	return r.records(false)
+}
+
+// RecordsOnDisk is like Records but reads the records' content on disk,
+// like ReadRecord(true). The temporary file of each record is removed
+// once the loop body returns, so it must not be kept.
+func (r *Reader) RecordsOnDisk() iter.Seq2[*Record, error] {
+	return r.records(true)
+}
+
+func (r *Reader) records(onDisk bool) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for {
+			record, err := r.ReadRecord(onDisk)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			more := yield(record, nil)
+			if onDisk {
+				os.Remove(record.PayloadPath)
+			}
+			if !more {
+				return
+			}
+		}
+	}
+}
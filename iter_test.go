@@ -0,0 +1,51 @@
+//go:build go1.23
+// +build go1.23
+
+package warc
+
+import (
+	"os"
+	"testing"
+)
+
+// Tests for the Reader.Records iterator
+func TestReaderRecords(t *testing.T) {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	count := 0
+	for record, err := range reader.Records() {
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		if record.Header.Get("WARC-Type") == "" {
+			t.Errorf("record %d has no WARC-Type", count)
+		}
+
+		count++
+		if count == 5 {
+			break
+		}
+	}
+
+	// The reader can still be used after breaking out of the loop
+	for _, err := range reader.RecordsOnDisk() {
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		count++
+	}
+
+	if count != 19 {
+		t.Errorf("expected 19 records, got %d", count)
+	}
+}
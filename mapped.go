@@ -0,0 +1,99 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// MappedFile gives random access to a local WARC file, e.g. for replay.
+// The file is memory-mapped when the platform supports it, so that
+// records are read without read system calls, it is read with ReadAt
+// otherwise. It is safe for concurrent use.
+type MappedFile struct {
+	file *os.File
+	data []byte
+	size int64
+}
+
+// OpenMapped opens the WARC file at path, memory-mapping
+// it if the platform supports it.
+func OpenMapped(path string) (*MappedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f := &MappedFile{file: file, size: info.Size()}
+
+	// Fall back to ReadAt if the file can't be mapped
+	if f.size > 0 && int64(int(f.size)) == f.size {
+		if data, err := mmapFile(file, f.size); err == nil {
+			f.data = data
+		}
+	}
+
+	return f, nil
+}
+
+// Mapped returns true if the file is memory-mapped.
+func (f *MappedFile) Mapped() bool {
+	return f.data != nil
+}
+
+// Size returns the size of the file.
+func (f *MappedFile) Size() int64 {
+	return f.size
+}
+
+// Open returns a Reader reading the records of the file from offset,
+// e.g. the offset of a record found in an index.
+func (f *MappedFile) Open(offset int64) (*Reader, error) {
+	if offset > f.size {
+		offset = f.size
+	}
+
+	if f.data != nil {
+		return NewReader(bytes.NewReader(f.data[offset:]))
+	}
+
+	return NewReader(io.NewSectionReader(f.file, offset, f.size-offset))
+}
+
+// ReadAt reads len(p) bytes of the file starting at offset off.
+func (f *MappedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.data == nil {
+		return f.file.ReadAt(p, off)
+	}
+
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	n = copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Close unmaps and closes the file, the Readers
+// returned by Open can't be used anymore.
+func (f *MappedFile) Close() error {
+	if f.data != nil {
+		if err := munmapFile(f.data); err != nil {
+			f.file.Close()
+			return err
+		}
+		f.data = nil
+	}
+
+	return f.file.Close()
+}
@@ -0,0 +1,45 @@
+package warc
+
+import (
+	"io"
+	"testing"
+)
+
+// Tests for the MappedFile type
+func TestMappedFile(t *testing.T) {
+	index, err := IndexFiles([]string{"testdata/test.warc.gz"})
+	if err != nil {
+		t.Fatalf("failed to index WARC file: %v", err)
+	}
+	captures := index.Captures("https://www.google.com/")
+
+	file, err := OpenMapped("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open mapped file: %v", err)
+	}
+	defer file.Close()
+
+	for _, capture := range captures {
+		reader, err := file.Open(capture.Offset)
+		if err != nil {
+			t.Fatalf("failed to open reader at %d: %v", capture.Offset, err)
+		}
+
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("failed to read record at %d: %v", capture.Offset, err)
+		}
+		reader.Close()
+
+		if record.Header.Get("WARC-Record-ID") != capture.RecordID {
+			t.Errorf("expected record %s, got %s", capture.RecordID, record.Header.Get("WARC-Record-ID"))
+		}
+	}
+
+	// Read the whole file, to check its end
+	data := make([]byte, file.Size()+1)
+	n, err := file.ReadAt(data, 0)
+	if err != io.EOF || int64(n) != file.Size() {
+		t.Errorf("expected %d bytes and io.EOF, got %d bytes and %v", file.Size(), n, err)
+	}
+}
@@ -0,0 +1,127 @@
+package warc
+
+import (
+	"errors"
+	"io"
+)
+
+// MemberWriter wraps an io.Writer and compresses the data written between
+// each Begin and End call as an independent gzip member or zstd frame, as
+// WARC files store one compressed member per record.
+// If compression is empty, the data is written as is.
+type MemberWriter struct {
+	// SkippableFrames makes the writer precede the zstd frame of each
+	// member by a skippable frame holding its compressed and decompressed
+	// sizes, so that the records of the file can be listed without
+	// decompressing them, see ReadRecordFrames. It is ignored by the
+	// other compression algorithms.
+	SkippableFrames bool
+
+	writer      io.Writer
+	compression string
+	codec       *compressionCodec
+	last        io.WriteCloser
+	member      io.WriteCloser
+	frame       *frameBuffer
+}
+
+// writerResetter is implemented by compression writers that
+// can be reused for a new stream, like gzip.Writer
+type writerResetter interface {
+	Reset(w io.Writer)
+}
+
+// nopWriteCloser adds a no-op Close method to an io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewMemberWriter creates a new MemberWriter writing to writer,
+// compression can be any registered compression algorithm or empty.
+func NewMemberWriter(writer io.Writer, compression string) (*MemberWriter, error) {
+	memberWriter := &MemberWriter{writer: writer, compression: compression}
+
+	if compression != CompressionNone {
+		codec, err := lookupCompression(compression)
+		if err != nil {
+			return nil, err
+		}
+		memberWriter.codec = &codec
+	}
+
+	return memberWriter, nil
+}
+
+// Begin starts a new member, all the data written until
+// the next call to End is compressed in that member.
+func (m *MemberWriter) Begin() error {
+	if m.member != nil {
+		return errors.New("Member already started")
+	}
+
+	if m.codec == nil {
+		m.member = nopWriteCloser{m.writer}
+		return nil
+	}
+
+	// The frame is compressed in memory, to write its
+	// size in the skippable frame preceding it
+	writer := m.writer
+	if m.SkippableFrames && m.compression == CompressionZSTD {
+		m.frame = new(frameBuffer)
+		writer = &m.frame.Buffer
+	}
+
+	// Reuse the previous member's compression writer if possible
+	if resetter, ok := m.last.(writerResetter); ok {
+		resetter.Reset(writer)
+		m.member = m.last
+		return nil
+	}
+
+	member, err := m.codec.newWriter(writer)
+	if err != nil {
+		return err
+	}
+	m.member = member
+	m.last = member
+
+	return nil
+}
+
+// Write writes p to the current member.
+func (m *MemberWriter) Write(p []byte) (n int, err error) {
+	if m.member == nil {
+		return 0, errors.New("Write outside of a member, Begin must be called first")
+	}
+	if m.frame != nil {
+		m.frame.size += int64(len(p))
+	}
+	return m.member.Write(p)
+}
+
+// End closes the current member, flushing the compressed data
+// to the underlying writer.
+func (m *MemberWriter) End() error {
+	if m.member == nil {
+		return errors.New("No member started")
+	}
+
+	err := m.member.Close()
+	m.member = nil
+
+	if m.frame != nil {
+		frame := m.frame
+		m.frame = nil
+		if err != nil {
+			return err
+		}
+		return writeRecordFrame(m.writer, frame.Bytes(), frame.size)
+	}
+
+	return err
+}
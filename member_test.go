@@ -0,0 +1,62 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// Tests for the MemberWriter methods
+func TestMemberWriter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	memberWriter, err := NewMemberWriter(buffer, "GZIP")
+	if err != nil {
+		t.Fatalf("failed to create member writer: %v", err)
+	}
+
+	if _, err := memberWriter.Write([]byte("outside")); err == nil {
+		t.Error("expected an error when writing outside of a member")
+	}
+
+	for _, member := range []string{"first member", "second member"} {
+		if err := memberWriter.Begin(); err != nil {
+			t.Fatalf("failed to begin member: %v", err)
+		}
+		if _, err := io.WriteString(memberWriter, member); err != nil {
+			t.Fatalf("failed to write member: %v", err)
+		}
+		if err := memberWriter.End(); err != nil {
+			t.Fatalf("failed to end member: %v", err)
+		}
+	}
+
+	// Read the members one by one
+	gzipReader, err := gzip.NewReader(buffer)
+	if err != nil {
+		t.Fatalf("failed to create gzip reader: %v", err)
+	}
+
+	for _, member := range []string{"first member", "second member"} {
+		gzipReader.Multistream(false)
+
+		content, err := ioutil.ReadAll(gzipReader)
+		if err != nil {
+			t.Fatalf("failed to read member: %v", err)
+		}
+
+		if string(content) != member {
+			t.Errorf("expected %q, got %q", member, content)
+		}
+
+		if err := gzipReader.Reset(buffer); err != nil && err != io.EOF {
+			t.Fatalf("failed to reset gzip reader: %v", err)
+		}
+	}
+
+	if _, err := NewMemberWriter(buffer, "LZMA"); err == nil {
+		t.Error("expected an error for an invalid compression algorithm")
+	}
+}
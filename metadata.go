@@ -0,0 +1,95 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadataField is a field of a metadata record, fields
+// can be repeated, e.g. one outlink field per link
+type metadataField struct {
+	name  string
+	value string
+}
+
+// MetadataBuilder builds the metadata record of a capture, preserving its
+// crawl context as Heritrix does: the URL it was discovered from, its
+// path from the seed, its fetch timing and its outlinks. The fields are
+// written in the order they are added.
+type MetadataBuilder struct {
+	capture *Record
+	fields  []metadataField
+}
+
+// NewMetadataBuilder returns a builder of the metadata record of
+// capture, which must have its WARC-Record-ID set for the metadata
+// record to refer to it.
+func NewMetadataBuilder(capture *Record) *MetadataBuilder {
+	return &MetadataBuilder{capture: capture}
+}
+
+// Field adds a field to the metadata record, whatever its name
+func (b *MetadataBuilder) Field(name string, value string) *MetadataBuilder {
+	b.fields = append(b.fields, metadataField{name: name, value: value})
+	return b
+}
+
+// Via adds the URL the capture was discovered from
+func (b *MetadataBuilder) Via(url string) *MetadataBuilder {
+	return b.Field("via", url)
+}
+
+// HopsFromSeed adds the path from the seed to the capture, one letter
+// per hop in Heritrix's notation, e.g. "LLE" for two links and an
+// embedded resource, empty for the seed itself
+func (b *MetadataBuilder) HopsFromSeed(hops string) *MetadataBuilder {
+	return b.Field("hopsFromSeed", hops)
+}
+
+// FetchTime adds the time the capture took to be fetched
+func (b *MetadataBuilder) FetchTime(duration time.Duration) *MetadataBuilder {
+	return b.Field("fetchTimeMs", strconv.FormatInt(int64(duration/time.Millisecond), 10))
+}
+
+// Outlinks adds the links found in the capture
+func (b *MetadataBuilder) Outlinks(urls ...string) *MetadataBuilder {
+	for _, url := range urls {
+		b.Field("outlink", url)
+	}
+	return b
+}
+
+// Record returns the metadata record, an application/warc-fields
+// record referring to the capture with WARC-Refers-To
+func (b *MetadataBuilder) Record() (*Record, error) {
+	recordID := b.capture.Header.Get("WARC-Record-ID")
+	if recordID == "" {
+		return nil, errors.New("Capture needs a WARC-Record-ID to be referred to")
+	}
+
+	content := new(bytes.Buffer)
+	for _, field := range b.fields {
+		value := strings.Replace(field.value, "\r\n", "\n", -1)
+		value = strings.Replace(value, "\n", "\r\n ", -1)
+
+		if _, err := io.WriteString(content, field.name+": "+value+"\r\n"); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := NewRecord()
+	metadata.Header.Set("WARC-Type", "metadata")
+	metadata.Header.Set("WARC-Target-URI", b.capture.Header.Get("WARC-Target-URI"))
+	metadata.Header.Set("WARC-Refers-To", recordID)
+	metadata.Header.Set("Content-Type", "application/warc-fields")
+	if date := b.capture.Header.Get("WARC-Date"); date != "" {
+		metadata.Header.Set("WARC-Date", date)
+	}
+	metadata.Content = content
+
+	return metadata, nil
+}
@@ -0,0 +1,65 @@
+package warc
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for the MetadataBuilder methods
+func TestMetadataBuilder(t *testing.T) {
+	capture := NewRecord()
+	capture.Header.Set("WARC-Type", "response")
+	capture.Header.Set("WARC-Target-URI", "http://example.com/")
+	capture.Header.Set("WARC-Date", "2020-12-21T23:58:40Z")
+
+	builder := NewMetadataBuilder(capture).
+		Via("http://example.org/").
+		HopsFromSeed("LE").
+		FetchTime(1500*time.Millisecond).
+		Outlinks("http://example.com/a", "http://example.com/b").
+		Field("note", "first line\nsecond line")
+
+	if _, err := builder.Record(); err == nil {
+		t.Errorf("expected an error for a capture without record ID")
+	}
+
+	capture.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000000>")
+	metadata, err := builder.Record()
+	if err != nil {
+		t.Fatalf("failed to build metadata record: %v", err)
+	}
+
+	// The record ID is set when the record is written
+	metadata.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000001>")
+	if err := metadata.Validate(); err != nil {
+		t.Errorf("expected a valid metadata record, got %v", err)
+	}
+
+	if metadata.RefersTo().RecordID != capture.Header.Get("WARC-Record-ID") ||
+		metadata.Header.Get("WARC-Target-URI") != "http://example.com/" ||
+		metadata.Header.Get("WARC-Date") != "2020-12-21T23:58:40Z" {
+		t.Errorf("expected the metadata record to refer to the capture, got %v", metadata.Header)
+	}
+
+	content, err := ioutil.ReadAll(metadata.Content)
+	if err != nil {
+		t.Fatalf("failed to read metadata record: %v", err)
+	}
+
+	expected := "via: http://example.org/\r\n" +
+		"hopsFromSeed: LE\r\n" +
+		"fetchTimeMs: 1500\r\n" +
+		"outlink: http://example.com/a\r\n" +
+		"outlink: http://example.com/b\r\n" +
+		"note: first line\r\n second line\r\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+
+	fields, err := ParseWarcFields(strings.NewReader(string(content)))
+	if err != nil || fields.Get("hopsFromSeed") != "LE" {
+		t.Errorf("expected the fields to be parsed back, got %v, %v", fields, err)
+	}
+}
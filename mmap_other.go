@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package warc
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile isn't supported on this platform
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("Memory mapping isn't supported on this platform")
+}
+
+// munmapFile isn't supported on this platform
+func munmapFile(data []byte) error {
+	return nil
+}
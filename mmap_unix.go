@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package warc
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the size first bytes of file in memory, read-only
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile unmaps data mapped by mmapFile
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,197 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// contentRange is a range of a 206 Partial Content response
+type contentRange struct {
+	record *Record
+	start  int64
+	end    int64
+	total  int64
+	body   []byte
+	header http.Header
+}
+
+// parseContentRange parses a Content-Range header value of the form
+// "bytes start-end/total", the total length must be known
+func parseContentRange(value string) (start int64, end int64, total int64, err error) {
+	malformed := errors.New("Malformed Content-Range: " + value)
+
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, 0, malformed
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(value[len("bytes "):]), "/", 2)
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(parts) != 2 || len(bounds) != 2 {
+		return 0, 0, 0, malformed
+	}
+
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, 0, malformed
+	}
+	if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+		return 0, 0, 0, malformed
+	}
+	if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, 0, errors.New("Content-Range without total length: " + value)
+	}
+
+	if start < 0 || end < start || end >= total {
+		return 0, 0, 0, malformed
+	}
+
+	return start, end, total, nil
+}
+
+// readContentRange reads the range stored in a 206 response record
+func readContentRange(record *Record) (*contentRange, error) {
+	if record.Header.Get("WARC-Type") != "response" {
+		return nil, errors.New("Not a response record: " + record.Header.Get("WARC-Record-ID"))
+	}
+
+	block, err := record.blockReader()
+	if err != nil {
+		return nil, err
+	}
+	defer block.Close()
+
+	resp, err := readHTTPResponse(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, errors.New("Not a 206 Partial Content response: " + record.Header.Get("WARC-Record-ID"))
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "multipart/byteranges" {
+		return nil, errors.New("Multipart ranges aren't supported: " + record.Header.Get("WARC-Record-ID"))
+	}
+
+	r := &contentRange{record: record, header: resp.Header}
+	r.start, r.end, r.total, err = parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+
+	r.body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(r.body)) != r.end-r.start+1 {
+		return nil, errors.New("Range " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.end, 10) +
+			" has " + strconv.Itoa(len(r.body)) + " bytes: " + record.Header.Get("WARC-Record-ID"))
+	}
+
+	return r, nil
+}
+
+// AssemblePartialContent reconstructs a complete resource from the records
+// of 206 Partial Content responses of the same URL, e.g. captures of a
+// video read by ranges, so that it can be replayed. The ranges are sorted,
+// they must cover the whole resource, and the overlapping ones must agree.
+// The responses must have the same validators, ETag and Last-Modified, so
+// that the ranges are parts of the same entity.
+// The resource is returned as a conversion record of the first range's
+// record, its block being the entity body with the HTTP Content-Type.
+// The record contents can still be read from the start afterwards.
+func AssemblePartialContent(records []*Record) (*Record, error) {
+	if len(records) == 0 {
+		return nil, errors.New("No partial content record to assemble")
+	}
+
+	var ranges []*contentRange
+	for _, record := range records {
+		r, err := readContentRange(record)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	first := ranges[0]
+	targetURI := first.record.Header.Get("WARC-Target-URI")
+	date := first.record.Header.Get("WARC-Date")
+
+	// The total length is untrusted, the body can't be
+	// longer than the ranges it is assembled from
+	var size int64
+	for _, r := range ranges {
+		size += int64(len(r.body))
+	}
+	if first.total < size {
+		size = first.total
+	}
+
+	body := make([]byte, 0, size)
+	for _, r := range ranges {
+		if r.record.Header.Get("WARC-Target-URI") != targetURI {
+			return nil, errors.New("Ranges of different URLs: " + targetURI + " and " + r.record.Header.Get("WARC-Target-URI"))
+		}
+
+		if r.total != first.total {
+			return nil, errors.New("Ranges of different total lengths for " + targetURI)
+		}
+
+		for _, validator := range []string{"ETag", "Last-Modified"} {
+			if r.header.Get(validator) != first.header.Get(validator) {
+				return nil, errors.New("Ranges with different " + validator + " for " + targetURI)
+			}
+		}
+
+		if r.start > int64(len(body)) {
+			return nil, errors.New("Missing bytes " + strconv.Itoa(len(body)) + "-" + strconv.FormatInt(r.start-1, 10) + " of " + targetURI)
+		}
+
+		// The overlapping bytes must be the same
+		overlap := int64(len(body)) - r.start
+		if overlap > int64(len(r.body)) {
+			overlap = int64(len(r.body))
+		}
+		if !bytes.Equal(body[r.start:r.start+overlap], r.body[:overlap]) {
+			return nil, errors.New("Overlapping ranges differ for " + targetURI)
+		}
+		body = append(body, r.body[overlap:]...)
+
+		// The resource is dated by its last range
+		if r.record.Header.Get("WARC-Date") > date {
+			date = r.record.Header.Get("WARC-Date")
+		}
+	}
+
+	if int64(len(body)) != first.total {
+		return nil, errors.New("Missing bytes " + strconv.Itoa(len(body)) + "-" + strconv.FormatInt(first.total-1, 10) + " of " + targetURI)
+	}
+
+	conversion := NewRecord()
+	conversion.Header.Set("WARC-Type", "conversion")
+	conversion.Header.Set("WARC-Target-URI", targetURI)
+	if date != "" {
+		conversion.Header.Set("WARC-Date", date)
+	}
+	if recordID := first.record.Header.Get("WARC-Record-ID"); recordID != "" {
+		conversion.Header.Set("WARC-Refers-To", recordID)
+	}
+	if contentType := first.header.Get("Content-Type"); contentType != "" {
+		conversion.Header.Set("Content-Type", contentType)
+	}
+	conversion.Content = bytes.NewReader(body)
+
+	return conversion, nil
+}
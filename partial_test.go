@@ -0,0 +1,78 @@
+package warc
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newPartialRecord returns the record of a 206 response with
+// the bytes start to end of body
+func newPartialRecord(body string, start int, end int, etag string) *Record {
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Header.Set("WARC-Target-URI", "http://example.com/video.mp4")
+	record.Header.Set("WARC-Date", "2021-05-04T10:11:1"+strconv.Itoa(start%10)+"Z")
+	record.Header.Set("WARC-Record-ID", "<urn:uuid:"+strconv.Itoa(start)+">")
+	record.Content = strings.NewReader("HTTP/1.1 206 Partial Content\r\nContent-Type: video/mp4\r\nETag: " + etag + "\r\n" +
+		"Content-Range: bytes " + strconv.Itoa(start) + "-" + strconv.Itoa(end) + "/" + strconv.Itoa(len(body)) + "\r\n" +
+		"Content-Length: " + strconv.Itoa(end-start+1) + "\r\n\r\n" + body[start:end+1])
+	return record
+}
+
+// Tests for the AssemblePartialContent function
+func TestAssemblePartialContent(t *testing.T) {
+	body := "0123456789abcdefghij"
+
+	// Unordered and overlapping ranges
+	conversion, err := AssemblePartialContent([]*Record{
+		newPartialRecord(body, 12, 19, `"v1"`),
+		newPartialRecord(body, 0, 7, `"v1"`),
+		newPartialRecord(body, 5, 13, `"v1"`),
+	})
+	if err != nil {
+		t.Fatalf("failed to assemble ranges: %v", err)
+	}
+
+	content, err := ioutil.ReadAll(conversion.Content)
+	if err != nil {
+		t.Fatalf("failed to read assembled content: %v", err)
+	}
+
+	if string(content) != body {
+		t.Errorf("expected %q, got %q", body, content)
+	}
+
+	if conversion.Header.Get("WARC-Type") != "conversion" || conversion.Header.Get("WARC-Refers-To") != "<urn:uuid:0>" ||
+		conversion.Header.Get("Content-Type") != "video/mp4" || conversion.Header.Get("WARC-Target-URI") != "http://example.com/video.mp4" {
+		t.Errorf("unexpected header %v", conversion.Header)
+	}
+
+	for name, records := range map[string][]*Record{
+		"gap":        {newPartialRecord(body, 0, 7, `"v1"`), newPartialRecord(body, 9, 19, `"v1"`)},
+		"incomplete": {newPartialRecord(body, 0, 7, `"v1"`), newPartialRecord(body, 8, 15, `"v1"`)},
+		"etag":       {newPartialRecord(body, 0, 9, `"v1"`), newPartialRecord(body, 10, 19, `"v2"`)},
+		"overlap":    {newPartialRecord(body, 0, 12, `"v1"`), newPartialRecord(strings.ToUpper(body), 10, 19, `"v1"`)},
+		"empty":      nil,
+	} {
+		if _, err := AssemblePartialContent(records); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// A bogus total length isn't allocated
+	huge := newPartialRecord(body, 0, 9, `"v1"`)
+	huge.Content = strings.NewReader("HTTP/1.1 206 Partial Content\r\nContent-Range: bytes 0-9/9223372036854775806\r\n" +
+		"Content-Length: 10\r\n\r\n" + body[:10])
+	if _, err := AssemblePartialContent([]*Record{huge}); err == nil {
+		t.Error("expected an error for a huge total length")
+	}
+
+	full := NewRecord()
+	full.Header.Set("WARC-Type", "response")
+	full.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\n" + body)
+	if _, err := AssemblePartialContent([]*Record{full}); err == nil {
+		t.Error("expected an error for a 200 response")
+	}
+}
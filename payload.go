@@ -0,0 +1,324 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PayloadDigests are the digests of the payload of a record
+type PayloadDigests struct {
+	// Payload is the digest of the entity body as stored, i.e. with
+	// its transfer encoding removed but its content encoding kept,
+	// as defined for WARC-Payload-Digest
+	Payload string
+	// Decoded is the digest of the entity body with its content encoding
+	// removed too, so that payloads sent with different encodings can be
+	// deduplicated. It is the same as Payload if the payload isn't
+	// encoded, and empty if the encoding isn't supported.
+	Decoded string
+}
+
+// NewContentDecoderFunc returns a reader decoding the
+// HTTP content encoded data read from r
+type NewContentDecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	contentDecodersMu sync.RWMutex
+	// contentDecoders decode the supported HTTP content encodings
+	contentDecoders = map[string]NewContentDecoderFunc{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+)
+
+// RegisterContentDecoder registers a decoder for an HTTP content encoding,
+// e.g. "br" with a Brotli decoder, so that the payloads using it can be
+// decoded by PayloadDigests. gzip, deflate and, unless building with the
+// nozstd tag, zstd are supported out of the box. Registering an already registered encoding replaces it.
+func RegisterContentDecoder(encoding string, newDecoder NewContentDecoderFunc) error {
+	if encoding == "" || newDecoder == nil {
+		return errors.New("Content decoder needs an encoding and a decoder")
+	}
+
+	contentDecodersMu.Lock()
+	defer contentDecodersMu.Unlock()
+
+	contentDecoders[strings.ToLower(encoding)] = newDecoder
+
+	return nil
+}
+
+// lookupContentDecoder returns the decoder of an HTTP content encoding
+func lookupContentDecoder(encoding string) (NewContentDecoderFunc, bool) {
+	contentDecodersMu.RLock()
+	defer contentDecodersMu.RUnlock()
+
+	newDecoder, ok := contentDecoders[encoding]
+	return newDecoder, ok
+}
+
+// PayloadDigests computes the SHA1 digests of the payload of a response
+// or resource record, the payload of a resource record being its block.
+// The record content can still be read from the start afterwards.
+func (r *Record) PayloadDigests() (*PayloadDigests, error) {
+	return r.payloadDigests(DigestSHA1)
+}
+
+// payloadDigests computes the digests of the payload
+// with a registered digest algorithm
+func (r *Record) payloadDigests(algorithm string) (*PayloadDigests, error) {
+	newHash, err := lookupDigestAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	warcType := r.Header.Get("WARC-Type")
+	if warcType != "response" && warcType != "resource" {
+		return nil, errors.New("Record has no payload: " + warcType)
+	}
+
+	block, err := r.blockReader()
+	if err != nil {
+		return nil, err
+	}
+	defer block.Close()
+
+	if warcType == "resource" {
+		digest, err := computeDigest(algorithm, block)
+		if err != nil {
+			return nil, err
+		}
+		return &PayloadDigests{Payload: digest, Decoded: digest}, nil
+	}
+
+	resp, err := readHTTPResponse(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body has to be read twice, it is spooled on disk
+	// as it may be large
+	body, err := ioutil.TempFile("", "warc-payload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+
+	hash := newHash()
+	if _, err := io.Copy(io.MultiWriter(hash, body), resp.Body); err != nil {
+		return nil, err
+	}
+
+	digests := &PayloadDigests{Payload: formatDigest(algorithm, hash.Sum(nil))}
+
+	encodings := contentEncodings(resp.Header)
+	if len(encodings) == 0 {
+		digests.Decoded = digests.Payload
+		return digests, nil
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	decoded, err := decodeContent(body, encodings)
+	if err != nil {
+		return digests, nil
+	}
+	defer decoded.Close()
+
+	if digest, err := computeDigest(algorithm, decoded); err == nil {
+		digests.Decoded = digest
+	}
+
+	return digests, nil
+}
+
+// contentEncodings returns the content encodings of an HTTP message,
+// in the order they were applied
+func contentEncodings(header http.Header) []string {
+	var encodings []string
+
+	for _, value := range header["Content-Encoding"] {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding != "" && encoding != "identity" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+
+	return encodings
+}
+
+// decodeContent removes the content encodings from
+// a body, starting with the last one applied
+func decodeContent(body io.Reader, encodings []string) (io.ReadCloser, error) {
+	decoded := ioutil.NopCloser(body)
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		newDecoder, ok := lookupContentDecoder(encodings[i])
+		if !ok {
+			decoded.Close()
+			return nil, errors.New("Unsupported content encoding: " + encodings[i])
+		}
+
+		decoder, err := newDecoder(decoded)
+		if err != nil {
+			decoded.Close()
+			return nil, err
+		}
+		decoded = decoder
+	}
+
+	return decoded, nil
+}
+
+// blockReader returns a reader of the record's block, without
+// consuming the record content
+func (r *Record) blockReader() (io.ReadCloser, error) {
+	if r.PayloadPath != "" {
+		return os.Open(r.PayloadPath)
+	}
+
+	block, err := readBlock(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(block)), nil
+}
+
+// decodedPayload returns the media type and the payload of a response or
+// resource record, decoded from its content encoding. The payload is nil
+// if the record has none or if it can't be decoded. The record content
+// can still be read from the start afterwards.
+func (r *Record) decodedPayload() (string, io.ReadCloser, error) {
+	warcType := r.Header.Get("WARC-Type")
+	if warcType != "response" && warcType != "resource" {
+		return "", nil, nil
+	}
+
+	block, err := r.blockReader()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if warcType == "resource" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		return mediaType, block, nil
+	}
+
+	resp, err := readHTTPResponse(block)
+	if err != nil {
+		block.Close()
+		return "", nil, nil
+	}
+
+	decoded, err := decodeContent(resp.Body, contentEncodings(resp.Header))
+	if err != nil {
+		block.Close()
+		return "", nil, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	return mediaType, &payloadReader{Reader: decoded, closers: []io.Closer{decoded, resp.Body, block}}, nil
+}
+
+// DeclaredContentLengthField is set by Writer on the response records
+// whose HTTP payload is shorter or longer than the Content-Length declared
+// by the server, to the declared Content-Length. The record stores the
+// bytes actually received.
+const DeclaredContentLengthField = "WARC-Declared-Content-Length"
+
+// readHTTPResponse reads the HTTP response stored in a block. Unless it is
+// chunked, its body is made of the bytes actually stored, whatever the
+// Content-Length declared, as servers sometimes send more or fewer bytes.
+func readHTTPResponse(block io.Reader) (*http.Response, error) {
+	reader := bufio.NewReader(block)
+
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.TransferEncoding) == 0 {
+		resp.Body = ioutil.NopCloser(reader)
+	}
+
+	return resp, nil
+}
+
+// annotateContentLength sets the DeclaredContentLengthField of a response
+// record if the size of the HTTP payload stored in block differs from the
+// declared Content-Length. The responses without a body, to a request whose
+// method is given or because of their status code, aren't annotated.
+func annotateContentLength(r *Record, block io.Reader, method string) error {
+	if r.Header.Get("WARC-Type") != "response" {
+		return nil
+	}
+
+	resp, err := readHTTPResponse(block)
+	if err != nil || resp.ContentLength < 0 || len(resp.TransferEncoding) > 0 {
+		// Not an HTTP response, or one without Content-Length
+		return nil
+	}
+	defer resp.Body.Close()
+
+	size, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// The responses to HEAD requests, and the 1xx, 204 and 304 ones,
+	// declare the Content-Length of a body they don't have
+	if size == 0 && (method == http.MethodHead || !bodyAllowed(resp.StatusCode)) {
+		return nil
+	}
+
+	if size != resp.ContentLength {
+		r.Header.Set(DeclaredContentLengthField, strconv.FormatInt(resp.ContentLength, 10))
+	}
+
+	return nil
+}
+
+// bodyAllowed returns whether a response with status
+// can have a body, as defined by RFC 7230
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// payloadReader is a decoded payload, closing
+// all the readers it's read from when closed
+type payloadReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (p *payloadReader) Close() error {
+	for _, closer := range p.closers {
+		closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Tests for the Record.PayloadDigests method
+func TestRecordPayloadDigests(t *testing.T) {
+	body := "Hello, World!"
+
+	compressed := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(compressed)
+	gzipWriter.Write([]byte(body))
+	gzipWriter.Close()
+
+	plain := NewRecord()
+	plain.Header.Set("WARC-Type", "response")
+	plain.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\n" + body)
+
+	encoded := NewRecord()
+	encoded.Header.Set("WARC-Type", "response")
+	encoded.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"a\r\n" + compressed.String()[:10] + "\r\n" +
+		strconv.FormatInt(int64(compressed.Len()-10), 16) + "\r\n" + compressed.String()[10:] + "\r\n0\r\n\r\n")
+
+	plainDigests, err := plain.PayloadDigests()
+	if err != nil {
+		t.Fatalf("failed to compute payload digests: %v", err)
+	}
+
+	if plainDigests.Payload != "sha1:"+GetSHA1([]byte(body)) || plainDigests.Decoded != plainDigests.Payload {
+		t.Errorf("unexpected digests %+v", plainDigests)
+	}
+
+	encodedDigests, err := encoded.PayloadDigests()
+	if err != nil {
+		t.Fatalf("failed to compute payload digests: %v", err)
+	}
+
+	if encodedDigests.Payload != "sha1:"+GetSHA1(compressed.Bytes()) {
+		t.Errorf("expected the payload digest of the gzipped body, got %s", encodedDigests.Payload)
+	}
+
+	if encodedDigests.Decoded != plainDigests.Decoded {
+		t.Errorf("expected decoded digest %s, got %s", plainDigests.Decoded, encodedDigests.Decoded)
+	}
+}
+
+// Tests the decoding of registered content encodings
+func TestRecordPayloadDigestsContentDecoders(t *testing.T) {
+	body := "Hello, World!"
+	expected := "sha1:" + GetSHA1([]byte(body))
+
+	// An encoding reversing the body, to check that registered decoders are used
+	err := RegisterContentDecoder("x-reverse", func(r io.Reader) (io.ReadCloser, error) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register content decoder: %v", err)
+	}
+
+	encoded := "!dlroW ,olleH"
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Encoding: X-Reverse\r\n" +
+		"Content-Length: " + strconv.Itoa(len(encoded)) + "\r\n\r\n" + encoded)
+
+	digests, err := record.PayloadDigests()
+	if err != nil {
+		t.Fatalf("failed to compute payload digests: %v", err)
+	}
+
+	if digests.Decoded != expected {
+		t.Errorf("expected decoded digest %s, got %s", expected, digests.Decoded)
+	}
+}
+
+// Tests the records of responses from origins sending more or
+// fewer bytes than the Content-Length they declare
+func TestContentLengthMismatch(t *testing.T) {
+	body := "Hello, World!"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: "+r.URL.Query().Get("length")+"\r\n\r\n"+body)
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		length   string
+		declared string
+	}{
+		{"13", ""},
+		{"5", "5"},
+		{"100", "100"},
+	} {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect to server: %v", err)
+		}
+		io.WriteString(conn, "GET /?length="+test.length+" HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		response, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = bytes.NewReader(response)
+
+		digests, err := record.PayloadDigests()
+		if err != nil {
+			t.Fatalf("failed to compute payload digests with Content-Length %s: %v", test.length, err)
+		}
+
+		if digests.Payload != "sha1:"+GetSHA1([]byte(body)) {
+			t.Errorf("expected the digest of the bytes received with Content-Length %s, got %s", test.length, digests.Payload)
+		}
+
+		writer, err := NewWriter(ioutil.Discard, "test.warc", "")
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+
+		if record.Header.Get(DeclaredContentLengthField) != test.declared {
+			t.Errorf("expected declared Content-Length %q, got %q", test.declared, record.Header.Get(DeclaredContentLengthField))
+		}
+
+		if record.Header.Get("Content-Length") != strconv.Itoa(len(response)) {
+			t.Errorf("expected the record to store the %d bytes received, got %s", len(response), record.Header.Get("Content-Length"))
+		}
+	}
+}
+
+// Tests that the responses without a body, because of the method of
+// their request or their status code, aren't annotated with the
+// Content-Length they declare
+func TestContentLengthBodyless(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		status   string
+		method   string
+		declared string
+	}{
+		{"HEAD", "200 OK", http.MethodHead, ""},
+		{"GET", "200 OK", http.MethodGet, "1234"},
+		{"304", "304 Not Modified", "", ""},
+		{"204", "204 No Content", "", ""},
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader("HTTP/1.1 " + test.status + "\r\nContent-Length: 1234\r\n\r\n")
+
+		writer, err := NewWriter(ioutil.Discard, "test.warc", "")
+		if err != nil {
+			t.Fatalf("failed to create writer: %v", err)
+		}
+
+		if _, err := writer.WriteRecord(record, RequestMethod(test.method)); err != nil {
+			t.Fatalf("%s: failed to write record: %v", test.name, err)
+		}
+
+		if record.Header.Get(DeclaredContentLengthField) != test.declared {
+			t.Errorf("%s: expected declared Content-Length %q, got %q", test.name, test.declared, record.Header.Get(DeclaredContentLengthField))
+		}
+	}
+}
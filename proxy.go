@@ -0,0 +1,765 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// hopHeaders are the HTTP header fields meaningful for a single
+// connection, they aren't forwarded by the proxy
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is an HTTP forward proxy writing the requests passing through it
+// and their responses to WARC files, so that the traffic of browsers or
+// tools that can't use this package is archived. HTTPS requests are
+// intercepted with a certificate generated for each host and signed by
+// CA, which the clients have to trust. Proxy is an http.Handler, to be
+// served with an http.Server.
+type Proxy struct {
+	// CA signs the certificates of the intercepted HTTPS hosts, see
+	// NewProxyCA. If nil, HTTPS traffic is tunnelled without being
+	// recorded.
+	CA *tls.Certificate
+	// Transport sends the requests to the origin servers. By default, it
+	// is a copy of http.DefaultTransport not asking for compressed
+	// responses, so that the responses are recorded as the origin
+	// servers send them to the clients. The requests are sent with a copy
+	// of it dialing the connections itself, so that the exchanges are
+	// recorded with the bytes sent and received: each connection holds a
+	// single HTTP/1.1 exchange, and no proxy is used.
+	Transport *http.Transport
+	// Metadata, if set, is called for each exchange recorded with the
+	// builder of the metadata record of its response, holding the fetch
+	// time and the referrer of the request, to add the crawl context
+	// known to the client, e.g. its outlinks or its hops from the seed.
+	// The metadata record is written with the exchange, once the
+	// response body has been passed to the client.
+	Metadata func(req *http.Request, resp *http.Response, metadata *MetadataBuilder)
+
+	mu      sync.RWMutex
+	closed  bool
+	records chan *RecordBatch
+	done    chan bool
+	pending sync.WaitGroup
+
+	errMu sync.Mutex
+	err   error
+
+	transportMu sync.Mutex
+	transport   *http.Transport
+	transportOf *http.Transport
+
+	certsMu sync.Mutex
+	certs   map[string]*tls.Certificate
+}
+
+// NewProxy starts a rotator with settings and returns a Proxy
+// writing the exchanges it records to it. Close must be called
+// once the proxy is no longer served.
+func NewProxy(settings *RotatorSettings) (*Proxy, error) {
+	records, done, err := settings.NewWARCRotator()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+
+	return &Proxy{
+		Transport: transport,
+		records:   records,
+		done:      done,
+		certs:     make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Close stops recording and waits for the rotator to write the exchanges
+// already recorded, then to close its file. It returns the first error
+// recording an exchange, if any.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errors.New("Proxy already closed")
+	}
+	p.closed = true
+	close(p.records)
+	p.mu.Unlock()
+
+	if !<-p.done {
+		return errors.New("Rotator failed to write the recorded exchanges")
+	}
+	p.pending.Wait()
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	return p.err
+}
+
+// fail keeps the first error recording an exchange, returned by Close
+func (p *Proxy) fail(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// ServeHTTP forwards a proxied request to its origin server and
+// records it, CONNECT requests are intercepted if CA is set.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.connect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "Not a proxy request: "+r.RequestURI, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.exchange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	for _, key := range hopHeaders {
+		w.Header().Del(key)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// connect handles a CONNECT request, by intercepting the
+// HTTPS requests sent through it or tunnelling them as is
+func (p *Proxy) connect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection can't be hijacked", http.StatusInternalServerError)
+		return
+	}
+
+	var upstream net.Conn
+	if p.CA == nil {
+		var err error
+		upstream, err = net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	// The client may have sent data buffered by the server already
+	client := &bufferedConn{Conn: conn, reader: buffered.Reader}
+
+	if upstream != nil {
+		go io.Copy(upstream, client)
+		io.Copy(client, upstream)
+		return
+	}
+
+	host := r.URL.Hostname()
+	tlsConn := tls.Server(client, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return p.certificate(hello.ServerName)
+			}
+			return p.certificate(host)
+		},
+	})
+	defer tlsConn.Close()
+
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+
+		req.URL.Scheme = "https"
+		req.URL.Host = strings.TrimSuffix(r.Host, ":443")
+
+		resp, err := p.exchange(req)
+		if err != nil {
+			resp = &http.Response{
+				StatusCode: http.StatusBadGateway,
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     make(http.Header),
+				Body:       ioutil.NopCloser(strings.NewReader(err.Error())),
+				Close:      true,
+			}
+		} else {
+			// The connection to the client outlives the one to the origin server
+			for _, key := range hopHeaders {
+				resp.Header.Del(key)
+			}
+			resp.Close = req.Close
+		}
+
+		err = resp.Write(tlsConn)
+		resp.Body.Close()
+		if err != nil || resp.Close {
+			return
+		}
+	}
+}
+
+// exchange sends a request to its origin server, the exchange being
+// recorded once the body of the response returned has been closed
+func (p *Proxy) exchange(req *http.Request) (*http.Response, error) {
+	// The connection of the exchange and the IP
+	// address of the origin server are recorded too
+	var conn *recordingConn
+	var ipAddress string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if recording, ok := info.Conn.(*recordingConn); ok {
+				recording.claim()
+				conn = recording
+			}
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				ipAddress = host
+			}
+		},
+	}
+
+	outgoing := req.Clone(httptrace.WithClientTrace(req.Context(), trace))
+	outgoing.RequestURI = ""
+	for _, key := range hopHeaders {
+		outgoing.Header.Del(key)
+	}
+
+	start := time.Now()
+	resp, err := p.recordingTransport().RoundTrip(outgoing)
+	if err != nil {
+		if conn != nil {
+			conn.discard()
+		}
+		return nil, err
+	}
+
+	if conn == nil {
+		resp.Body.Close()
+		return nil, errors.New("Connection to " + req.URL.Host + " wasn't recorded")
+	}
+
+	resp.Body = &exchangeBody{
+		ReadCloser: resp.Body,
+		record: func(truncated string) {
+			p.record(outgoing, resp, conn, ipAddress, time.Since(start), truncated)
+		},
+	}
+
+	return resp, nil
+}
+
+// recordingTransport returns a copy of Transport whose
+// connections are recordingConns, one per exchange
+func (p *Proxy) recordingTransport() *http.Transport {
+	p.transportMu.Lock()
+	defer p.transportMu.Unlock()
+
+	if p.transport != nil && p.transportOf == p.Transport {
+		return p.transport
+	}
+
+	base := p.Transport
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	transport := base.Clone()
+	transport.Proxy = nil
+	transport.DisableKeepAlives = true
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newRecordingConn(conn)
+	}
+
+	// The TLS connections are recorded in clear
+	transport.DialTLS = func(network, addr string) (net.Conn, error) {
+		conn, err := dial(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := new(tls.Config)
+		if base.TLSClientConfig != nil {
+			config = base.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		config.NextProtos = nil
+
+		if base.TLSHandshakeTimeout > 0 {
+			conn.SetDeadline(time.Now().Add(base.TLSHandshakeTimeout))
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+
+		return newRecordingConn(tlsConn)
+	}
+
+	p.transport = transport
+	p.transportOf = p.Transport
+
+	return transport
+}
+
+// record sends the request and response records of an exchange, and its
+// metadata record if any, to the rotator. Their blocks are the bytes sent
+// and received on conn. The exchanges recorded once the proxy is closed
+// are dropped.
+func (p *Proxy) record(req *http.Request, resp *http.Response, conn *recordingConn, ipAddress string, fetchTime time.Duration, truncated string) {
+	requestPath, responsePath, err := conn.finish()
+	if err != nil {
+		p.fail(err)
+		return
+	}
+
+	targetURI := req.URL.String()
+
+	responseRecord := NewRecord()
+	responseRecord.Header.Set("WARC-Type", "response")
+	responseRecord.Header.Set("WARC-Record-ID", "<urn:uuid:"+uuid.NewV4().String()+">")
+	responseRecord.Header.Set("WARC-Target-URI", targetURI)
+	responseRecord.Header.Set("Content-Type", "application/http; msgtype=response")
+	if ipAddress != "" {
+		responseRecord.Header.Set("WARC-IP-Address", ipAddress)
+	}
+	if truncated != "" {
+		responseRecord.Header.Set("WARC-Truncated", truncated)
+	}
+	responseRecord.PayloadPath = responsePath
+
+	requestRecord := NewRecord()
+	requestRecord.Header.Set("WARC-Type", "request")
+	requestRecord.Header.Set("WARC-Target-URI", targetURI)
+	requestRecord.Header.Set("WARC-Concurrent-To", responseRecord.Header.Get("WARC-Record-ID"))
+	requestRecord.Header.Set("Content-Type", "application/http; msgtype=request")
+	requestRecord.PayloadPath = requestPath
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, responseRecord, requestRecord)
+
+	if p.Metadata != nil {
+		builder := NewMetadataBuilder(responseRecord).FetchTime(fetchTime)
+		if referer := req.Header.Get("Referer"); referer != "" {
+			builder.Via(referer)
+		}
+
+		p.Metadata(req, resp, builder)
+
+		if metadata, err := builder.Record(); err == nil {
+			batch.Records = append(batch.Records, metadata)
+		}
+	}
+
+	// The spools are removed once the rotator wrote them
+	batch.Done = make(chan bool, 1)
+	if err := p.send(batch); err != nil {
+		os.Remove(requestPath)
+		os.Remove(responsePath)
+		p.fail(err)
+		return
+	}
+
+	go func() {
+		defer p.pending.Done()
+
+		if !<-batch.Done {
+			p.fail(errors.New("Rotator failed to write the exchange of " + targetURI))
+		}
+		os.Remove(requestPath)
+		os.Remove(responsePath)
+	}()
+}
+
+// send sends a batch of records to the rotator, the batches whose
+// Done channel is set are waited for by Close
+func (p *Proxy) send(batch *RecordBatch) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errors.New("Proxy closed")
+	}
+
+	if batch.Done != nil {
+		p.pending.Add(1)
+	}
+	p.records <- batch
+	return nil
+}
+
+// RecordCacheHit records a request answered by an HTTP cache placed
+// before the proxy, with a response stored by original whose payload
+// digest is payloadDigest, as a revisit record, see NewCacheHitRecord.
+// The body of the cached response isn't read, and the request body
+// isn't recorded.
+func (p *Proxy) RecordCacheHit(req *http.Request, resp *http.Response, original RefersTo, payloadDigest string) error {
+	revisit, err := NewCacheHitRecord(req.URL.String(), responseHead(resp), original, payloadDigest)
+	if err != nil {
+		return err
+	}
+	revisit.Header.Set("WARC-Record-ID", "<urn:uuid:"+uuid.NewV4().String()+">")
+
+	request := req.Clone(req.Context())
+	request.Body = nil
+	request.ContentLength = 0
+
+	requestBlock := new(bytes.Buffer)
+	if err := request.Write(requestBlock); err != nil {
+		return err
+	}
+
+	requestRecord := NewRecord()
+	requestRecord.Header.Set("WARC-Type", "request")
+	requestRecord.Header.Set("WARC-Target-URI", req.URL.String())
+	requestRecord.Header.Set("WARC-Concurrent-To", revisit.Header.Get("WARC-Record-ID"))
+	requestRecord.Header.Set("Content-Type", "application/http; msgtype=request")
+	requestRecord.Content = bytes.NewReader(requestBlock.Bytes())
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, revisit, requestRecord)
+
+	return p.send(batch)
+}
+
+// responseHead returns the status line and the header
+// fields of an HTTP response, as sent by a server
+func responseHead(resp *http.Response) []byte {
+	status := resp.Status
+	if status == "" {
+		status = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+	}
+
+	head := new(bytes.Buffer)
+	head.WriteString("HTTP/" + strconv.Itoa(resp.ProtoMajor) + "." + strconv.Itoa(resp.ProtoMinor) + " " + status + "\r\n")
+	resp.Header.Write(head)
+	head.WriteString("\r\n")
+
+	return head.Bytes()
+}
+
+// certificate returns the certificate of an intercepted host,
+// signed by the CA, generating it on first use
+func (p *Proxy) certificate(host string) (*tls.Certificate, error) {
+	p.certsMu.Lock()
+	defer p.certsMu.Unlock()
+
+	if cert, ok := p.certs[host]; ok {
+		return cert, nil
+	}
+
+	ca := p.CA.Leaf
+	if ca == nil {
+		var err error
+		ca, err = x509.ParseCertificate(p.CA.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	template, err := certificateTemplate(host)
+	if err != nil {
+		return nil, err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, p.CA.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.Raw},
+		PrivateKey:  key,
+	}
+	p.certs[host] = cert
+
+	return cert, nil
+}
+
+// NewProxyCA generates a self-signed certificate authority valid for
+// a year, to be used as the CA of a Proxy. Its certificate, the first
+// of the chain, has to be trusted by the clients of the proxy.
+func NewProxyCA() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := certificateTemplate("WARC proxy CA")
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage |= x509.KeyUsageCertSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// certificateTemplate returns the template of a certificate
+// valid for a year, with a random serial number
+func certificateTemplate(commonName string) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+// bufferedConn is a connection whose first bytes
+// were already read in a buffer
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// exchangeBody is the body of a response passed to the client of the
+// proxy, its exchange is recorded once it is closed
+type exchangeBody struct {
+	io.ReadCloser
+	once   sync.Once
+	record func(truncated string)
+}
+
+// Close reads the rest of the body, so that the response
+// is recorded whole even if the client went away
+func (b *exchangeBody) Close() error {
+	_, err := io.Copy(ioutil.Discard, b.ReadCloser)
+	closeErr := b.ReadCloser.Close()
+
+	b.once.Do(func() {
+		var truncated string
+		if err != nil {
+			truncated = "disconnect"
+		}
+		b.record(truncated)
+	})
+
+	return closeErr
+}
+
+// recordingConn is a connection to an origin server spooling the bytes
+// written to it and read from it to temporary files, the blocks of the
+// request and response records of its exchange
+type recordingConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	request   *os.File
+	response  *os.File
+	recording bool
+	claimed   bool
+	err       error
+}
+
+// newRecordingConn returns a recordingConn wrapping conn,
+// which is closed if the spools can't be created
+func newRecordingConn(conn net.Conn) (net.Conn, error) {
+	request, err := ioutil.TempFile("", "warc-proxy-*")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	response, err := ioutil.TempFile("", "warc-proxy-*")
+	if err != nil {
+		request.Close()
+		os.Remove(request.Name())
+		conn.Close()
+		return nil, err
+	}
+
+	return &recordingConn{Conn: conn, request: request, response: response, recording: true}, nil
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.spool(c.response, p[:n])
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.spool(c.request, p[:n])
+	return n, err
+}
+
+// spool writes the bytes read or written to their spool, until the
+// exchange is finished, the first error being kept
+func (c *recordingConn) spool(file *os.File, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.recording && c.err == nil {
+		_, c.err = file.Write(p)
+	}
+}
+
+// claim marks the connection as used by an exchange,
+// which is in charge of its spools
+func (c *recordingConn) claim() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.claimed = true
+}
+
+// Close closes the connection, the spools of a
+// connection no exchange claimed are removed
+func (c *recordingConn) Close() error {
+	err := c.Conn.Close()
+
+	c.mu.Lock()
+	claimed := c.claimed
+	c.mu.Unlock()
+
+	if !claimed {
+		c.discard()
+	}
+	return err
+}
+
+// finish stops recording the connection and returns the paths of the
+// spools of the request and the response, removed if an error occurred
+func (c *recordingConn) finish() (request string, response string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.recording {
+		return "", "", errors.New("Exchange already recorded")
+	}
+	c.recording = false
+
+	for _, file := range []*os.File{c.request, c.response} {
+		if err := file.Close(); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+
+	if c.err != nil {
+		os.Remove(c.request.Name())
+		os.Remove(c.response.Name())
+		return "", "", c.err
+	}
+
+	return c.request.Name(), c.response.Name(), nil
+}
+
+// discard stops recording the connection and removes its spools
+func (c *recordingConn) discard() {
+	if request, response, err := c.finish(); err == nil {
+		os.Remove(request)
+		os.Remove(response)
+	}
+}
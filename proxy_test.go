@@ -0,0 +1,452 @@
+package warc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that the proxy records the HTTP and HTTPS exchanges passing through it
+func TestProxy(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-proxy-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello from "+r.URL.Path)
+	})
+	plainServer := httptest.NewServer(origin)
+	defer plainServer.Close()
+	tlsServer := httptest.NewTLSServer(origin)
+	defer tlsServer.Close()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	proxy, err := NewProxy(rotatorSettings)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	proxy.CA, err = NewProxyCA()
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	// The origin server's certificate is self-signed
+	transport := tlsServer.Client().Transport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	proxy.Transport = transport
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatalf("failed to parse proxy URL: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(proxy.CA.Leaf)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+
+	targets := []string{plainServer.URL + "/plain", tlsServer.URL + "/secure"}
+	for _, target := range targets {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("failed to get %s through the proxy: %v", target, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+
+		if expected := "Hello from " + target[strings.LastIndex(target, "/"):]; string(body) != expected {
+			t.Errorf("expected %q, got %q", expected, body)
+		}
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("failed to close proxy: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	recorded := make(map[string]string)
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(record.Content)
+		if err != nil {
+			t.Fatalf("failed to read record content: %v", err)
+		}
+		recorded[record.Header.Get("WARC-Type")+" "+record.Header.Get("WARC-Target-URI")] = string(content)
+	}
+
+	for _, target := range targets {
+		if response := recorded["response "+target]; !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(response, "Hello from "+target[strings.LastIndex(target, "/"):]) {
+			t.Errorf("expected the response of %s to be recorded, got %q", target, response)
+		}
+		if request := recorded["request "+target]; !strings.HasPrefix(request, "GET "+target[strings.LastIndex(target, "/"):]+" HTTP/1.1\r\n") {
+			t.Errorf("expected the request of %s to be recorded, got %q", target, request)
+		}
+	}
+}
+
+// Tests that the cache hits reported to the proxy are recorded as revisits
+func TestProxyRecordCacheHit(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-proxy-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	proxy, err := NewProxy(rotatorSettings)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/cached", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+	}
+	original := RefersTo{
+		RecordID:  "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000000>",
+		TargetURI: "http://example.com/cached",
+		Date:      "2020-12-21T23:58:40Z",
+	}
+	digest := "sha1:" + GetSHA1([]byte("Hello, World!"))
+
+	if err := proxy.RecordCacheHit(req, resp, original, ""); err == nil {
+		t.Errorf("expected an error without the payload digest of the original record")
+	}
+	if err := proxy.RecordCacheHit(req, resp, original, digest); err != nil {
+		t.Fatalf("failed to record cache hit: %v", err)
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("failed to close proxy: %v", err)
+	}
+
+	if err := proxy.RecordCacheHit(req, resp, original, digest); err == nil {
+		t.Errorf("expected an error once the proxy is closed")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var revisit, request *Record
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		switch record.Header.Get("WARC-Type") {
+		case "revisit":
+			revisit = record
+		case "request":
+			request = record
+		}
+		if revisit == record {
+			content, err := ioutil.ReadAll(record.Content)
+			if err != nil {
+				t.Fatalf("failed to read record content: %v", err)
+			}
+			if expected := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n"; string(content) != expected {
+				t.Errorf("expected the cached response head %q, got %q", expected, content)
+			}
+		}
+	}
+
+	if revisit == nil || request == nil {
+		t.Fatalf("expected a revisit and a request record, got %v and %v", revisit, request)
+	}
+	if revisit.RefersTo() != original || revisit.RevisitProfile() != ProfileIdenticalPayloadDigest10 || revisit.Header.Get("WARC-Payload-Digest") != digest {
+		t.Errorf("expected a revisit of the original record, got %v", revisit.Header)
+	}
+	if request.Header.Get("WARC-Concurrent-To") != revisit.Header.Get("WARC-Record-ID") {
+		t.Errorf("expected the request to be concurrent to the revisit, got %s", request.Header.Get("WARC-Concurrent-To"))
+	}
+}
+
+// Tests that the proxy writes the metadata records of the exchanges
+func TestProxyMetadata(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-proxy-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<a href="/next">next</a>`)
+	}))
+	defer origin.Close()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	proxy, err := NewProxy(rotatorSettings)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+	proxy.Metadata = func(req *http.Request, resp *http.Response, metadata *MetadataBuilder) {
+		metadata.HopsFromSeed("L").Outlinks(origin.URL + "/next")
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatalf("failed to parse proxy URL: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	req, err := http.NewRequest("GET", origin.URL+"/page", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Referer", origin.URL+"/")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get page through the proxy: %v", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("failed to close proxy: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var responseID string
+	var metadata *Record
+	var fields Header
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		switch record.Header.Get("WARC-Type") {
+		case "response":
+			responseID = record.Header.Get("WARC-Record-ID")
+		case "metadata":
+			metadata = record
+			fields, err = ParseWarcFields(record.Content)
+			if err != nil {
+				t.Fatalf("failed to parse metadata record: %v", err)
+			}
+		}
+	}
+
+	if metadata == nil || metadata.RefersTo().RecordID != responseID {
+		t.Fatalf("expected a metadata record referring to the response %s", responseID)
+	}
+
+	if fields.Get("via") != origin.URL+"/" || fields.Get("hopsFromSeed") != "L" || fields.Get("outlink") != origin.URL+"/next" || fields.Get("fetchTimeMs") == "" {
+		t.Errorf("expected the crawl context of the exchange, got %v", fields)
+	}
+}
+
+// Tests that the proxy records the exchanges as sent and received,
+// rather than re-serialized from the parsed request and response
+func TestProxyRawExchange(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-proxy-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	// Header fields that net/http would reorder and canonicalize,
+	// and a chunked body that it would decode
+	response := "HTTP/1.1 200 OK\r\nx-lower: a\r\nContent-Type: text/plain\r\nx-lower: b\r\n" +
+		"Transfer-Encoding: chunked\r\n\r\n7\r\nHello, \r\n6\r\nWorld!\r\n0\r\n\r\n"
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	sent := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		var request strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			request.WriteString(line)
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		sent <- request.String()
+
+		io.WriteString(conn, response)
+	}()
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+
+	proxy, err := NewProxy(rotatorSettings)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatalf("failed to parse proxy URL: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	target := "http://" + listener.Addr().String() + "/raw"
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("failed to get %s through the proxy: %v", target, err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "Hello, World!" {
+		t.Errorf("expected the body passed to the client, got %q, %v", body, err)
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("failed to close proxy: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	recorded := make(map[string]string)
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(record.Content)
+		if err != nil {
+			t.Fatalf("failed to read record content: %v", err)
+		}
+		recorded[record.Header.Get("WARC-Type")] = string(content)
+	}
+
+	if recorded["response"] != response {
+		t.Errorf("expected the response as received %q, got %q", response, recorded["response"])
+	}
+	if request := <-sent; recorded["request"] != request {
+		t.Errorf("expected the request as sent %q, got %q", request, recorded["request"])
+	}
+}
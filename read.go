@@ -4,37 +4,206 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 // Reader store the bufio.Reader and gzip.Reader for a WARC file
 type Reader struct {
-	reader     *bufio.Reader
-	gzipReader *gzip.Reader
-	record     *Record
+	reader       *bufio.Reader
+	gzipReader   *gzip.Reader
+	stream       *bufio.Reader
+	decompressor io.ReadCloser
+	closer       io.Closer
+	record       *Record
+	warcinfo     Header
+	readCount    int
+	pending      *Record
+	streaming    *streamContent
+	options      ReaderOptions
+	counter      *countingReader
+	startOffset  int64
+	recordOffset int64
+	startTime    time.Time
+}
+
+// ReaderOptions holds the optional settings of a Reader
+type ReaderOptions struct {
+	// Compression of the WARC file, if empty, it is detected from
+	// the first bytes of the file among the built-in algorithms.
+	// Gzip files are read one member at a time, files using other
+	// compression algorithms are read as a stream of records
+	// delimited by their Content-Length.
+	Compression string
+	// MaxRecordSize is the maximum size in bytes of a record's content,
+	// records declaring or containing more than that make ReadRecord fail
+	// with a *RecordTooLargeError. Zero means no limit.
+	MaxRecordSize int64
+	// Progress, if set, is called after each record read
+	Progress func(Progress)
+	// TotalSize is the size of the WARC file, if known, it is used
+	// to estimate the remaining time reported by Progress
+	TotalSize int64
+	// StrictSpec makes ReadRecord fail with a *ValidationError on the
+	// records violating the WARC specification, see Record.Validate, the
+	// reader skipping them. Otherwise their violations are listed in their
+	// Problems.
+	StrictSpec bool
+	// Lenient makes ReadRecord resynchronize on the next record of
+	// uncompressed and ZSTD files when the Content-Length of a record
+	// is wrong, e.g. off by a CRLF as in many old crawler outputs,
+	// rather than fail. The end of the content is then looked for
+	// within 1024 bytes of the declared one, where two CRLF are
+	// followed by the next record or the end of the file, and the
+	// discrepancy is listed in the record's Problems. Gzip files are
+	// always read one member per record.
+	Lenient bool
+}
+
+// Progress reports the progress of a Reader
+type Progress struct {
+	// BytesRead is the number of bytes read from the WARC file
+	BytesRead int64
+	// Records is the number of records read
+	Records int
+	// Offset is the position in the WARC file of the next record, for
+	// files that are neither gzip compressed nor uncompressed, it is the
+	// number of bytes consumed by the decompressor
+	Offset int64
+	// TotalSize is ReaderOptions.TotalSize
+	TotalSize int64
+	// ETA is the estimated remaining time, it is zero if
+	// TotalSize is unknown
+	ETA time.Duration
+}
+
+// RecordTooLargeError is returned by ReadRecord when a record exceeds
+// ReaderOptions.MaxRecordSize. The reader can't be used after that.
+type RecordTooLargeError struct {
+	// Offset of the record in the (compressed) WARC file
+	Offset int64
+	// Size of the record, as declared by its Content-Length if known,
+	// else the number of bytes read before the limit was hit
+	Size int64
+	// MaxRecordSize that was exceeded
+	MaxRecordSize int64
+}
+
+func (e *RecordTooLargeError) Error() string {
+	return fmt.Sprintf("record at offset %d is %d bytes, exceeding the maximum of %d bytes", e.Offset, e.Size, e.MaxRecordSize)
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.reader.Read(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read, it is safe to call
+// while another goroutine reads, like a zstd decoder does
+func (c *countingReader) Count() int64 {
+	return atomic.LoadInt64(&c.count)
 }
 
 // NewReader returns a new WARC reader
 func NewReader(reader io.Reader) (*Reader, error) {
-	bufioReader := bufio.NewReader(reader)
+	return NewReaderWithOptions(reader, ReaderOptions{})
+}
 
-	// Wrap the reader into a bufio.Reader to add the ByteReader method
-	zr, err := gzip.NewReader(bufioReader)
-	if err != nil {
-		return nil, err
+// NewReaderWithOptions returns a new WARC reader using the given options
+func NewReaderWithOptions(reader io.Reader, options ReaderOptions) (*Reader, error) {
+	counter := &countingReader{reader: reader}
+	bufioReader := bufio.NewReader(counter)
+
+	r := &Reader{
+		reader:    bufioReader,
+		options:   options,
+		counter:   counter,
+		startTime: time.Now(),
+	}
+
+	compression := options.Compression
+	if compression == "" {
+		compression = detectCompression(bufioReader)
 	}
 
-	return &Reader{
-		reader:     bufioReader,
-		gzipReader: zr,
-	}, nil
+	switch compression {
+	case CompressionNone:
+		r.stream = bufioReader
+	case CompressionGZIP:
+		// Wrap the reader into a bufio.Reader to add the ByteReader method
+		zr, err := gzip.NewReader(bufioReader)
+		if err != nil {
+			return nil, err
+		}
+		r.gzipReader = zr
+	default:
+		codec, err := lookupCompression(compression)
+		if err != nil {
+			return nil, err
+		}
+		r.decompressor, err = codec.newReader(bufioReader)
+		if err != nil {
+			return nil, err
+		}
+		r.stream = bufio.NewReader(r.decompressor)
+	}
+
+	return r, nil
+}
+
+// detectCompression detects the compression of a WARC file from its
+// first bytes, defaulting to gzip
+func detectCompression(reader *bufio.Reader) string {
+	magic, _ := reader.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("WARC")):
+		return CompressionNone
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return CompressionZSTD
+	case len(magic) == 4 && magic[0]&0xf0 == 0x50 && bytes.Equal(magic[1:], []byte{0x2a, 0x4d, 0x18}):
+		// A zstd skippable frame, e.g. preceding a record frame
+		return CompressionZSTD
+	default:
+		return CompressionGZIP
+	}
+}
+
+// offset returns the position of the underlying bufio.Reader
+// in the WARC file
+func (r *Reader) offset() int64 {
+	// The decompressor may be reading from the bufio.Reader in another
+	// goroutine, the offset is then the number of bytes it consumed
+	if r.decompressor != nil {
+		return r.counter.Count()
+	}
+	return r.counter.Count() - int64(r.reader.Buffered())
 }
 
 // Close closes the reader.
 func (r *Reader) Close() {
-	r.gzipReader.Close()
+	if r.gzipReader != nil {
+		r.gzipReader.Close()
+	}
+	if r.decompressor != nil {
+		r.decompressor.Close()
+	}
+	if r.closer != nil {
+		r.closer.Close()
+	}
 }
 
 type reader interface {
@@ -65,10 +234,28 @@ func (r *Reader) ReadRecord(onDisk bool) (*Record, error) {
 	var err error
 	var tempReader *bufio.Reader
 
-	r.gzipReader.Multistream(false)
+	// Skip the rest of the record returned by StreamRecord, if any
+	if err := r.finishStream(); err != nil {
+		return nil, err
+	}
 
-	// If onDisk is specified, dump gzip block to a temporary file
-	if onDisk {
+	// Return the record read in advance by Warcinfo, if any
+	if r.pending != nil {
+		record := r.pending
+		r.pending = nil
+		return record, nil
+	}
+	r.readCount++
+	r.recordOffset = r.startOffset
+
+	// Gzip files are read one member at a time, other
+	// files as a stream of records
+	if r.gzipReader == nil {
+		tempReader = r.stream
+	} else if onDisk {
+		r.gzipReader.Multistream(false)
+
+		// If onDisk is specified, dump gzip block to a temporary file
 		tempFile, err := ioutil.TempFile("", "warc-reading-*")
 		if err != nil {
 			return nil, err
@@ -90,12 +277,11 @@ func (r *Reader) ReadRecord(onDisk bool) (*Record, error) {
 
 		tempReader = bufio.NewReader(file)
 	} else {
+		r.gzipReader.Multistream(false)
 		tempReader = bufio.NewReader(r.gzipReader)
 	}
 
-	// Skip first line (WARC version)
-	// TODO: add check for WARC version
-	_, err = readUntilDelim(tempReader, []byte("\r\n"))
+	version, rawHeader, header, err := readRecordHeader(tempReader)
 	if err != nil {
 		if err == io.EOF {
 			return &Record{Header: nil, Content: nil}, err
@@ -103,18 +289,25 @@ func (r *Reader) ReadRecord(onDisk bool) (*Record, error) {
 		return nil, err
 	}
 
-	// Parse the record header
-	header := NewHeader()
-	for {
-		line, err := readUntilDelim(tempReader, []byte("\r\n"))
-		if err != nil {
-			return nil, err
-		}
-		if len(line) == 0 {
-			break
+	// Check the declared size of the record before reading it
+	contentLength, contentLengthErr := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if r.options.MaxRecordSize > 0 && contentLengthErr == nil && contentLength > r.options.MaxRecordSize {
+		return nil, r.recordTooLarge(contentLength)
+	}
+
+	// When reading a stream of records, the content is delimited
+	// by the Content-Length and followed by two CRLF
+	contentReader := r.limitContent(tempReader)
+	var resync *resyncReader
+	if r.gzipReader == nil {
+		if contentLengthErr != nil || contentLength < 0 {
+			return nil, errors.New("Invalid Content-Length: " + header.Get("Content-Length"))
 		}
-		if key, value := splitKeyValue(string(line)); key != "" {
-			header.Set(key, value)
+		if r.options.Lenient {
+			resync = newResyncReader(tempReader, contentLength)
+			contentReader = resync
+		} else {
+			contentReader = io.LimitReader(tempReader, contentLength)
 		}
 	}
 
@@ -128,62 +321,281 @@ func (r *Reader) ReadRecord(onDisk bool) (*Record, error) {
 
 		// Copy all the payload (including the potential trailing CRLF)
 		// to a newly created temporary file
-		_, err = io.Copy(payloadTempFile, tempReader)
+		written, err := io.Copy(payloadTempFile, contentReader)
 		if err != nil {
 			payloadTempFile.Close()
 			os.Remove(payloadTempFile.Name())
 			return nil, err
 		}
 
-		// Check if the last 4 bytes are \r\n\r\n,
-		// if yes, then we truncate the last 4 bytes
-		buf := make([]byte, 16)
-		stats, err := os.Stat(payloadTempFile.Name())
-		if err != nil {
+		if r.isContentTooLarge(written) {
 			payloadTempFile.Close()
 			os.Remove(payloadTempFile.Name())
-			return nil, err
+			return nil, r.recordTooLarge(written)
 		}
 
-		start := stats.Size() - 16
-		_, err = payloadTempFile.ReadAt(buf, start)
+		// A lenient reader reads the end of the record with its content
+		if r.gzipReader != nil {
+			err = truncateRecordEnd(payloadTempFile)
+		} else if resync == nil {
+			err = readRecordEnd(tempReader)
+		}
 		if err != nil {
 			payloadTempFile.Close()
 			os.Remove(payloadTempFile.Name())
 			return nil, err
 		}
 
-		if bytes.HasSuffix(buf, []byte("\r\n\r\n")) {
-			os.Truncate(payloadTempFile.Name(), stats.Size()-4)
-		}
-
 		r.record = &Record{
 			Header:      header,
 			Content:     nil,
 			PayloadPath: payloadTempFile.Name(),
+			RawHeader:   rawHeader,
 		}
 	} else {
-		content, err := ioutil.ReadAll(tempReader)
+		content, err := ioutil.ReadAll(contentReader)
 		if err != nil {
 			return nil, err
 		}
 
-		content = bytes.TrimSuffix(content, []byte("\r\n\r\n"))
+		if r.isContentTooLarge(int64(len(content))) {
+			return nil, r.recordTooLarge(int64(len(content)))
+		}
+
+		if r.gzipReader != nil {
+			content = bytes.TrimSuffix(content, []byte("\r\n\r\n"))
+		} else if resync == nil {
+			if err := readRecordEnd(tempReader); err != nil {
+				return nil, err
+			}
+		}
 
 		r.record = &Record{
-			Header:  header,
-			Content: bytes.NewReader(content),
+			Header:    header,
+			Content:   bytes.NewReader(content),
+			RawHeader: rawHeader,
 		}
 	}
 
-	// Reset the reader for the next block
-	err = r.gzipReader.Reset(r.reader)
-	if err == io.EOF {
-		return r.record, nil
+	if resync != nil && resync.size != contentLength {
+		r.record.Problems = append(r.record.Problems, "Content-Length "+strconv.FormatInt(contentLength, 10)+" doesn't match the content size "+strconv.FormatInt(resync.size, 10))
 	}
-	if err != nil {
-		return r.record, err
+
+	// Keep the content of the first warcinfo record of the file
+	if r.warcinfo == nil && header.Get("WARC-Type") == "warcinfo" {
+		r.warcinfo, err = readWarcinfo(r.record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.startOffset = r.offset()
+	r.reportProgress()
+
+	// Check the record against the specification
+	problems := r.checkRecord(r.record, string(version))
+
+	if r.gzipReader != nil {
+		// Reset the reader for the next block
+		err = r.gzipReader.Reset(r.reader)
+		if err != nil && err != io.EOF {
+			return r.record, err
+		}
+	}
+
+	if problems != nil && r.options.StrictSpec {
+		if r.record.PayloadPath != "" {
+			os.Remove(r.record.PayloadPath)
+		}
+		return nil, problems
 	}
 
 	return r.record, nil
 }
+
+// readRecordHeader reads the version line and the header of a record,
+// returning them parsed and as the raw bytes read, so that the record
+// can be copied verbatim. The error is io.EOF if there is no more record.
+func readRecordHeader(reader *bufio.Reader) (version []byte, rawHeader []byte, header Header, err error) {
+	version, err = readUntilDelim(reader, []byte("\r\n"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rawHeader = append(version, "\r\n"...)
+
+	header = NewHeader()
+	for {
+		line, err := readUntilDelim(reader, []byte("\r\n"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rawHeader = append(rawHeader, line...)
+		rawHeader = append(rawHeader, "\r\n"...)
+		if len(line) == 0 {
+			break
+		}
+		if key, value := splitKeyValue(string(line)); key != "" {
+			header.Set(key, value)
+		}
+	}
+
+	return version, rawHeader, header, nil
+}
+
+// checkRecord lists the violations of the WARC specification of a record
+// in its Problems, returning them as a *ValidationError if there are any
+func (r *Reader) checkRecord(record *Record, version string) *ValidationError {
+	if version != Version10 && version != Version11 {
+		record.Problems = append(record.Problems, "unknown version "+version)
+	}
+
+	if err := record.Validate(); err != nil {
+		record.Problems = append(record.Problems, err.(*ValidationError).Problems...)
+	}
+
+	if record.Problems == nil {
+		return nil
+	}
+
+	return &ValidationError{Problems: record.Problems}
+}
+
+// readRecordEnd reads the two CRLF ending a record
+// in a stream of records
+func readRecordEnd(reader io.Reader) error {
+	end := make([]byte, 4)
+	if _, err := io.ReadFull(reader, end); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if !bytes.Equal(end, []byte("\r\n\r\n")) {
+		return errors.New("Record content isn't followed by two CRLF")
+	}
+
+	return nil
+}
+
+// truncateRecordEnd removes the two CRLF ending a record
+// from the payload file of a record read from a gzip member
+func truncateRecordEnd(file *os.File) error {
+	// Check if the last 4 bytes are \r\n\r\n,
+	// if yes, then we truncate the last 4 bytes
+	stats, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// An empty record may have lost its trailing CRLFs
+	if stats.Size() < 4 {
+		return nil
+	}
+
+	buf := make([]byte, 4)
+	_, err = file.ReadAt(buf, stats.Size()-4)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(buf, []byte("\r\n\r\n")) {
+		return file.Truncate(stats.Size() - 4)
+	}
+
+	return nil
+}
+
+// reportProgress calls the Progress callback, if any
+func (r *Reader) reportProgress() {
+	if r.options.Progress == nil {
+		return
+	}
+
+	progress := Progress{
+		BytesRead: r.counter.Count(),
+		Records:   r.readCount,
+		Offset:    r.startOffset,
+		TotalSize: r.options.TotalSize,
+	}
+
+	if progress.TotalSize > 0 && progress.Offset > 0 {
+		elapsed := time.Since(r.startTime)
+		remaining := float64(progress.TotalSize-progress.Offset) / float64(progress.Offset)
+		progress.ETA = time.Duration(float64(elapsed) * remaining)
+	}
+
+	r.options.Progress(progress)
+}
+
+// limitContent limits the reading of a record's content to
+// MaxRecordSize, plus the record's trailing CRLFs and one byte
+// to detect records exceeding the limit
+func (r *Reader) limitContent(reader io.Reader) io.Reader {
+	if r.options.MaxRecordSize <= 0 {
+		return reader
+	}
+	return io.LimitReader(reader, r.options.MaxRecordSize+5)
+}
+
+// isContentTooLarge checks the size of a record's content read
+// through limitContent, trailing CRLFs included
+func (r *Reader) isContentTooLarge(size int64) bool {
+	return r.options.MaxRecordSize > 0 && size > r.options.MaxRecordSize+4
+}
+
+func (r *Reader) recordTooLarge(size int64) *RecordTooLargeError {
+	return &RecordTooLargeError{
+		Offset:        r.startOffset,
+		Size:          size,
+		MaxRecordSize: r.options.MaxRecordSize,
+	}
+}
+
+// RecordOffset returns the offset in the file of the last record returned
+// by ReadRecord, so that it can be read again later by reading the file
+// from that offset, e.g. with ReadRecordAt. It is only accurate for gzip
+// and uncompressed files, as other decompressors read ahead.
+func (r *Reader) RecordOffset() int64 {
+	return r.recordOffset
+}
+
+// Warcinfo returns the fields of the first warcinfo record of the file.
+// If no record has been read yet, the first record is read in advance
+// and will be returned by the next call to ReadRecord.
+// If the file has no warcinfo record, Warcinfo returns nil.
+func (r *Reader) Warcinfo() (Header, error) {
+	if r.warcinfo == nil && r.readCount == 0 {
+		record, err := r.ReadRecord(false)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == nil {
+			r.pending = record
+		}
+	}
+
+	return r.warcinfo, nil
+}
+
+// readWarcinfo parses the application/warc-fields content of a warcinfo
+// record, leaving the record content readable from the start
+func readWarcinfo(record *Record) (Header, error) {
+	if record.PayloadPath != "" {
+		file, err := os.Open(record.PayloadPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return ParseWarcFields(file)
+	}
+
+	content, err := ioutil.ReadAll(record.Content)
+	if err != nil {
+		return nil, err
+	}
+	record.Content = bytes.NewReader(content)
+
+	return ParseWarcFields(bytes.NewReader(content))
+}
@@ -171,3 +171,270 @@ func TestSimpleWriteRead(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderWarcinfo(t *testing.T) {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	warcinfo, err := reader.Warcinfo()
+	if err != nil {
+		t.Fatalf("failed to read warcinfo: %v", err)
+	}
+
+	if warcinfo.Get("software") != "Zeno" {
+		t.Errorf("expected software = %q, got %q", "Zeno", warcinfo.Get("software"))
+	}
+
+	// The warcinfo record must still be returned by ReadRecord
+	record, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected record, got %v", err)
+	}
+
+	if record.Header.Get("WARC-Type") != "warcinfo" {
+		t.Errorf("expected warcinfo record, got %q", record.Header.Get("WARC-Type"))
+	}
+
+	content, err := ioutil.ReadAll(record.Content)
+	if err != nil {
+		t.Fatalf("failed to read record content: %v", err)
+	}
+
+	if hash := "sha1:" + GetSHA1(content); hash != record.Header.Get("WARC-Block-Digest") {
+		t.Errorf("expected %s, got %s", record.Header.Get("WARC-Block-Digest"), hash)
+	}
+}
+
+func TestReaderMaxRecordSize(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	reader, err := NewReaderWithOptions(bytes.NewReader(data), ReaderOptions{MaxRecordSize: 500})
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	// The warcinfo record is small enough to be read
+	if _, err := reader.ReadRecord(false); err != nil {
+		t.Fatalf("expected record, got %v", err)
+	}
+
+	_, err = reader.ReadRecord(false)
+	tooLarge, ok := err.(*RecordTooLargeError)
+	if !ok {
+		t.Fatalf("expected *RecordTooLargeError, got %v", err)
+	}
+
+	if tooLarge.Size != 876 {
+		t.Errorf("expected size 876, got %d", tooLarge.Size)
+	}
+
+	// The offset must point to the start of the record's gzip member
+	if tooLarge.Offset <= 0 || !bytes.HasPrefix(data[tooLarge.Offset:], []byte{0x1f, 0x8b}) {
+		t.Errorf("offset %d isn't the start of a gzip member", tooLarge.Offset)
+	}
+}
+
+func TestReaderProgress(t *testing.T) {
+	stat, err := os.Stat("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to stat test file: %v", err)
+	}
+
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	var last Progress
+	reader, err := NewReaderWithOptions(file, ReaderOptions{
+		TotalSize: stat.Size(),
+		Progress: func(progress Progress) {
+			if progress.Offset < last.Offset {
+				t.Errorf("offset went backward from %d to %d", last.Offset, progress.Offset)
+			}
+			last = progress
+		},
+	})
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	for {
+		if _, err := reader.ReadRecord(false); err != nil {
+			break
+		}
+	}
+
+	if last.Records != 19 {
+		t.Errorf("expected 19 records, got %d", last.Records)
+	}
+
+	if last.Offset != stat.Size() {
+		t.Errorf("expected final offset %d, got %d", stat.Size(), last.Offset)
+	}
+}
+
+func TestEmptyRecords(t *testing.T) {
+	emptyDigest := "sha1:" + GetSHA1(nil)
+
+	for _, compression := range testCompressions() {
+		for _, onDisk := range []bool{false, true} {
+			t.Logf("compression %q, onDisk %v", compression, onDisk)
+
+			buffer := new(bytes.Buffer)
+			memberWriter, err := NewMemberWriter(buffer, compression)
+			if err != nil {
+				t.Fatalf("failed to create member writer: %v", err)
+			}
+
+			writer, err := NewWriter(memberWriter, "test.warc", "")
+			if err != nil {
+				t.Fatalf("failed to initialize a new writer: %v", err)
+			}
+
+			// Adjacent records without content, as written
+			// for HEAD requests or 204 responses
+			for _, content := range []io.Reader{nil, bytes.NewReader(nil), nil} {
+				record := NewRecord()
+				record.Content = content
+
+				memberWriter.Begin()
+				if _, err := writer.WriteRecord(record); err != nil {
+					t.Fatalf("error while writing empty record: %v", err)
+				}
+				memberWriter.End()
+			}
+
+			reader, err := NewReader(buffer)
+			if err != nil {
+				t.Fatalf("warc.NewReader failed: %v", err)
+			}
+
+			for i := 0; i < 3; i++ {
+				record, err := reader.ReadRecord(onDisk)
+				if err != nil {
+					t.Fatalf("expected record %d, got %v", i, err)
+				}
+
+				if record.Header.Get("Content-Length") != "0" {
+					t.Errorf("expected Content-Length 0, got %q", record.Header.Get("Content-Length"))
+				}
+
+				if record.Header.Get("WARC-Block-Digest") != emptyDigest {
+					t.Errorf("expected %s, got %s", emptyDigest, record.Header.Get("WARC-Block-Digest"))
+				}
+
+				var content []byte
+				if onDisk {
+					content, err = ioutil.ReadFile(record.PayloadPath)
+					os.Remove(record.PayloadPath)
+				} else {
+					content, err = ioutil.ReadAll(record.Content)
+				}
+				if err != nil {
+					t.Fatalf("failed to read record content: %v", err)
+				}
+
+				if len(content) != 0 {
+					t.Errorf("expected empty content, got %q", content)
+				}
+			}
+
+			if _, err := reader.ReadRecord(onDisk); err != io.EOF {
+				t.Errorf("expected io.EOF, got %v", err)
+			}
+			reader.Close()
+		}
+	}
+}
+
+// Tests that a lenient reader resynchronizes on the records
+// whose Content-Length is wrong
+func TestReaderLenient(t *testing.T) {
+	records := []struct {
+		content       string
+		contentLength int
+	}{
+		{"Hello, World!", 13},
+		{"Hello, World!\r\n", 17},
+		{"Goodbye, World!", 13},
+		{"Hello again\r\n\r\n", 17},
+		{"The end", 5},
+	}
+
+	stream := new(bytes.Buffer)
+	for i, record := range records {
+		fmt.Fprintf(stream, "WARC/1.0\r\n"+
+			"WARC-Type: resource\r\n"+
+			"WARC-Record-ID: <urn:uuid:7f3a2c1e-0000-4000-8000-00000000000%d>\r\n"+
+			"WARC-Date: 2020-12-21T23:58:40Z\r\n"+
+			"WARC-Target-URI: http://example.com/%d\r\n"+
+			"Content-Length: %d\r\n"+
+			"\r\n%s\r\n\r\n", i, i, record.contentLength, record.content)
+	}
+
+	// The strict reader fails on the first wrong Content-Length
+	reader, err := NewReaderWithOptions(bytes.NewReader(stream.Bytes()), ReaderOptions{Compression: CompressionNone})
+	if err != nil {
+		t.Fatalf("warc.NewReaderWithOptions failed: %v", err)
+	}
+	if _, err := reader.ReadRecord(false); err != nil {
+		t.Fatalf("failed to read record: %v", err)
+	}
+	if _, err := reader.ReadRecord(false); err == nil {
+		t.Errorf("expected an error for a wrong Content-Length")
+	}
+
+	for _, onDisk := range []bool{false, true} {
+		reader, err := NewReaderWithOptions(bytes.NewReader(stream.Bytes()), ReaderOptions{Compression: CompressionNone, Lenient: true})
+		if err != nil {
+			t.Fatalf("warc.NewReaderWithOptions failed: %v", err)
+		}
+
+		for i, expected := range records {
+			record, err := reader.ReadRecord(onDisk)
+			if err != nil {
+				t.Fatalf("record %d: failed to read record: %v", i, err)
+			}
+
+			var content []byte
+			if onDisk {
+				content, err = ioutil.ReadFile(record.PayloadPath)
+				os.Remove(record.PayloadPath)
+			} else {
+				content, err = ioutil.ReadAll(record.Content)
+			}
+			if err != nil {
+				t.Fatalf("record %d: failed to read content: %v", i, err)
+			}
+
+			if string(content) != expected.content {
+				t.Errorf("record %d: expected %q, got %q", i, expected.content, content)
+			}
+
+			mismatch := len(expected.content) != expected.contentLength
+			if mismatch != (len(record.Problems) == 1) {
+				t.Errorf("record %d: expected a Content-Length problem to be %v, got %v", i, mismatch, record.Problems)
+			}
+		}
+
+		if _, err := reader.ReadRecord(onDisk); err != io.EOF {
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package warc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Revisit profiles defined by the WARC 1.1 specification
+const (
+	ProfileIdenticalPayloadDigest = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+	ProfileServerNotModified      = "http://netpreserve.org/warc/1.1/revisit/server-not-modified"
+)
+
+// Revisit profiles defined by the WARC 1.0 specification, used
+// by the revisit records written by this package, see Version10
+const (
+	ProfileIdenticalPayloadDigest10 = "http://netpreserve.org/warc/1.0/revisit/identical-payload-digest"
+	ProfileServerNotModified10      = "http://netpreserve.org/warc/1.0/revisit/server-not-modified"
+)
+
+// revisitProfileVersions are the versions in the
+// URIs of the revisit profiles of the specification
+var revisitProfileVersions = strings.NewReplacer(
+	"http://netpreserve.org/warc/1.0/revisit/", "http://netpreserve.org/warc/revisit/",
+	"http://netpreserve.org/warc/1.1/revisit/", "http://netpreserve.org/warc/revisit/",
+)
+
+// RefersTo is the reference of a record to an earlier record, made of
+// the WARC-Refers-To, WARC-Refers-To-Target-URI and WARC-Refers-To-Date
+// fields. Any of them can be empty.
+type RefersTo struct {
+	// RecordID is the WARC-Record-ID of the referred record
+	RecordID string `json:"recordID"`
+	// TargetURI and Date are the WARC-Target-URI and the WARC-Date of the
+	// referred record, only revisit records can refer to them
+	TargetURI string `json:"targetURI,omitempty"`
+	Date      string `json:"date,omitempty"`
+}
+
+// refersToTypes are the WARC-Type values of the records that can
+// refer to another record with WARC-Refers-To
+var refersToTypes = map[string]bool{
+	"revisit":    true,
+	"conversion": true,
+	"metadata":   true,
+}
+
+// NewRefersTo returns the reference to record
+func NewRefersTo(record *Record) RefersTo {
+	return RefersTo{
+		RecordID:  record.Header.Get("WARC-Record-ID"),
+		TargetURI: record.Header.Get("WARC-Target-URI"),
+		Date:      record.Header.Get("WARC-Date"),
+	}
+}
+
+// RefersTo returns the reference of the record to an earlier record
+func (r *Record) RefersTo() RefersTo {
+	return RefersTo{
+		RecordID:  r.Header.Get("WARC-Refers-To"),
+		TargetURI: r.Header.Get("WARC-Refers-To-Target-URI"),
+		Date:      r.Header.Get("WARC-Refers-To-Date"),
+	}
+}
+
+// SetRefersTo sets the reference of the record to an earlier record, the
+// empty fields of refersTo being removed from the header. It fails if the
+// WARC-Type of the record can't refer to another record this way: only
+// revisit, conversion and metadata records can have a WARC-Refers-To,
+// and only revisit records a WARC-Refers-To-Target-URI and -Date.
+func (r *Record) SetRefersTo(refersTo RefersTo) error {
+	warcType := r.Header.Get("WARC-Type")
+
+	if refersTo.RecordID != "" && !refersToTypes[warcType] {
+		return errors.New("WARC-Refers-To can't be used in a " + warcType + " record")
+	}
+
+	if (refersTo.TargetURI != "" || refersTo.Date != "") && warcType != "revisit" {
+		return errors.New("WARC-Refers-To-Target-URI and WARC-Refers-To-Date can't be used in a " + warcType + " record")
+	}
+
+	for key, value := range map[string]string{
+		"WARC-Refers-To":            refersTo.RecordID,
+		"WARC-Refers-To-Target-URI": refersTo.TargetURI,
+		"WARC-Refers-To-Date":       refersTo.Date,
+	} {
+		if value == "" {
+			r.Header.Del(key)
+		} else {
+			r.Header.Set(key, value)
+		}
+	}
+
+	return nil
+}
+
+// RevisitProfile returns the WARC-Profile of a revisit record
+func (r *Record) RevisitProfile() string {
+	return r.Header.Get("WARC-Profile")
+}
+
+// HasRevisitProfile returns whether a revisit record has profile, the
+// profiles of WARC 1.0 and 1.1 being the same whatever the version in
+// their URIs, e.g. ProfileIdenticalPayloadDigest10 and
+// ProfileIdenticalPayloadDigest
+func (r *Record) HasRevisitProfile(profile string) bool {
+	return revisitProfileVersions.Replace(r.RevisitProfile()) == revisitProfileVersions.Replace(profile)
+}
+
+// SetRevisitProfile sets the WARC-Profile of a revisit record, e.g.
+// ProfileIdenticalPayloadDigest10, whose version should be the one
+// of the record
+func (r *Record) SetRevisitProfile(profile string) error {
+	if warcType := r.Header.Get("WARC-Type"); warcType != "revisit" {
+		return errors.New("WARC-Profile can't be used in a " + warcType + " record")
+	}
+
+	r.Header.Set("WARC-Profile", profile)
+	return nil
+}
@@ -0,0 +1,66 @@
+package warc
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests for the Record.SetRefersTo and Record.RefersTo methods
+func TestRecordRefersTo(t *testing.T) {
+	original := NewRecord()
+	original.Header.Set("WARC-Type", "response")
+	original.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000000>")
+	original.Header.Set("WARC-Target-URI", "https://example.com/")
+	original.Header.Set("WARC-Date", "2021-05-04T10:11:12Z")
+
+	revisit := NewRecord()
+	revisit.Header.Set("WARC-Type", "revisit")
+
+	if err := revisit.SetRefersTo(NewRefersTo(original)); err != nil {
+		t.Fatalf("failed to set reference: %v", err)
+	}
+
+	if err := revisit.SetRevisitProfile(ProfileIdenticalPayloadDigest10); err != nil {
+		t.Fatalf("failed to set profile: %v", err)
+	}
+
+	if revisit.RefersTo() != NewRefersTo(original) || revisit.RevisitProfile() != ProfileIdenticalPayloadDigest10 {
+		t.Errorf("unexpected reference %+v", revisit.RefersTo())
+	}
+
+	// The profiles are the same whatever the version of their URIs
+	if !revisit.HasRevisitProfile(ProfileIdenticalPayloadDigest) || !revisit.HasRevisitProfile(ProfileIdenticalPayloadDigest10) ||
+		revisit.HasRevisitProfile(ProfileServerNotModified) {
+		t.Errorf("unexpected profile matches for %s", revisit.RevisitProfile())
+	}
+
+	if err := revisit.SetRefersTo(RefersTo{RecordID: original.Header.Get("WARC-Record-ID")}); err != nil {
+		t.Fatalf("failed to set reference: %v", err)
+	}
+
+	if revisit.Header.Get("WARC-Refers-To-Date") != "" {
+		t.Error("expected the empty fields of the reference to be removed")
+	}
+
+	// Only revisit records refer to target URIs and dates
+	conversion := NewRecord()
+	conversion.Header.Set("WARC-Type", "conversion")
+
+	if err := conversion.SetRefersTo(NewRefersTo(original)); err == nil {
+		t.Error("expected an error for a conversion record referring to a capture")
+	}
+
+	if err := conversion.SetRefersTo(RefersTo{RecordID: original.Header.Get("WARC-Record-ID")}); err != nil {
+		t.Errorf("expected a conversion record to refer to a record ID, got %v", err)
+	}
+
+	if err := original.SetRevisitProfile(ProfileServerNotModified); err == nil {
+		t.Error("expected an error for a response record with a profile")
+	}
+
+	// The misplaced fields set directly in the header are caught by Validate
+	original.Header.Set("WARC-Refers-To", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000001>")
+	if err := original.Validate(); err == nil || !strings.Contains(err.Error(), "WARC-Refers-To in a response record") {
+		t.Errorf("expected a misplaced WARC-Refers-To, got %v", err)
+	}
+}
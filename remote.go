@@ -0,0 +1,237 @@
+package warc
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// OpenRemote returns a Reader reading the records of a WARC file hosted
+// on an HTTP(S) server, e.g. an S3 presigned URL. If offset isn't zero,
+// the file is read from that offset with a range request, so that a record
+// located with a CDX index can be read without downloading the whole file.
+// The HTTP response is closed when the Reader is closed.
+func OpenRemote(rawURL string, offset int64) (*Reader, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A server ignoring the range request would make us read
+	// the file from its start
+	if (offset > 0 && resp.StatusCode != http.StatusPartialContent) || (offset == 0 && resp.StatusCode != http.StatusOK) {
+		resp.Body.Close()
+		return nil, errors.New("Unexpected HTTP status reading " + rawURL + ": " + resp.Status)
+	}
+
+	reader, err := NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	reader.closer = resp.Body
+
+	return reader, nil
+}
+
+// RemoteFileOptions holds the settings of a RemoteFile
+type RemoteFileOptions struct {
+	// Client used to send the range requests,
+	// default is http.DefaultClient
+	Client *http.Client
+	// BlockSize is the size in bytes of the blocks the file
+	// is fetched by, default is 64KiB
+	BlockSize int64
+	// Readahead is the number of blocks fetched after the requested
+	// one on a cache miss, as gzip members are usually read
+	// sequentially, default is 3
+	Readahead int
+	// CacheSize is the maximum size in bytes of the blocks kept
+	// in memory, default is 64MiB
+	CacheSize int64
+}
+
+// RemoteFile gives random access to a WARC file hosted on an HTTP(S)
+// server, fetching it by blocks with range requests and keeping the most
+// recently used blocks in memory. It is safe for concurrent use, so that
+// many records of the same file can be read at the same time.
+type RemoteFile struct {
+	url       string
+	client    *http.Client
+	blockSize int64
+	readahead int
+	maxBlocks int
+
+	mu     sync.Mutex
+	blocks map[int64]*list.Element
+	lru    *list.List
+}
+
+// remoteBlock is a block of a RemoteFile kept in cache
+type remoteBlock struct {
+	index int64
+	data  []byte
+}
+
+// NewRemoteFile creates a RemoteFile reading the file at rawURL.
+func NewRemoteFile(rawURL string, options RemoteFileOptions) *RemoteFile {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.BlockSize <= 0 {
+		options.BlockSize = 64 * 1024
+	}
+	if options.Readahead < 0 {
+		options.Readahead = 0
+	} else if options.Readahead == 0 {
+		options.Readahead = 3
+	}
+	if options.CacheSize <= 0 {
+		options.CacheSize = 64 * 1024 * 1024
+	}
+
+	maxBlocks := int(options.CacheSize / options.BlockSize)
+	if maxBlocks < options.Readahead+1 {
+		maxBlocks = options.Readahead + 1
+	}
+
+	return &RemoteFile{
+		url:       rawURL,
+		client:    options.Client,
+		blockSize: options.BlockSize,
+		readahead: options.Readahead,
+		maxBlocks: maxBlocks,
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Open returns a Reader reading the records of the file from offset,
+// e.g. the offset of a record found in a CDX index.
+func (f *RemoteFile) Open(offset int64) (*Reader, error) {
+	return NewReader(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+}
+
+// ReadAt reads len(p) bytes of the file starting at offset off.
+func (f *RemoteFile) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		position := off + int64(n)
+
+		block, err := f.block(position / f.blockSize)
+		if err != nil {
+			return n, err
+		}
+
+		start := position % f.blockSize
+		if start >= int64(len(block)) {
+			return n, io.EOF
+		}
+
+		n += copy(p[n:], block[start:])
+	}
+
+	return n, nil
+}
+
+// block returns the block at index, fetching it if it isn't cached
+func (f *RemoteFile) block(index int64) ([]byte, error) {
+	f.mu.Lock()
+	if element, ok := f.blocks[index]; ok {
+		f.lru.MoveToFront(element)
+		f.mu.Unlock()
+		return element.Value.(*remoteBlock).data, nil
+	}
+	f.mu.Unlock()
+
+	blocks, err := f.fetch(index)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, data := range blocks {
+		f.cache(index+int64(i), data)
+	}
+
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	return blocks[0], nil
+}
+
+// cache adds a block to the cache, evicting the least recently used
+// blocks if needed, f.mu must be held
+func (f *RemoteFile) cache(index int64, data []byte) {
+	if element, ok := f.blocks[index]; ok {
+		f.lru.MoveToFront(element)
+		return
+	}
+
+	f.blocks[index] = f.lru.PushFront(&remoteBlock{index: index, data: data})
+
+	for f.lru.Len() > f.maxBlocks {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.blocks, oldest.Value.(*remoteBlock).index)
+	}
+}
+
+// fetch fetches the block at index and the following readahead blocks,
+// it returns no block if index is past the end of the file
+func (f *RemoteFile) fetch(index int64) ([][]byte, error) {
+	start := index * f.blockSize
+	end := start + f.blockSize*int64(f.readahead+1) - 1
+
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, errors.New("Unexpected HTTP status reading " + f.url + ": " + resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks [][]byte
+	for len(data) > 0 {
+		size := f.blockSize
+		if int64(len(data)) < size {
+			size = int64(len(data))
+		}
+		blocks = append(blocks, data[:size])
+		data = data[size:]
+	}
+
+	return blocks, nil
+}
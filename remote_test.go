@@ -0,0 +1,120 @@
+package warc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Tests for the OpenRemote function
+func TestOpenRemote(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	// Find the offset of the second record of the test file
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	var offsets []int64
+	localReader, err := NewReaderWithOptions(file, ReaderOptions{
+		Progress: func(progress Progress) {
+			offsets = append(offsets, progress.Offset)
+		},
+	})
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+
+	localReader.ReadRecord(false)
+	expected, err := localReader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected record, got %v", err)
+	}
+	localReader.Close()
+
+	reader, err := OpenRemote(server.URL+"/test.warc.gz", offsets[0])
+	if err != nil {
+		t.Fatalf("failed to open remote WARC: %v", err)
+	}
+	defer reader.Close()
+
+	record, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected record, got %v", err)
+	}
+
+	if record.Header.Get("WARC-Record-ID") != expected.Header.Get("WARC-Record-ID") {
+		t.Errorf("expected record %q, got %q", expected.Header.Get("WARC-Record-ID"), record.Header.Get("WARC-Record-ID"))
+	}
+
+	if _, err := OpenRemote(server.URL+"/missing.warc.gz", 0); err == nil {
+		t.Error("expected an error for a missing remote WARC")
+	}
+}
+
+// Tests for the RemoteFile type
+func TestRemoteFile(t *testing.T) {
+	var requests int32
+	fileServer := http.FileServer(http.Dir("testdata"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	remoteFile := NewRemoteFile(server.URL+"/test.warc.gz", RemoteFileOptions{
+		BlockSize: 4096,
+		Readahead: 1,
+	})
+
+	// Read all the records concurrently, twice
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reader, err := remoteFile.Open(0)
+			if err != nil {
+				t.Errorf("failed to open remote WARC: %v", err)
+				return
+			}
+			defer reader.Close()
+
+			total := 0
+			for {
+				if _, err := reader.ReadRecord(false); err != nil {
+					if err != io.EOF {
+						t.Errorf("failed to read record: %v", err)
+					}
+					break
+				}
+				total++
+			}
+
+			if total != 19 {
+				t.Errorf("expected 19 records, got %d", total)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Reading the file again must be served from the cache
+	before := atomic.LoadInt32(&requests)
+
+	buffer := make([]byte, 16)
+	if _, err := remoteFile.ReadAt(buffer, 10000); err != nil {
+		t.Fatalf("failed to read remote file: %v", err)
+	}
+
+	if atomic.LoadInt32(&requests) != before {
+		t.Error("expected the block to be served from the cache")
+	}
+}
@@ -0,0 +1,117 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// resyncWindow is the distance from the end of a record's content
+// declared by its Content-Length within which the actual end is
+// looked for by a lenient Reader
+const resyncWindow = 1024
+
+// nextRecordMagic starts the version line of the record following
+// the two CRLF ending a record's content
+var nextRecordMagic = []byte("WARC/1.")
+
+// resyncReader reads the content of a record in a stream of records whose
+// Content-Length may be wrong: its end is looked for around the declared
+// one, where two CRLF are followed by the next record or the end of the
+// stream. The two CRLF are consumed, but not returned.
+type resyncReader struct {
+	reader   *bufio.Reader
+	prefix   io.Reader
+	declared int64
+	margin   int
+	tail     []byte
+	ended    bool
+	// size is the actual size of the content, once read
+	size int64
+}
+
+func newResyncReader(reader *bufio.Reader, contentLength int64) *resyncReader {
+	// The end of the content is searched in the last
+	// bytes declared and the ones following them
+	margin := int64(resyncWindow)
+	if contentLength < margin {
+		margin = contentLength
+	}
+
+	return &resyncReader{
+		reader:   reader,
+		prefix:   io.LimitReader(reader, contentLength-margin),
+		declared: contentLength,
+		margin:   int(margin),
+	}
+}
+
+func (r *resyncReader) Read(p []byte) (int, error) {
+	if !r.ended {
+		n, err := r.prefix.Read(p)
+		r.size += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+
+		r.ended = true
+		if err := r.findEnd(); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	if len(r.tail) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.tail)
+	r.tail = r.tail[n:]
+	return n, nil
+}
+
+// findEnd looks for the end of the content closest to the declared one,
+// keeping the bytes of the content before it in tail
+func (r *resyncReader) findEnd() error {
+	peeked, err := r.reader.Peek(r.margin + resyncWindow + 4 + len(nextRecordMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	atEOF := err == io.EOF
+
+	// The declared end is at margin in the peeked bytes
+	end := -1
+	for distance := 0; distance <= resyncWindow && end < 0; distance++ {
+		for _, i := range []int{r.margin - distance, r.margin + distance} {
+			if isRecordEnd(peeked, i, atEOF) {
+				end = i
+				break
+			}
+		}
+	}
+
+	if end < 0 {
+		return errors.New("Record content isn't followed by two CRLF, no record boundary found within " + strconv.Itoa(resyncWindow) + " bytes")
+	}
+
+	r.tail = append([]byte(nil), peeked[:end]...)
+	r.size += int64(end)
+
+	_, err = r.reader.Discard(end + 4)
+	return err
+}
+
+// isRecordEnd returns true if the two CRLF ending a record are at i in
+// peeked, followed by the next record or by the end of the stream
+func isRecordEnd(peeked []byte, i int, atEOF bool) bool {
+	if i < 0 || i+4 > len(peeked) || !bytes.Equal(peeked[i:i+4], []byte("\r\n\r\n")) {
+		return false
+	}
+
+	next := peeked[i+4:]
+	return (atEOF && len(next) == 0) || bytes.HasPrefix(next, nextRecordMagic)
+}
@@ -0,0 +1,364 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRevisitChain is the maximum number of revisit records
+// followed to find the original record
+const maxRevisitChain = 10
+
+// RecordLocation is the location of a record in a WARC file
+type RecordLocation struct {
+	// Path of the WARC file, it can be an HTTP(S) URL
+	Path string
+	// Offset of the record in the WARC file
+	Offset int64
+}
+
+// openFileFunc opens a WARC file of a collection, e.g. os.Open, or
+// the Open method of an fs.FS with Go 1.16 and later
+type openFileFunc func(path string) (io.ReadCloser, error)
+
+// openOSFile is the openFileFunc of the files of the file system
+func openOSFile(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// RecordIndex locates the records of a collection of WARC files
+type RecordIndex interface {
+	// LookupRecord returns the location of the record
+	// with the given WARC-Record-ID
+	LookupRecord(recordID string) (RecordLocation, error)
+	// LookupCapture returns the location of the capture
+	// of targetURI at the given WARC-Date
+	LookupCapture(targetURI string, date string) (RecordLocation, error)
+}
+
+// Capture is a capture of a URL, as listed by MemoryIndex.Captures
+type Capture struct {
+	RecordLocation
+	RecordID  string
+	TargetURI string
+	// Date is the WARC-Date of the record
+	Date string
+	// Type is the WARC-Type of the record
+	Type string
+	// PayloadDigest is the WARC-Payload-Digest of the record
+	PayloadDigest string
+	// StatusCode is the HTTP status code of response and revisit
+	// records, the one of the revisit itself for revisit records,
+	// it is zero for other records
+	StatusCode int
+}
+
+// MemoryIndex is a RecordIndex kept in memory, built by IndexFiles
+type MemoryIndex struct {
+	records  map[string]RecordLocation
+	captures map[string]RecordLocation
+	// timelines are the captures of each URL, by SURT
+	timelines map[string][]Capture
+	// open opens the indexed files, os.Open if nil
+	open openFileFunc
+}
+
+// IndexFiles reads all the records of the WARC files at paths
+// and returns an index of their locations
+func IndexFiles(paths []string) (*MemoryIndex, error) {
+	return indexFiles(nil, paths)
+}
+
+func indexFiles(open openFileFunc, paths []string) (*MemoryIndex, error) {
+	index := &MemoryIndex{
+		records:   make(map[string]RecordLocation),
+		captures:  make(map[string]RecordLocation),
+		timelines: make(map[string][]Capture),
+		open:      open,
+	}
+
+	for _, path := range paths {
+		if err := index.indexFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
+
+func (i *MemoryIndex) indexFile(path string) error {
+	open := i.open
+	if open == nil {
+		open = openOSFile
+	}
+
+	file, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.ReadRecord(true)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		location := RecordLocation{Path: path, Offset: reader.RecordOffset()}
+
+		if recordID := record.Header.Get("WARC-Record-ID"); recordID != "" {
+			i.records[recordID] = location
+		}
+
+		switch record.Header.Get("WARC-Type") {
+		case "response", "resource", "revisit":
+			i.addCapture(record, location)
+		}
+
+		os.Remove(record.PayloadPath)
+	}
+}
+
+func (i *MemoryIndex) addCapture(record *Record, location RecordLocation) {
+	capture := Capture{
+		RecordLocation: location,
+		RecordID:       record.Header.Get("WARC-Record-ID"),
+		TargetURI:      strings.Trim(record.Header.Get("WARC-Target-URI"), "<>"),
+		Date:           record.Header.Get("WARC-Date"),
+		Type:           record.Header.Get("WARC-Type"),
+		PayloadDigest:  record.Header.Get("WARC-Payload-Digest"),
+	}
+
+	if capture.Type != "resource" {
+		if startLine, err := record.HTTPStartLine(); err == nil && startLine.IsResponse() {
+			capture.StatusCode = startLine.StatusCode
+		}
+	}
+
+	i.captures[captureKey(capture.TargetURI, capture.Date)] = location
+
+	key := timelineKey(capture.TargetURI)
+	i.timelines[key] = append(i.timelines[key], capture)
+}
+
+// timelineKey returns the SURT of a URL, or
+// the URL itself if it can't be parsed
+func timelineKey(targetURI string) string {
+	key, err := SURT(targetURI)
+	if err != nil {
+		return targetURI
+	}
+	return key
+}
+
+// Captures returns all the captures of a URL, sorted by date. URLs are
+// compared by their SURT, so that equivalent URLs share their captures.
+func (i *MemoryIndex) Captures(targetURI string) []Capture {
+	captures := append([]Capture(nil), i.timelines[timelineKey(targetURI)]...)
+
+	sort.SliceStable(captures, func(a, b int) bool {
+		return captures[a].Date < captures[b].Date
+	})
+
+	return captures
+}
+
+func captureKey(targetURI string, date string) string {
+	return strings.Trim(targetURI, "<>") + " " + date
+}
+
+// LookupRecord implements RecordIndex
+func (i *MemoryIndex) LookupRecord(recordID string) (RecordLocation, error) {
+	location, ok := i.records[recordID]
+	if !ok {
+		return location, errors.New("Record not found: " + recordID)
+	}
+	return location, nil
+}
+
+// LookupCapture implements RecordIndex
+func (i *MemoryIndex) LookupCapture(targetURI string, date string) (RecordLocation, error) {
+	location, ok := i.captures[captureKey(targetURI, date)]
+	if !ok {
+		return location, errors.New("Capture not found: " + targetURI + " at " + date)
+	}
+	return location, nil
+}
+
+// ReadRecordAt reads the record located at offset in the WARC file at
+// path, path can be an HTTP(S) URL. The record content is read in memory.
+func ReadRecordAt(path string, offset int64) (*Record, error) {
+	var reader *Reader
+
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		var err error
+		reader, err = OpenRemote(path, offset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		reader, err = NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		reader.closer = file
+	}
+	defer reader.Close()
+
+	return reader.ReadRecord(false)
+}
+
+// readRecordAt reads the record located at offset in the file at
+// path opened with open, skipping to the offset if it can't seek
+func readRecordAt(open openFileFunc, path string, offset int64) (*Record, error) {
+	file, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, file, offset)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	defer reader.Close()
+
+	return reader.ReadRecord(false)
+}
+
+// ResolveRevisit finds the original record a revisit record refers to
+// using index, following chains of revisits, and returns the
+// reconstructed response: the revisit record's header and HTTP headers,
+// if it has any, followed by the original record's payload.
+func ResolveRevisit(revisit *Record, index RecordIndex) (*Record, error) {
+	if revisit.Header.Get("WARC-Type") != "revisit" {
+		return nil, errors.New("Not a revisit record: " + revisit.Header.Get("WARC-Record-ID"))
+	}
+
+	original := revisit
+	for i := 0; original.Header.Get("WARC-Type") == "revisit"; i++ {
+		if i == maxRevisitChain {
+			return nil, errors.New("Revisit chain too long: " + revisit.Header.Get("WARC-Record-ID"))
+		}
+
+		location, err := lookupRefersTo(original, index)
+		if err != nil {
+			return nil, err
+		}
+
+		if opener, ok := index.(*MemoryIndex); ok && opener.open != nil {
+			original, err = readRecordAt(opener.open, location.Path, location.Offset)
+		} else {
+			original, err = ReadRecordAt(location.Path, location.Offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	revisitBlock, err := readBlock(revisit)
+	if err != nil {
+		return nil, err
+	}
+
+	originalBlock, err := readBlock(original)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the HTTP headers of the revisit, as they are the ones
+	// of the capture, in front of the original payload
+	block := originalBlock
+	if bytes.HasPrefix(revisitBlock, []byte("HTTP/")) {
+		if end := bytes.Index(originalBlock, []byte("\r\n\r\n")); end != -1 {
+			block = append(append([]byte(nil), revisitBlock...), originalBlock[end+4:]...)
+		}
+	}
+
+	header := revisit.Header.Clone()
+	header.Set("WARC-Type", original.Header.Get("WARC-Type"))
+	header.Set("Content-Length", strconv.Itoa(len(block)))
+	header.Del("WARC-Profile")
+	header.Del("WARC-Block-Digest")
+	header.Del("WARC-Truncated")
+	if digest := original.Header.Get("WARC-Payload-Digest"); digest != "" {
+		header.Set("WARC-Payload-Digest", digest)
+	}
+
+	return &Record{
+		Header:  header,
+		Content: bytes.NewReader(block),
+	}, nil
+}
+
+// lookupRefersTo locates the record a revisit record refers to, by its
+// WARC-Refers-To or by its WARC-Refers-To-Target-URI and WARC-Refers-To-Date
+func lookupRefersTo(revisit *Record, index RecordIndex) (RecordLocation, error) {
+	refersTo := revisit.RefersTo()
+	if refersTo.RecordID != "" {
+		return index.LookupRecord(refersTo.RecordID)
+	}
+
+	if refersTo.TargetURI == "" || refersTo.Date == "" {
+		return RecordLocation{}, errors.New("Revisit record doesn't refer to any record: " + revisit.Header.Get("WARC-Record-ID"))
+	}
+
+	return index.LookupCapture(refersTo.TargetURI, refersTo.Date)
+}
+
+// readBlock reads the block of a record, leaving
+// the record content readable from the start
+func readBlock(record *Record) ([]byte, error) {
+	if record.PayloadPath != "" {
+		return ioutil.ReadFile(record.PayloadPath)
+	}
+
+	if record.Content == nil {
+		return nil, nil
+	}
+
+	block, err := ioutil.ReadAll(record.Content)
+	if err != nil {
+		return nil, err
+	}
+	record.Content = bytes.NewReader(block)
+
+	return block, nil
+}
@@ -0,0 +1,128 @@
+package warc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for the ResolveRevisit function
+func TestResolveRevisit(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-revisit-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "test.warc.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create WARC file: %v", err)
+	}
+
+	memberWriter, err := NewMemberWriter(file, CompressionGZIP)
+	if err != nil {
+		t.Fatalf("failed to create member writer: %v", err)
+	}
+
+	writer, err := NewWriter(memberWriter, "test.warc.gz", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+
+	response := NewRecord()
+	response.Header.Set("WARC-Type", "response")
+	response.Header.Set("WARC-Target-URI", "https://example.com/")
+	response.Header.Set("WARC-Date", "2021-05-04T10:11:12Z")
+	response.Content = strings.NewReader("HTTP/1.1 200 OK\r\nDate: Tue, 04 May 2021\r\n\r\nHello, World!")
+
+	revisit := NewRecord()
+	revisit.Header.Set("WARC-Type", "revisit")
+	revisit.Header.Set("WARC-Target-URI", "https://example.com/")
+	revisit.Header.Set("WARC-Date", "2021-06-04T10:11:12Z")
+	revisit.Header.Set("WARC-Profile", "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest")
+	revisit.Header.Set("WARC-Refers-To-Target-URI", "https://example.com/")
+	revisit.Header.Set("WARC-Refers-To-Date", "2021-05-04T10:11:12Z")
+	revisit.Content = strings.NewReader("HTTP/1.1 200 OK\r\nDate: Fri, 04 Jun 2021\r\n\r\n")
+
+	for _, record := range []*Record{response, revisit} {
+		memberWriter.Begin()
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("error while writing test record: %v", err)
+		}
+		memberWriter.End()
+	}
+	file.Close()
+
+	index, err := IndexFiles([]string{path})
+	if err != nil {
+		t.Fatalf("failed to index WARC file: %v", err)
+	}
+
+	location, err := index.LookupRecord(revisit.Header.Get("WARC-Record-ID"))
+	if err != nil {
+		t.Fatalf("failed to look up revisit record: %v", err)
+	}
+
+	record, err := ReadRecordAt(location.Path, location.Offset)
+	if err != nil {
+		t.Fatalf("failed to read revisit record: %v", err)
+	}
+
+	resolved, err := ResolveRevisit(record, index)
+	if err != nil {
+		t.Fatalf("failed to resolve revisit record: %v", err)
+	}
+
+	content, err := ioutil.ReadAll(resolved.Content)
+	if err != nil {
+		t.Fatalf("failed to read resolved record: %v", err)
+	}
+
+	expected := "HTTP/1.1 200 OK\r\nDate: Fri, 04 Jun 2021\r\n\r\nHello, World!"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+
+	if resolved.Header.Get("WARC-Type") != "response" || resolved.Header.Get("WARC-Date") != "2021-06-04T10:11:12Z" {
+		t.Errorf("unexpected resolved header %v", resolved.Header)
+	}
+}
+
+// Tests for the MemoryIndex.Captures method
+func TestMemoryIndexCaptures(t *testing.T) {
+	index, err := IndexFiles([]string{"testdata/test.warc.gz"})
+	if err != nil {
+		t.Fatalf("failed to index WARC file: %v", err)
+	}
+
+	// https://google.com/ and https://www.google.com/ share their SURT
+	captures := index.Captures("http://google.com")
+	if len(captures) != 2 {
+		t.Fatalf("expected 2 captures, got %d", len(captures))
+	}
+
+	statusCodes := map[int]bool{}
+	for i, capture := range captures {
+		if i > 0 && capture.Date < captures[i-1].Date {
+			t.Errorf("captures aren't sorted by date: %s before %s", captures[i-1].Date, capture.Date)
+		}
+
+		record, err := ReadRecordAt(capture.Path, capture.Offset)
+		if err != nil {
+			t.Fatalf("failed to read capture: %v", err)
+		}
+
+		if record.Header.Get("WARC-Record-ID") != capture.RecordID {
+			t.Errorf("expected record %s at offset %d, got %s", capture.RecordID, capture.Offset, record.Header.Get("WARC-Record-ID"))
+		}
+
+		statusCodes[capture.StatusCode] = true
+	}
+
+	if !statusCodes[301] || !statusCodes[200] {
+		t.Errorf("expected 301 and 200 status codes, got %v", statusCodes)
+	}
+}
@@ -0,0 +1,90 @@
+package warc
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+)
+
+// Sample calls fn with a deterministic sample of the records of the WARC
+// files at paths, rate being the fraction of the records to keep, between
+// 0 and 1. Records are selected by hashing their digest with seed, so that
+// the same seed gives the same subset of a collection, and captures of the
+// same content are selected together. The record content is read on disk,
+// and removed once fn returns. If fn returns an error, the sampling stops
+// and Sample returns it.
+func Sample(paths []string, rate float64, seed int64, fn func(record *Record) error) error {
+	return sample(openOSFile, paths, rate, seed, fn)
+}
+
+func sample(open openFileFunc, paths []string, rate float64, seed int64, fn func(record *Record) error) error {
+	if rate < 0 || rate > 1 {
+		return errors.New("Sampling rate must be between 0 and 1")
+	}
+
+	for _, path := range paths {
+		if err := sampleFile(open, path, rate, seed, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sampleFile(open openFileFunc, path string, rate float64, seed int64, fn func(record *Record) error) error {
+	file, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.ReadRecord(true)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if isSampled(record, rate, seed) {
+			err = fn(record)
+		}
+		os.Remove(record.PayloadPath)
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isSampled returns true if the hash of the record's digest and
+// seed, mapped between 0 and 1, is below rate
+func isSampled(record *Record, rate float64, seed int64) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	key := record.Header.Get("WARC-Payload-Digest")
+	if key == "" {
+		key = record.Header.Get("WARC-Block-Digest")
+	}
+	if key == "" {
+		key = record.Header.Get("WARC-Record-ID")
+	}
+
+	hash := fnv.New64a()
+	binary.Write(hash, binary.BigEndian, seed)
+	hash.Write([]byte(key))
+
+	return float64(hash.Sum64())/math.MaxUint64 < rate
+}
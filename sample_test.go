@@ -0,0 +1,42 @@
+package warc
+
+import "testing"
+
+// Tests for the Sample function
+func TestSample(t *testing.T) {
+	sample := func(rate float64, seed int64) []string {
+		var recordIDs []string
+
+		err := Sample([]string{"testdata/test.warc.gz"}, rate, seed, func(record *Record) error {
+			recordIDs = append(recordIDs, record.Header.Get("WARC-Record-ID"))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("sampling failed: %v", err)
+		}
+
+		return recordIDs
+	}
+
+	if count := len(sample(1, 42)); count != 19 {
+		t.Errorf("expected all 19 records with a rate of 1, got %d", count)
+	}
+
+	if count := len(sample(0, 42)); count != 0 {
+		t.Errorf("expected no record with a rate of 0, got %d", count)
+	}
+
+	first, second := sample(0.5, 42), sample(0.5, 42)
+	if len(first) != len(second) {
+		t.Fatalf("expected the same sample with the same seed, got %d and %d records", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("expected the same sample with the same seed, got %s and %s", first[i], second[i])
+		}
+	}
+
+	if err := Sample(nil, 2, 42, nil); err == nil {
+		t.Error("expected an error for a rate above 1")
+	}
+}
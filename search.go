@@ -0,0 +1,120 @@
+package warc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// searchSnippetSize is the maximum size of the text snippet of a SearchDocument
+const searchSnippetSize = 500
+
+// htmlTitle matches the title of HTML payloads
+var htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// SearchDocument is the document indexed for a record by a search sink
+type SearchDocument struct {
+	URL     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	Snippet string `json:"snippet"`
+	Date    string `json:"date"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// NewSearchDocument returns the search document of a record whose
+// text was extracted, the title being read from HTML payloads
+func NewSearchDocument(record *Record, text string) (*SearchDocument, error) {
+	document := &SearchDocument{
+		URL:    strings.Trim(record.Header.Get("WARC-Target-URI"), "<>"),
+		Date:   record.Header.Get("WARC-Date"),
+		Digest: record.Header.Get("WARC-Payload-Digest"),
+	}
+
+	snippet := []rune(text)
+	if len(snippet) > searchSnippetSize {
+		snippet = snippet[:searchSnippetSize]
+	}
+	document.Snippet = string(snippet)
+
+	mediaType, payload, err := record.decodedPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	if payload != nil {
+		defer payload.Close()
+
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			head, err := ioutil.ReadAll(io.LimitReader(payload, sniffSize))
+			if err != nil {
+				return nil, err
+			}
+
+			if match := htmlTitle.FindSubmatch(head); match != nil {
+				title := html.UnescapeString(string(match[1]))
+				document.Title = strings.TrimSpace(whitespaces.ReplaceAllString(title, " "))
+			}
+		}
+	}
+
+	return document, nil
+}
+
+// ElasticsearchSink indexes the records whose text was extracted into an
+// Elasticsearch index, its IndexRecord method is a TextSink, e.g.
+//
+//	pool := NewExtractionPool(HTMLExtractor{}, 4, 1000, sink.IndexRecord)
+type ElasticsearchSink struct {
+	// URL of the Elasticsearch server, e.g. http://localhost:9200
+	URL string
+	// Index the documents are added to
+	Index string
+	// Client used for the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// IndexRecord adds the search document of record to the index,
+// the record ID being used as the document ID
+func (s *ElasticsearchSink) IndexRecord(record *Record, text string) error {
+	document, err := NewSearchDocument(record, text)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	id := strings.TrimPrefix(strings.Trim(record.Header.Get("WARC-Record-ID"), "<>"), "urn:uuid:")
+
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(s.URL, "/")+"/"+s.Index+"/_doc/"+id, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return errors.New("Elasticsearch indexing failed: " + resp.Status)
+	}
+
+	return nil
+}
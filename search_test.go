@@ -0,0 +1,84 @@
+package warc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Tests that the rotator feeds its extraction pool and
+// that ElasticsearchSink indexes the extracted records
+func TestElasticsearchSink(t *testing.T) {
+	var mu sync.Mutex
+	documents := make(map[string]SearchDocument)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var document SearchDocument
+		if r.Method != http.MethodPut || json.NewDecoder(r.Body).Decode(&document) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		documents[r.URL.Path] = document
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	sink := &ElasticsearchSink{URL: server.URL, Index: "crawl"}
+	pool := NewExtractionPool(HTMLExtractor{}, 2, 10, sink.IndexRecord)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.ExtractionPool = pool
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Header.Set("Content-Type", "application/http; msgtype=response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" +
+		"<html><head><title>Example &amp; Co</title></head><body>Hello, World!</body></html>")
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("indexing failed: %v", err)
+	}
+
+	id := strings.TrimPrefix(strings.Trim(record.Header.Get("WARC-Record-ID"), "<>"), "urn:uuid:")
+	document, ok := documents["/crawl/_doc/"+id]
+	if !ok {
+		t.Fatalf("expected the record to be indexed, got %v", documents)
+	}
+
+	if document.URL != "http://example.com/" || document.Title != "Example & Co" {
+		t.Errorf("unexpected document %+v", document)
+	}
+
+	if !strings.Contains(document.Snippet, "Hello, World!") || document.Date == "" {
+		t.Errorf("unexpected document %+v", document)
+	}
+}
@@ -0,0 +1,209 @@
+package warc
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// settingsFile is the content of a settings file read by LoadSettings.
+// It only has the options of RotatorSettings that can be written in
+// JSON, the hooks, pools and stores being set in code.
+type settingsFile struct {
+	WarcinfoContent      map[string]string `json:"warcinfoContent"`
+	Prefix               string            `json:"prefix"`
+	Hostname             string            `json:"hostname"`
+	TimeZone             string            `json:"timeZone"`
+	TimestampResolution  string            `json:"timestampResolution"`
+	Collection           string            `json:"collection"`
+	CrawlID              string            `json:"crawlID"`
+	CrawlIDField         bool              `json:"crawlIDField"`
+	Compression          string            `json:"compression"`
+	WarcSize             float64           `json:"warcSize"`
+	OutputDirectory      string            `json:"outputDirectory"`
+	TempDirectory        string            `json:"tempDirectory"`
+	SpilloverDirectories []string          `json:"spilloverDirectories"`
+	MinFreeSpace         float64           `json:"minFreeSpace"`
+	DirectoryQuota       float64           `json:"directoryQuota"`
+	IdentifyPayloadType  bool              `json:"identifyPayloadType"`
+	Simhash              bool              `json:"simhash"`
+	FailAfter            int               `json:"failAfter"`
+	FailOnDiskFull       bool              `json:"failOnDiskFull"`
+	CoalesceLatency      string            `json:"coalesceLatency"`
+	CheckpointPath       string            `json:"checkpointPath"`
+	CrawlReport          bool              `json:"crawlReport"`
+	// Dedup makes the rotator deduplicate the payloads
+	// with a MemoryDedupStore
+	Dedup           bool   `json:"dedup"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	CDXJ            bool   `json:"cdxj"`
+	SkippableFrames bool   `json:"skippableFrames"`
+}
+
+// LoadSettings reads RotatorSettings from a JSON file, fields that are
+// not present in the file keep their default value. The fields are named
+// after the ones of RotatorSettings, e.g. "warcSize", durations being
+// written as strings, e.g. "100ms", and the time zone as a location
+// name, e.g. "Europe/Paris". "dedup" makes the rotator deduplicate the
+// payloads with a MemoryDedupStore. Unknown fields are rejected, and the
+// settings are validated. Settings can then be overridden with the
+// following environment variables: WARC_PREFIX, WARC_COMPRESSION,
+// WARC_SIZE and WARC_OUTPUT_DIRECTORY. If path is empty, only the
+// defaults and the environment are used.
+func LoadSettings(path string) (*RotatorSettings, error) {
+	defaults := NewRotatorSettings()
+
+	config := &settingsFile{
+		Prefix:          defaults.Prefix,
+		Compression:     defaults.Compression,
+		WarcSize:        defaults.WarcSize,
+		OutputDirectory: defaults.OutputDirectory,
+	}
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			return nil, errors.New("Invalid settings " + path + ": " + err.Error())
+		}
+	}
+
+	if err := loadSettingsFromEnv(config); err != nil {
+		return nil, err
+	}
+
+	return config.settings()
+}
+
+// settings validates the settings of the file, then returns them
+func (c *settingsFile) settings() (*RotatorSettings, error) {
+	settings := NewRotatorSettings()
+
+	// Header keys are expected to be lower case, which the JSON
+	// decoder doesn't enforce
+	for key, value := range c.WarcinfoContent {
+		settings.WarcinfoContent.Set(key, value)
+	}
+
+	// Check if the specified compression algorithm is valid
+	if err := checkCompression(c.Compression); err != nil {
+		return nil, err
+	}
+
+	// Check if the specified digest algorithm is registered
+	if _, err := lookupDigestAlgorithm(c.DigestAlgorithm); err != nil {
+		return nil, err
+	}
+
+	for _, size := range []struct {
+		name  string
+		value float64
+	}{
+		{"WARC size", c.WarcSize},
+		{"minimum free space", c.MinFreeSpace},
+		{"directory quota", c.DirectoryQuota},
+	} {
+		if size.value < 0 {
+			return nil, errors.New("Invalid " + size.name + ": " + strconv.FormatFloat(size.value, 'f', -1, 64))
+		}
+	}
+
+	if c.FailAfter < 0 {
+		return nil, errors.New("Invalid number of failures: " + strconv.Itoa(c.FailAfter))
+	}
+
+	if c.TimeZone != "" {
+		location, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return nil, errors.New("Invalid time zone: " + c.TimeZone)
+		}
+		settings.TimeZone = location
+	}
+
+	var err error
+	settings.TimestampResolution, err = parseSettingsDuration("timestamp resolution", c.TimestampResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.CoalesceLatency, err = parseSettingsDuration("coalesce latency", c.CoalesceLatency)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Prefix = c.Prefix
+	settings.Hostname = c.Hostname
+	settings.Collection = c.Collection
+	settings.CrawlID = c.CrawlID
+	settings.CrawlIDField = c.CrawlIDField
+	settings.Compression = c.Compression
+	settings.WarcSize = c.WarcSize
+	settings.OutputDirectory = c.OutputDirectory
+	settings.TempDirectory = c.TempDirectory
+	settings.SpilloverDirectories = c.SpilloverDirectories
+	settings.MinFreeSpace = c.MinFreeSpace
+	settings.DirectoryQuota = c.DirectoryQuota
+	settings.IdentifyPayloadType = c.IdentifyPayloadType
+	settings.Simhash = c.Simhash
+	settings.FailAfter = c.FailAfter
+	settings.FailOnDiskFull = c.FailOnDiskFull
+	settings.CheckpointPath = c.CheckpointPath
+	settings.CrawlReport = c.CrawlReport
+	settings.DigestAlgorithm = c.DigestAlgorithm
+	settings.CDXJ = c.CDXJ
+	settings.SkippableFrames = c.SkippableFrames
+
+	if c.Dedup {
+		settings.Dedup = NewMemoryDedupStore()
+	}
+
+	return settings, nil
+}
+
+// parseSettingsDuration parses a non-negative duration of a settings
+// file, e.g. "100ms", zero if it is empty
+func parseSettingsDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, errors.New("Invalid " + name + ": " + value)
+	}
+	return duration, nil
+}
+
+// loadSettingsFromEnv overrides settings with the values
+// of the WARC_* environment variables, if they are set
+func loadSettingsFromEnv(config *settingsFile) error {
+	if prefix, ok := os.LookupEnv("WARC_PREFIX"); ok {
+		config.Prefix = prefix
+	}
+
+	if compression, ok := os.LookupEnv("WARC_COMPRESSION"); ok {
+		config.Compression = compression
+	}
+
+	if size, ok := os.LookupEnv("WARC_SIZE"); ok {
+		warcSize, err := strconv.ParseFloat(size, 64)
+		if err != nil {
+			return errors.New("Invalid WARC_SIZE: " + size)
+		}
+		config.WarcSize = warcSize
+	}
+
+	if outputDirectory, ok := os.LookupEnv("WARC_OUTPUT_DIRECTORY"); ok {
+		config.OutputDirectory = outputDirectory
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package warc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Tests for the LoadSettings function
+func TestLoadSettings(t *testing.T) {
+	file, err := ioutil.TempFile("", "warc-settings-*.json")
+	if err != nil {
+		t.Fatalf("failed to create settings file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`{"Prefix": "TEST", "WarcSize": 250, "WarcinfoContent": {"Operator": "tester"}}`)
+	file.Close()
+	if err != nil {
+		t.Fatalf("failed to write settings file: %v", err)
+	}
+
+	os.Setenv("WARC_COMPRESSION", CompressionNone)
+	defer os.Unsetenv("WARC_COMPRESSION")
+
+	settings, err := LoadSettings(file.Name())
+	if err != nil {
+		t.Fatalf("failed to load settings: %v", err)
+	}
+
+	if settings.Prefix != "TEST" {
+		t.Error("Failed to load WARC rotator's filename prefix")
+	}
+
+	if settings.WarcSize != 250 {
+		t.Error("Failed to load WARC rotator's WARC size")
+	}
+
+	if settings.Compression != CompressionNone {
+		t.Error("Failed to override WARC rotator's compression algorithm")
+	}
+
+	if settings.OutputDirectory != "./" {
+		t.Error("Failed to keep WARC rotator's default output directory")
+	}
+
+	if settings.WarcinfoContent.Get("operator") != "tester" {
+		t.Error("Failed to load warcinfo content")
+	}
+
+	os.Setenv("WARC_COMPRESSION", "LZMA")
+	if _, err := LoadSettings(file.Name()); err == nil {
+		t.Error("Expected an error for an invalid compression algorithm")
+	}
+}
+
+// Tests that LoadSettings reads the options of the rotator
+// and rejects the invalid ones
+func TestLoadSettingsOptions(t *testing.T) {
+	file, err := ioutil.TempFile("", "warc-settings-*.json")
+	if err != nil {
+		t.Fatalf("failed to create settings file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	load := func(content string) (*RotatorSettings, error) {
+		if err := ioutil.WriteFile(file.Name(), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write settings file: %v", err)
+		}
+		return LoadSettings(file.Name())
+	}
+
+	settings, err := load(`{"failAfter": 3, "failOnDiskFull": true, "coalesceLatency": "100ms", "digestAlgorithm": "sha256", "dedup": true, "timeZone": "UTC"}`)
+	if err != nil {
+		t.Fatalf("failed to load settings: %v", err)
+	}
+
+	if settings.FailAfter != 3 || !settings.FailOnDiskFull || settings.CoalesceLatency != 100*time.Millisecond {
+		t.Errorf("failed to load the failure policy and coalescing, got %+v", settings)
+	}
+
+	if settings.DigestAlgorithm != "sha256" || settings.Dedup == nil || settings.TimeZone != time.UTC {
+		t.Errorf("failed to load the digest algorithm and dedup, got %+v", settings)
+	}
+
+	for _, content := range []string{
+		`{"warcSize": -1}`,
+		`{"minFreeSpace": -1}`,
+		`{"directoryQuota": -1}`,
+		`{"failAfter": -1}`,
+		`{"compression": "LZMA"}`,
+		`{"digestAlgorithm": "crc32"}`,
+		`{"coalesceLatency": "soon"}`,
+		`{"timeZone": "Nowhere/Land"}`,
+		`{"finalizeHook": "echo"}`,
+	} {
+		if _, err := load(content); err == nil {
+			t.Errorf("expected an error for the settings %s", content)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package warc
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSimhashSize is the maximum size of the decoded payload
+// read to compute its simhash
+const maxSimhashSize = 10 * 1024 * 1024
+
+// htmlMarkup matches the markup stripped from HTML payloads
+// before computing their simhash
+var htmlMarkup = regexp.MustCompile(`(?is)<script.*?</script>|<style.*?</style>|<[^>]*>`)
+
+// Simhash returns the 64 bits simhash of a text, computed over its
+// lower-cased words. Near-duplicate texts have simhashes differing by
+// a few bits only, see SimhashDistance.
+func Simhash(text string) uint64 {
+	var weights [64]int
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		sum := hash.Sum64()
+
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	var simhash uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			simhash |= 1 << uint(i)
+		}
+	}
+
+	return simhash
+}
+
+// SimhashDistance returns the number of bits differing between
+// two simhashes, the lower the more similar the texts are
+func SimhashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PayloadSimhash returns the simhash of the textual payload of a response
+// or resource record, the markup of HTML payloads being stripped. ok is
+// false if the payload isn't textual. The record content can still be
+// read from the start afterwards.
+func (r *Record) PayloadSimhash() (simhash uint64, ok bool, err error) {
+	mediaType, payload, err := r.decodedPayload()
+	if err != nil || payload == nil {
+		return 0, false, err
+	}
+	defer payload.Close()
+
+	if !strings.HasPrefix(mediaType, "text/") && !strings.HasSuffix(mediaType, "+xml") {
+		return 0, false, nil
+	}
+
+	text, err := ioutil.ReadAll(io.LimitReader(payload, maxSimhashSize))
+	if err != nil {
+		return 0, false, err
+	}
+
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		text = htmlMarkup.ReplaceAll(text, []byte(" "))
+	}
+
+	return Simhash(string(text)), true, nil
+}
+
+// newSimhashRecord returns a metadata record storing
+// the simhash of the payload of record
+func newSimhashRecord(record *Record, simhash uint64) *Record {
+	content := new(bytes.Buffer)
+	WriteWarcFields(content, Header{"simhash": strconv.FormatUint(simhash, 16)})
+
+	metadata := NewRecord()
+	metadata.Header.Set("WARC-Type", "metadata")
+	metadata.Header.Set("WARC-Target-URI", record.Header.Get("WARC-Target-URI"))
+	metadata.Header.Set("WARC-Refers-To", record.Header.Get("WARC-Record-ID"))
+	metadata.Header.Set("Content-Type", "application/warc-fields")
+	metadata.Content = content
+
+	return metadata
+}
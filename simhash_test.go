@@ -0,0 +1,122 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for the Simhash function
+func TestSimhash(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5) +
+		"WARC files store the captures of web archives, with their metadata."
+	nearDuplicate := strings.Replace(text, "metadata", "headers", 1)
+	different := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor."
+
+	if distance := SimhashDistance(Simhash(text), Simhash(nearDuplicate)); distance > 8 {
+		t.Errorf("expected near-duplicates to be close, got a distance of %d", distance)
+	}
+
+	if distance := SimhashDistance(Simhash(text), Simhash(different)); distance < 16 {
+		t.Errorf("expected different texts to be far apart, got a distance of %d", distance)
+	}
+}
+
+// Tests for the Record.PayloadSimhash method
+func TestRecordPayloadSimhash(t *testing.T) {
+	html := NewRecord()
+	html.Header.Set("WARC-Type", "response")
+	html.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<html><head><style>body { color: red }</style></head><body><p>Hello, World!</p></body></html>")
+
+	simhash, ok, err := html.PayloadSimhash()
+	if err != nil || !ok {
+		t.Fatalf("expected a simhash, got %v, %v", ok, err)
+	}
+
+	if simhash != Simhash("Hello, World!") {
+		t.Errorf("expected the markup to be stripped")
+	}
+
+	image := NewRecord()
+	image.Header.Set("WARC-Type", "response")
+	image.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: image/gif\r\n\r\nGIF89a")
+
+	if _, ok, err := image.PayloadSimhash(); ok || err != nil {
+		t.Errorf("expected no simhash for an image, got %v, %v", ok, err)
+	}
+}
+
+// Tests that the rotator writes simhash metadata records
+func TestRotatorSimhash(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.Simhash = true
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Header.Set("WARC-Target-URI", "https://example.com/")
+	record.Content = bytes.NewReader([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nHello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var types []string
+	var metadata *Record
+	for {
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			break
+		}
+		types = append(types, record.Header.Get("WARC-Type"))
+		metadata = record
+	}
+
+	if strings.Join(types, ",") != "warcinfo,response,metadata" {
+		t.Fatalf("unexpected records %v", types)
+	}
+
+	fields, err := ParseWarcFields(metadata.Content)
+	if err != nil {
+		t.Fatalf("failed to parse metadata: %v", err)
+	}
+
+	if fields.Get("simhash") == "" || metadata.Header.Get("WARC-Refers-To") != record.Header.Get("WARC-Record-ID") {
+		t.Errorf("unexpected simhash metadata %v %v", metadata.Header, fields)
+	}
+}
@@ -0,0 +1,164 @@
+package warc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HostStats are the statistics of the records written by
+// the rotator for a host, see RotatorSettings.TopHosts
+type HostStats struct {
+	Host string `json:"host"`
+	// Records is the number of records whose WARC-Target-URI is on the host
+	Records int `json:"records"`
+	// Bytes is the size of the blocks of the records
+	Bytes int64 `json:"bytes"`
+	// Errors is the number of responses with a 4xx or 5xx status code
+	Errors int `json:"errors"`
+	// Responses is the number of response records
+	Responses int `json:"responses"`
+	// Revisits is the number of revisit records
+	Revisits int `json:"revisits"`
+}
+
+// DedupRatio returns the proportion of the captures of the host, i.e. its
+// response and revisit records, that are revisit records
+func (h HostStats) DedupRatio() float64 {
+	if h.Responses+h.Revisits == 0 {
+		return 0
+	}
+	return float64(h.Revisits) / float64(h.Responses+h.Revisits)
+}
+
+// rotatorStats tracks the statistics of the records written by a rotator
+type rotatorStats struct {
+	mu    sync.Mutex
+	hosts map[string]*HostStats
+}
+
+// add counts a record once it is flushed to the file,
+// status being its HTTP status code, if any
+func (s *rotatorStats) add(record *Record, status int) {
+	target, err := url.Parse(strings.Trim(record.Header.Get("WARC-Target-URI"), "<>"))
+	if err != nil || target.Hostname() == "" {
+		return
+	}
+	host := strings.ToLower(target.Hostname())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hosts == nil {
+		s.hosts = make(map[string]*HostStats)
+	}
+
+	stats, ok := s.hosts[host]
+	if !ok {
+		stats = &HostStats{Host: host}
+		s.hosts[host] = stats
+	}
+
+	size, _ := strconv.ParseInt(record.Header.Get("Content-Length"), 10, 64)
+
+	stats.Records++
+	stats.Bytes += size
+	if status >= 400 {
+		stats.Errors++
+	}
+	switch record.Header.Get("WARC-Type") {
+	case "response":
+		stats.Responses++
+	case "revisit":
+		stats.Revisits++
+	}
+}
+
+// HostStats returns the statistics of the records written by the
+// rotator for each host, the hosts with the most records first
+func (s *RotatorSettings) HostStats() []HostStats {
+	return s.currentRotator().stats.list()
+}
+
+// list returns the statistics of each host,
+// the hosts with the most records first
+func (s *rotatorStats) list() []HostStats {
+	s.mu.Lock()
+	hosts := make([]HostStats, 0, len(s.hosts))
+	for _, stats := range s.hosts {
+		hosts = append(hosts, *stats)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Records != hosts[j].Records {
+			return hosts[i].Records > hosts[j].Records
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	return hosts
+}
+
+// listWith returns the statistics of each host, the records
+// written but not flushed yet being counted too
+func (s *rotatorStats) listWith(records []writtenRecord) []HostStats {
+	stats := &rotatorStats{hosts: make(map[string]*HostStats)}
+
+	s.mu.Lock()
+	for host, hostStats := range s.hosts {
+		hostStats := *hostStats
+		stats.hosts[host] = &hostStats
+	}
+	s.mu.Unlock()
+
+	for _, w := range records {
+		stats.add(w.record, w.status)
+	}
+
+	return stats.list()
+}
+
+// TopHosts returns the statistics of the n hosts with the most records
+// written by the rotator, it can be called while the rotator is running
+func (s *RotatorSettings) TopHosts(n int) []HostStats {
+	hosts := s.HostStats()
+	if n >= 0 && n < len(hosts) {
+		hosts = hosts[:n]
+	}
+	return hosts
+}
+
+// hostReport is a host in the crawl report record
+type hostReport struct {
+	HostStats
+	DedupRatio float64 `json:"dedupRatio"`
+}
+
+// newCrawlReportRecord returns a metadata record with
+// the statistics of all the hosts, as JSON
+func newCrawlReportRecord(hosts []HostStats) (*Record, error) {
+	report := struct {
+		Hosts []hostReport `json:"hosts"`
+	}{Hosts: make([]hostReport, 0, len(hosts))}
+
+	for _, host := range hosts {
+		report.Hosts = append(report.Hosts, hostReport{HostStats: host, DedupRatio: host.DedupRatio()})
+	}
+
+	content, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "metadata")
+	record.Header.Set("Content-Type", "application/json")
+	record.Content = bytes.NewReader(content)
+
+	return record, nil
+}
@@ -0,0 +1,165 @@
+package warc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that the rotator aggregates per-host statistics
+// and writes them in the crawl report record
+func TestRotatorHostStats(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.CrawlReport = true
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	batch := NewRecordBatch()
+	for _, capture := range []struct {
+		warcType string
+		url      string
+		status   string
+	}{
+		{"response", "http://example.com/", "200 OK"},
+		{"response", "http://example.com/missing", "404 Not Found"},
+		{"revisit", "http://EXAMPLE.com/", "200 OK"},
+		{"response", "https://example.org/", "200 OK"},
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", capture.warcType)
+		record.Header.Set("WARC-Target-URI", capture.url)
+		record.Content = strings.NewReader("HTTP/1.1 " + capture.status + "\r\n\r\n")
+		batch.Records = append(batch.Records, record)
+	}
+
+	// Requests aren't captures, they don't change the dedup ratio
+	request := NewRecord()
+	request.Header.Set("WARC-Type", "request")
+	request.Header.Set("WARC-Target-URI", "http://example.com/")
+	request.Content = strings.NewReader("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	batch.Records = append(batch.Records, request)
+
+	batch.Done = make(chan bool)
+	records <- batch
+	<-batch.Done
+
+	top := rotatorSettings.TopHosts(1)
+	if len(top) != 1 || top[0].Host != "example.com" {
+		t.Fatalf("expected example.com as top host, got %+v", top)
+	}
+
+	if top[0].Records != 4 || top[0].Errors != 1 || top[0].Responses != 2 || top[0].Revisits != 1 || top[0].Bytes == 0 {
+		t.Errorf("unexpected statistics %+v", top[0])
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	var last *Record
+	for {
+		record, err := reader.ReadRecord(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read record: %v", err)
+		}
+		last = record
+	}
+
+	var report struct {
+		Hosts []struct {
+			Host       string
+			Records    int
+			DedupRatio float64
+		}
+	}
+	if err := json.NewDecoder(last.Content).Decode(&report); err != nil {
+		t.Fatalf("failed to decode crawl report: %v", err)
+	}
+
+	if len(report.Hosts) != 2 || report.Hosts[0].Host != "example.com" || report.Hosts[1].Records != 1 {
+		t.Errorf("unexpected crawl report %+v", report)
+	}
+
+	if ratio := report.Hosts[0].DedupRatio; ratio < 0.33 || ratio > 0.34 {
+		t.Errorf("expected a dedup ratio of 1/3, got %f", ratio)
+	}
+}
+
+// Tests that the records of a batch that failed
+// aren't counted in the host statistics
+func TestRotatorHostStatsFailedBatch(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FailAfter = 2
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	// The first record is written before the second one fails
+	batch := NewRecordBatch()
+	for _, content := range []io.Reader{
+		strings.NewReader("Hello, World!"),
+		failingReader{err: errors.New("fail")},
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = content
+		batch.Records = append(batch.Records, record)
+	}
+	batch.Done = make(chan bool)
+	records <- batch
+
+	if <-batch.Done {
+		t.Fatalf("expected the batch to fail")
+	}
+
+	close(records)
+	<-done
+
+	if hosts := rotatorSettings.HostStats(); len(hosts) != 0 {
+		t.Errorf("expected no statistics, got %+v", hosts)
+	}
+}
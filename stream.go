@@ -0,0 +1,134 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// streamContent is the content of a record returned by StreamRecord,
+// read straight from the WARC file
+type streamContent struct {
+	content io.Reader
+	reader  *bufio.Reader
+	closed  bool
+}
+
+func (s *streamContent) Read(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, errors.New("Record content read after the next record")
+	}
+	return s.content.Read(p)
+}
+
+// StreamRecord reads the next record from the WARC file without reading
+// its content: the record's Content streams it from the file as it is
+// read, so that records of any size can be processed in constant memory.
+// The Content is only valid until the next call to StreamRecord or
+// ReadRecord, which skip the part of it left unread. Unlike ReadRecord,
+// StreamRecord needs the Content-Length of the records to be valid.
+func (r *Reader) StreamRecord() (*Record, error) {
+	if err := r.finishStream(); err != nil {
+		return nil, err
+	}
+
+	// Return the record read in advance by Warcinfo, if any
+	if r.pending != nil {
+		record := r.pending
+		r.pending = nil
+		return record, nil
+	}
+	r.readCount++
+	r.recordOffset = r.startOffset
+
+	tempReader := r.stream
+	if r.gzipReader != nil {
+		r.gzipReader.Multistream(false)
+		tempReader = bufio.NewReader(r.gzipReader)
+	}
+
+	version, rawHeader, header, err := readRecordHeader(tempReader)
+	if err != nil {
+		return nil, err
+	}
+
+	contentLength, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || contentLength < 0 {
+		return nil, errors.New("Invalid Content-Length: " + header.Get("Content-Length"))
+	}
+	if r.options.MaxRecordSize > 0 && contentLength > r.options.MaxRecordSize {
+		return nil, r.recordTooLarge(contentLength)
+	}
+
+	r.streaming = &streamContent{content: io.LimitReader(tempReader, contentLength), reader: tempReader}
+	record := &Record{
+		Header:    header,
+		Content:   r.streaming,
+		RawHeader: rawHeader,
+	}
+
+	// Keep the content of the first warcinfo record of the
+	// file, such records being small enough to be read in memory
+	if r.warcinfo == nil && header.Get("WARC-Type") == "warcinfo" {
+		content, err := ioutil.ReadAll(r.streaming)
+		if err != nil {
+			return nil, err
+		}
+		record.Content = bytes.NewReader(content)
+
+		r.warcinfo, err = readWarcinfo(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the record against the specification
+	if problems := r.checkRecord(record, string(version)); problems != nil && r.options.StrictSpec {
+		if err := r.finishStream(); err != nil {
+			return nil, err
+		}
+		return nil, problems
+	}
+
+	return record, nil
+}
+
+// finishStream skips the unread content of the record returned by
+// StreamRecord, if any, and moves to the next record
+func (r *Reader) finishStream() error {
+	if r.streaming == nil {
+		return nil
+	}
+	stream := r.streaming
+	r.streaming = nil
+
+	if _, err := io.Copy(ioutil.Discard, stream.content); err != nil {
+		return err
+	}
+	stream.closed = true
+
+	// The trailing CRLFs of a record read from a gzip
+	// member are dropped with the rest of the member
+	if r.gzipReader == nil {
+		if err := readRecordEnd(stream.reader); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(ioutil.Discard, stream.reader); err != nil {
+		return err
+	}
+
+	r.startOffset = r.offset()
+	r.reportProgress()
+
+	if r.gzipReader != nil {
+		// Reset the reader for the next block
+		if err := r.gzipReader.Reset(r.reader); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	return nil
+}
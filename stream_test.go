@@ -0,0 +1,117 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests for the Reader.StreamRecord method
+func TestReaderStreamRecord(t *testing.T) {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	records := 0
+	for {
+		record, err := reader.StreamRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to stream record %d: %v", records, err)
+		}
+		records++
+
+		// Every other record is only partially read, the
+		// rest of it must be skipped by the next call
+		if records%2 == 0 {
+			record.Content.Read(make([]byte, 10))
+			continue
+		}
+
+		content, err := ioutil.ReadAll(record.Content)
+		if err != nil {
+			t.Fatalf("failed to read record content: %v", err)
+		}
+
+		if hash := "sha1:" + GetSHA1(content); hash != record.Header.Get("WARC-Block-Digest") {
+			t.Errorf("record %d: expected %s, got %s", records, record.Header.Get("WARC-Block-Digest"), hash)
+		}
+	}
+
+	if records != 19 {
+		t.Errorf("expected 19 records, got %d", records)
+	}
+
+	warcinfo, err := reader.Warcinfo()
+	if err != nil || warcinfo == nil {
+		t.Errorf("expected the warcinfo fields, got %v", err)
+	}
+}
+
+// Tests the streaming of uncompressed records, mixed with ReadRecord
+func TestReaderStreamRecordUncompressed(t *testing.T) {
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	contents := []string{"first", strings.Repeat("second", 1000), "third"}
+	for _, content := range contents {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Content = strings.NewReader(content)
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+
+	reader, err := NewReader(output)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	first, err := reader.StreamRecord()
+	if err != nil {
+		t.Fatalf("failed to stream record: %v", err)
+	}
+	if content, _ := ioutil.ReadAll(first.Content); string(content) != contents[0] {
+		t.Errorf("expected %q, got %q", contents[0], content)
+	}
+
+	second, err := reader.StreamRecord()
+	if err != nil {
+		t.Fatalf("failed to stream record: %v", err)
+	}
+	second.Content.Read(make([]byte, 3))
+
+	third, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("failed to read record after a streamed one: %v", err)
+	}
+	if content, _ := ioutil.ReadAll(third.Content); string(content) != contents[2] {
+		t.Errorf("expected %q, got %q", contents[2], content)
+	}
+
+	if _, err := second.Content.Read(make([]byte, 3)); err == nil {
+		t.Error("expected an error reading a record content after the next record")
+	}
+
+	if _, err := reader.StreamRecord(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -5,15 +5,12 @@ import (
 	"compress/gzip"
 	"crypto/sha1"
 	"encoding/base32"
-	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"strconv"
 	"strings"
 	"time"
-
-	"github.com/klauspost/compress/zstd"
 )
 
 // GetSHA1 return the SHA1 of a []byte,
@@ -59,30 +56,51 @@ func NewWriter(writer io.Writer, fileName string, compression string) (*Writer,
 		if compression == "GZIP" {
 			gzipWriter := gzip.NewWriter(writer)
 			return &Writer{
-				FileName:    fileName,
-				Compression: compression,
-				GZIPWriter:  gzipWriter,
-				FileWriter:  bufio.NewWriter(gzipWriter),
+				FileName:          fileName,
+				Compression:       compression,
+				GZIPWriter:        gzipWriter,
+				CompressionWriter: gzipWriter,
+				FileWriter:        bufio.NewWriter(gzipWriter),
+				output:            writer,
 			}, nil
 		} else if compression == "ZSTD" {
-			zstdWriter, err := zstd.NewWriter(writer)
+			zstdWriter, err := newZSTDWriter(writer)
 			if err != nil {
 				return nil, err
 			}
 			return &Writer{
-				FileName:    fileName,
-				Compression: compression,
-				ZSTDWriter:  zstdWriter,
-				FileWriter:  bufio.NewWriter(zstdWriter),
+				FileName:          fileName,
+				Compression:       compression,
+				ZSTDWriter:        zstdWriter,
+				CompressionWriter: zstdWriter,
+				FileWriter:        bufio.NewWriter(zstdWriter),
+				output:            writer,
 			}, nil
 		}
-		return nil, errors.New("Invalid compression algorithm: " + compression)
+
+		// Compression algorithms registered with RegisterCompression
+		codec, err := lookupCompression(compression)
+		if err != nil {
+			return nil, err
+		}
+		compressionWriter, err := codec.newWriter(writer)
+		if err != nil {
+			return nil, err
+		}
+		return &Writer{
+			FileName:          fileName,
+			Compression:       compression,
+			CompressionWriter: compressionWriter,
+			FileWriter:        bufio.NewWriter(compressionWriter),
+			output:            writer,
+		}, nil
 	}
 
 	return &Writer{
 		FileName:    fileName,
 		Compression: "",
 		FileWriter:  bufio.NewWriter(writer),
+		output:      writer,
 	}, nil
 }
 
@@ -97,7 +115,7 @@ func NewRecord() *Record {
 // it also initialize the capture time
 func NewRecordBatch() *RecordBatch {
 	return &RecordBatch{
-		CaptureTime: time.Now().UTC().Format(time.RFC3339),
+		CaptureTime: FormatDate(time.Now(), Version10),
 	}
 }
 
@@ -116,30 +134,28 @@ func NewRotatorSettings() *RotatorSettings {
 // checkRotatorSettings validate RotatorSettings settings, and set
 // default values if needed
 func checkRotatorSettings(settings *RotatorSettings) (err error) {
-	// Get host name as reported by the kernel
-	hostName, err := os.Hostname()
-	if err != nil {
-		panic(err)
-	}
-
 	// Check if output directory is specified, if not, set it to the current directory
 	if settings.OutputDirectory == "" {
 		settings.OutputDirectory = "./"
-	} else {
-		// If it is specified, check if output directory exist
-		if _, err := os.Stat(settings.OutputDirectory); os.IsNotExist(err) {
-			// If it doesn't exist, create it
-			// MkdirAll will create all parent directories if needed
-			err = os.MkdirAll(settings.OutputDirectory, os.ModePerm)
-			if err != nil {
-				return err
-			}
+	}
+
+	settings.OutputDirectory, err = prepareOutputDirectory(settings.OutputDirectory)
+	if err != nil {
+		return err
+	}
+
+	if settings.TempDirectory != "" {
+		settings.TempDirectory, err = prepareOutputDirectory(settings.TempDirectory)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Add a trailing slash to the output directory
-	if settings.OutputDirectory[len(settings.OutputDirectory)-1:] != "/" {
-		settings.OutputDirectory = settings.OutputDirectory + "/"
+	for i, directory := range settings.SpilloverDirectories {
+		settings.SpilloverDirectories[i], err = prepareOutputDirectory(directory)
+		if err != nil {
+			return err
+		}
 	}
 
 	// If prefix isn't specified, set it to "WARC"
@@ -153,42 +169,164 @@ func checkRotatorSettings(settings *RotatorSettings) (err error) {
 	}
 
 	// Check if the specified compression algorithm is valid
-	if settings.Compression != "" && settings.Compression != "GZIP" && settings.Compression != "ZSTD" {
-		return errors.New("Invalid compression algorithm: " + settings.Compression)
+	if err := checkCompression(settings.Compression); err != nil {
+		return err
 	}
 
-	// Add few headers to the warcinfo payload, to not have it empty
-	settings.WarcinfoContent.Set("hostname", hostName)
-	settings.WarcinfoContent.Set("format", "WARC file version 1.0")
-	settings.WarcinfoContent.Set("conformsTo", "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.0/")
+	// Check if the specified digest algorithm is registered
+	if _, err := lookupDigestAlgorithm(settings.DigestAlgorithm); err != nil {
+		return err
+	}
+
+	return addWarcinfoFields(settings, settings.WarcinfoContent)
+}
+
+// addWarcinfoFields adds few fields to the content
+// of a warcinfo record, to not have it empty
+func addWarcinfoFields(settings *RotatorSettings, content Header) error {
+	hostName, err := settings.hostname()
+	if err != nil {
+		return err
+	}
+
+	content.Set("hostname", hostName)
+	content.Set("format", "WARC file version 1.0")
+	content.Set("conformsTo", "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.0/")
+
+	// Label all the WARC files with the collection they are part of
+	if settings.Collection != "" {
+		content.Set("isPartOf", settings.Collection)
+	}
+
+	if settings.CrawlID != "" {
+		content.Set("crawlID", settings.CrawlID)
+	}
 
 	return nil
 }
 
+// prepareOutputDirectory creates an output directory if it doesn't
+// exist, and returns its path with a trailing slash
+func prepareOutputDirectory(directory string) (string, error) {
+	// Check if output directory exist
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		// If it doesn't exist, create it
+		// MkdirAll will create all parent directories if needed
+		err = os.MkdirAll(directory, os.ModePerm)
+		if err != nil {
+			return directory, err
+		}
+	}
+
+	// Add a trailing slash to the output directory
+	if directory[len(directory)-1:] != "/" {
+		directory = directory + "/"
+	}
+
+	return directory, nil
+}
+
+// moveFile moves src to dst. If they are on different file systems, src
+// is copied to dst with the .open suffix, then renamed to dst, so that dst
+// never exists partially written.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst+".open"); err != nil {
+		os.Remove(dst + ".open")
+		return err
+	}
+
+	if err := os.Rename(dst+".open", dst); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst, and syncs dst to disk
+func copyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+
+	if err := destination.Sync(); err != nil {
+		destination.Close()
+		return err
+	}
+
+	return destination.Close()
+}
+
+// isDirectoryFull returns true if the free space of the file system
+// of directory is below settings.MinFreeSpace, or if the WARC files in
+// directory reached settings.DirectoryQuota
+func isDirectoryFull(settings *RotatorSettings, directory string) bool {
+	if settings.MinFreeSpace > 0 {
+		if freeSpace, ok := diskFreeSpace(directory); ok && float64(freeSpace)/1024/1024 < settings.MinFreeSpace {
+			return true
+		}
+	}
+
+	if settings.DirectoryQuota > 0 {
+		files, err := ioutil.ReadDir(directory)
+		if err != nil {
+			return false
+		}
+
+		var used int64
+		for _, file := range files {
+			if strings.Contains(file.Name(), ".warc") {
+				used += file.Size()
+			}
+		}
+
+		if float64(used)/1024/1024 >= settings.DirectoryQuota {
+			return true
+		}
+	}
+
+	return false
+}
+
 // isFielSizeExceeded compare the size of a file (filePath) with
 // a max size (maxSize), if the size of filePath exceed maxSize,
 // it returns true, else, it returns false
-func isFileSizeExceeded(filePath string, maxSize float64) bool {
+func isFileSizeExceeded(filePath string, maxSize float64) (bool, error) {
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	defer file.Close()
 
 	// Get actual file size
 	stat, err := file.Stat()
 	if err != nil {
-		panic(err)
+		return false, err
 	}
-	fileSize := (float64)((stat.Size() / 1024) / 1024)
+	fileSize := float64(stat.Size()) / 1024 / 1024
 
 	// If fileSize exceed maxSize, return true
 	if fileSize >= maxSize {
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
 // formatSerial add the correct padding to the serial
@@ -198,28 +336,53 @@ func formatSerial(serial int, format string) string {
 	return fmt.Sprintf("%0"+format+"d", serial)
 }
 
-// generateWarcFileName generate a WARC file name following recommendations
-// of the specs:
+// GenerateWarcFileName generates the name of a WARC file following the
+// recommendations of the specs, using the Prefix, Compression, Hostname,
+// TimeZone and TimestampResolution of settings:
 // Prefix-Timestamp-Serial-Crawlhost.warc.gz
-func generateWarcFileName(prefix string, compression string, serial int) (fileName string) {
-	// Get host name as reported by the kernel
-	hostName, err := os.Hostname()
+func GenerateWarcFileName(settings *RotatorSettings, serial int, date time.Time) (fileName string, err error) {
+	hostName, err := settings.hostname()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	formattedSerial := formatSerial(serial, "5")
-
-	now := time.Now().UTC()
-	date := now.Format("20060102150405") + strconv.Itoa(now.Nanosecond())[:3]
+	location := settings.TimeZone
+	if location == nil {
+		location = time.UTC
+	}
 
-	if compression != "" {
-		if compression == "GZIP" {
-			return prefix + "-" + date + "-" + formattedSerial + "-" + hostName + ".warc.gz.open"
-		}
-		if compression == "ZSTD" {
-			return prefix + "-" + date + "-" + formattedSerial + "-" + hostName + ".warc.zst.open"
+	extension := ".warc"
+	if settings.Compression != "" {
+		if codec, err := lookupCompression(settings.Compression); err == nil {
+			extension += codec.extension
 		}
 	}
-	return prefix + "-" + date + "-" + formattedSerial + "-" + hostName + ".warc.open"
+
+	return settings.Prefix + "-" + formatTimestamp(date.In(location), settings.TimestampResolution) + "-" + formatSerial(serial, "5") + "-" + hostName + extension, nil
+}
+
+// formatTimestamp formats the timestamp of a WARC file name, with as
+// many fractional digits as needed by resolution, milliseconds by default
+func formatTimestamp(date time.Time, resolution time.Duration) string {
+	if resolution <= 0 {
+		resolution = time.Millisecond
+	}
+
+	digits := 0
+	for unit := time.Second; unit > resolution && digits < 9; unit /= 10 {
+		digits++
+	}
+
+	return date.Format("20060102150405") + fmt.Sprintf("%09d", date.Nanosecond())[:digits]
+}
+
+// hostname returns the host name written in the WARC file
+// names and warcinfo records, Hostname if it is set
+func (s *RotatorSettings) hostname() (string, error) {
+	if s.Hostname != "" {
+		return s.Hostname, nil
+	}
+
+	// Get host name as reported by the kernel
+	return os.Hostname()
 }
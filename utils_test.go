@@ -1,6 +1,12 @@
 package warc
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
 
 // Tests for the GetSHA1 function
 func TestGetSHA1(t *testing.T) {
@@ -31,3 +37,85 @@ func TestNewRotatorSettings(t *testing.T) {
 		t.Error("Failed to set WARC rotator's compression algorithm")
 	}
 }
+
+// Tests for the Collection rotator setting
+func TestCheckRotatorSettingsCollection(t *testing.T) {
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.Collection = "test-collection"
+
+	if err := checkRotatorSettings(rotatorSettings); err != nil {
+		t.Fatalf("failed to check rotator settings: %v", err)
+	}
+
+	if rotatorSettings.WarcinfoContent.Get("isPartOf") != "test-collection" {
+		t.Error("Failed to set warcinfo isPartOf field")
+	}
+}
+
+// Tests for the GenerateWarcFileName function
+func TestGenerateWarcFileName(t *testing.T) {
+	date := time.Date(2021, 5, 4, 23, 11, 12, 45678900, time.UTC)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.Hostname = "crawler-1"
+
+	for _, test := range []struct {
+		timeZone   *time.Location
+		resolution time.Duration
+		expected   string
+	}{
+		{nil, 0, "WARC-20210504231112045-00042-crawler-1.warc.gz"},
+		{nil, time.Second, "WARC-20210504231112-00042-crawler-1.warc.gz"},
+		{nil, time.Microsecond, "WARC-20210504231112045678-00042-crawler-1.warc.gz"},
+		{time.FixedZone("UTC+2", 2*60*60), time.Second, "WARC-20210505011112-00042-crawler-1.warc.gz"},
+	} {
+		rotatorSettings.TimeZone = test.timeZone
+		rotatorSettings.TimestampResolution = test.resolution
+
+		fileName, err := GenerateWarcFileName(rotatorSettings, 42, date)
+		if err != nil {
+			t.Fatalf("failed to generate file name: %v", err)
+		}
+
+		if fileName != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, fileName)
+		}
+	}
+
+	if err := checkRotatorSettings(rotatorSettings); err != nil {
+		t.Fatalf("failed to check rotator settings: %v", err)
+	}
+
+	if rotatorSettings.WarcinfoContent.Get("hostname") != "crawler-1" {
+		t.Errorf("expected hostname crawler-1 in warcinfo, got %s", rotatorSettings.WarcinfoContent.Get("hostname"))
+	}
+}
+
+// Tests for the copyFile function
+func TestCopyFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-copy-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	src := filepath.Join(directory, "src")
+	dst := filepath.Join(directory, "dst")
+
+	if err := ioutil.WriteFile(src, []byte("Hello, World!"), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		t.Fatalf("failed to copy file: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read destination file: %v", err)
+	}
+
+	if string(data) != "Hello, World!" {
+		t.Errorf("unexpected destination content: %q", data)
+	}
+}
@@ -0,0 +1,233 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned by Record.Validate, it lists
+// all the problems found in the record
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid record: " + strings.Join(e.Problems, "; ")
+}
+
+// requiredFields are the fields required by each WARC-Type,
+// in addition to WARC-Record-ID, WARC-Date and WARC-Type
+var requiredFields = map[string][]string{
+	"warcinfo":     {},
+	"response":     {"WARC-Target-URI"},
+	"resource":     {"WARC-Target-URI"},
+	"request":      {"WARC-Target-URI"},
+	"metadata":     {},
+	"revisit":      {"WARC-Target-URI", "WARC-Profile"},
+	"conversion":   {"WARC-Target-URI"},
+	"continuation": {"WARC-Target-URI", "WARC-Segment-Origin-ID", "WARC-Segment-Number"},
+}
+
+// readOnlyDigestAlgorithms are the digest algorithm labels found in WARC
+// files written by other tools, known even though they aren't registered,
+// see RegisterDigestAlgorithm
+var readOnlyDigestAlgorithms = map[string]bool{
+	"md5":    true,
+	"sha512": true,
+}
+
+// knownDigestAlgorithm returns whether a digest algorithm label
+// is registered or found in WARC files written by other tools
+func knownDigestAlgorithm(label string) bool {
+	name := normalizeDigestAlgorithm(label)
+	if name == "" {
+		return false
+	}
+	if readOnlyDigestAlgorithms[name] {
+		return true
+	}
+
+	_, err := lookupDigestAlgorithm(name)
+	return err == nil
+}
+
+// Validate checks that the record has the fields required by its
+// WARC-Type, that WARC-Date parses, that WARC-Target-URI is absolute and
+// that the digests use a known algorithm, so that malformed records are
+// caught before being written. The returned error is a *ValidationError.
+func (r *Record) Validate() error {
+	var problems []string
+
+	for _, key := range []string{"WARC-Record-ID", "WARC-Date", "WARC-Type"} {
+		if r.Header.Get(key) == "" {
+			problems = append(problems, "missing "+key)
+		}
+	}
+
+	warcType := r.Header.Get("WARC-Type")
+	if warcType != "" {
+		fields, ok := requiredFields[warcType]
+		if !ok {
+			problems = append(problems, "unknown WARC-Type "+warcType)
+		}
+
+		for _, key := range fields {
+			if r.Header.Get(key) == "" {
+				problems = append(problems, "missing "+key+" for a "+warcType+" record")
+			}
+		}
+	}
+
+	// Only some types of records can refer to other records
+	refersTo := r.RefersTo()
+	if refersTo.RecordID != "" && warcType != "" && !refersToTypes[warcType] {
+		problems = append(problems, "WARC-Refers-To in a "+warcType+" record")
+	}
+	if (refersTo.TargetURI != "" || refersTo.Date != "" || r.RevisitProfile() != "") && warcType != "" && warcType != "revisit" {
+		problems = append(problems, "revisit fields in a "+warcType+" record")
+	}
+	if refersTo.Date != "" {
+		if _, err := ParseDate(refersTo.Date); err != nil {
+			problems = append(problems, "malformed WARC-Refers-To-Date "+refersTo.Date)
+		}
+	}
+
+	if date := r.Header.Get("WARC-Date"); date != "" {
+		if _, err := ParseDate(date); err != nil {
+			problems = append(problems, "malformed WARC-Date "+date)
+		}
+	}
+
+	if target := r.Header.Get("WARC-Target-URI"); target != "" {
+		target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+		if parsed, err := url.Parse(target); err != nil || !parsed.IsAbs() {
+			problems = append(problems, "WARC-Target-URI isn't absolute: "+target)
+		}
+	}
+
+	if length := r.Header.Get("Content-Length"); length != "" {
+		if size, err := strconv.ParseInt(length, 10, 64); err != nil || size < 0 {
+			problems = append(problems, "malformed Content-Length "+length)
+		}
+	}
+
+	for _, key := range []string{"WARC-Block-Digest", "WARC-Payload-Digest"} {
+		digest := r.Header.Get(key)
+		if digest == "" {
+			continue
+		}
+
+		parts := strings.SplitN(digest, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			problems = append(problems, "malformed "+key+" "+digest)
+		} else if !knownDigestAlgorithm(parts[0]) {
+			problems = append(problems, "unknown "+key+" algorithm "+parts[0])
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// RecordValidation lists the problems of a record of a WARC file
+type RecordValidation struct {
+	// Offset of the record in the file
+	Offset   int64
+	RecordID string
+	Problems []string
+}
+
+// ValidateFile reads all the records of the WARC file at path, e.g. before
+// uploading it to an archive, and returns the ones violating the WARC
+// specification: besides the problems found by Record.Validate, it checks
+// that the records have a Content-Length matching the size of their block,
+// and that their WARC-Block-Digest and WARC-Payload-Digest are correct, if
+// computed with a registered algorithm, see RegisterDigestAlgorithm. The
+// error is only set if the file can't be read.
+func ValidateFile(path string) ([]RecordValidation, error) {
+	return validateFile(openOSFile, path)
+}
+
+func validateFile(open openFileFunc, path string) ([]RecordValidation, error) {
+	file, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var invalid []RecordValidation
+	for {
+		record, err := reader.ReadRecord(true)
+		if err == io.EOF {
+			return invalid, nil
+		}
+		if err != nil {
+			return invalid, err
+		}
+
+		problems := append(record.Problems, validateBlock(record)...)
+		os.Remove(record.PayloadPath)
+
+		if len(problems) > 0 {
+			invalid = append(invalid, RecordValidation{
+				Offset:   reader.RecordOffset(),
+				RecordID: record.Header.Get("WARC-Record-ID"),
+				Problems: problems,
+			})
+		}
+	}
+}
+
+// validateBlock checks the Content-Length and the digests
+// of a record read on disk against its block
+func validateBlock(record *Record) []string {
+	var problems []string
+
+	length := record.Header.Get("Content-Length")
+	if length == "" {
+		problems = append(problems, "missing Content-Length")
+	} else if stat, err := os.Stat(record.PayloadPath); err == nil {
+		if size, err := strconv.ParseInt(length, 10, 64); err == nil && size != stat.Size() {
+			problems = append(problems, "Content-Length "+length+" doesn't match the block size "+strconv.FormatInt(stat.Size(), 10))
+		}
+	}
+
+	if digest := record.Header.Get("WARC-Block-Digest"); digest != "" {
+		if match, err := verifyBlockDigest(record); err == nil && !match {
+			problems = append(problems, "WARC-Block-Digest "+digest+" doesn't match the block")
+		}
+	}
+
+	// The payload digest of a revisit record is the one of the original
+	warcType := record.Header.Get("WARC-Type")
+	if digest := record.Header.Get("WARC-Payload-Digest"); digest != "" && (warcType == "response" || warcType == "resource") {
+		algorithm, expected, err := parseDigest(digest)
+		if err != nil {
+			return problems
+		}
+
+		digests, err := record.payloadDigests(algorithm)
+		if err != nil {
+			return problems
+		}
+
+		if _, actual, err := parseDigest(digests.Payload); err == nil && !bytes.Equal(actual, expected) {
+			problems = append(problems, "WARC-Payload-Digest "+digest+" doesn't match the payload")
+		}
+	}
+
+	return problems
+}
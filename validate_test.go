@@ -0,0 +1,188 @@
+package warc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for the Record.Validate method
+func TestRecordValidate(t *testing.T) {
+	record := NewRecord()
+	record.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000000>")
+	record.Header.Set("WARC-Date", "2021-05-04T10:11:12Z")
+	record.Header.Set("WARC-Type", "response")
+	record.Header.Set("WARC-Target-URI", "https://example.com/")
+	record.Header.Set("WARC-Block-Digest", "sha1:FKXGYNOJJ7H3IFO35FPUBC445EPOQRXN")
+
+	if err := record.Validate(); err != nil {
+		t.Fatalf("expected a valid record, got %v", err)
+	}
+
+	record.Header.Set("WARC-Date", "yesterday")
+	record.Header.Set("WARC-Target-URI", "/relative")
+	record.Header.Set("WARC-Block-Digest", "crc32:1234")
+
+	err := record.Validate()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("expected 3 problems, got %q", validationErr.Problems)
+	}
+
+	revisit := NewRecord()
+	revisit.Header.Set("WARC-Record-ID", "<urn:uuid:7f3a2c1e-0000-4000-8000-000000000001>")
+	revisit.Header.Set("WARC-Date", "2021-05-04T10:11:12Z")
+	revisit.Header.Set("WARC-Type", "revisit")
+	revisit.Header.Set("WARC-Target-URI", "https://example.com/")
+
+	if err := revisit.Validate(); err == nil || !strings.Contains(err.Error(), "WARC-Profile") {
+		t.Errorf("expected missing WARC-Profile, got %v", err)
+	}
+}
+
+// Tests that WriteRecord rejects invalid records when Writer.StrictSpec
+// is set, and lists their problems otherwise
+func TestWriteRecordValidate(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	writer, err := NewWriter(buffer, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+	writer.StrictSpec = true
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\n")
+
+	if _, err := writer.WriteRecord(record); err == nil {
+		t.Fatal("expected an error for a response without WARC-Target-URI")
+	}
+
+	if buffer.Len() != 0 {
+		t.Errorf("expected nothing written, got %q", buffer.String())
+	}
+
+	writer.StrictSpec = false
+	if _, err := writer.WriteRecord(record); err != nil {
+		t.Fatalf("expected the record to be written, got %v", err)
+	}
+
+	if len(record.Problems) != 1 || !strings.Contains(record.Problems[0], "WARC-Target-URI") {
+		t.Errorf("expected a missing WARC-Target-URI problem, got %q", record.Problems)
+	}
+
+	writer.StrictSpec = true
+	record.Header.Set("WARC-Target-URI", "https://example.com/")
+	if _, err := writer.WriteRecord(record); err != nil {
+		t.Errorf("expected a valid record, got %v", err)
+	}
+
+	if record.Problems != nil {
+		t.Errorf("expected no problems, got %q", record.Problems)
+	}
+}
+
+// Tests for the ReaderOptions.StrictSpec option
+func TestReaderStrictSpec(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer, err := NewWriter(buffer, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+
+	for _, target := range []string{"/relative", "https://example.com/"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "resource")
+		record.Header.Set("WARC-Target-URI", target)
+		record.Content = strings.NewReader("Hello, World!")
+
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+
+	for _, strict := range []bool{false, true} {
+		reader, err := NewReaderWithOptions(bytes.NewReader(buffer.Bytes()), ReaderOptions{Compression: CompressionNone, StrictSpec: strict})
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+
+		record, err := reader.ReadRecord(false)
+		if strict {
+			if _, ok := err.(*ValidationError); !ok {
+				t.Errorf("expected a *ValidationError in strict mode, got %v", err)
+			}
+		} else if err != nil || len(record.Problems) != 1 {
+			t.Errorf("expected the record with 1 problem in lenient mode, got %v", err)
+		}
+
+		record, err = reader.ReadRecord(false)
+		if err != nil || record.Header.Get("WARC-Target-URI") != "https://example.com/" || record.Problems != nil {
+			t.Errorf("expected the valid record to be read, got %v", err)
+		}
+		reader.Close()
+	}
+}
+
+// Tests for the ValidateFile function
+func TestValidateFile(t *testing.T) {
+	invalid, err := ValidateFile("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to validate WARC file: %v", err)
+	}
+	if len(invalid) != 0 {
+		t.Errorf("expected a valid file, got %+v", invalid)
+	}
+
+	directory, err := ioutil.TempDir("", "warc-validate-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	// A file whose second record was altered after being written
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	for _, body := range []string{"Hello, World!", "Goodbye, World"} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Header.Set("WARC-Payload-Digest", "sha1:"+GetSHA1([]byte("Hello, World!")))
+		record.Content = strings.NewReader("HTTP/1.1 200 OK\r\n\r\n" + body)
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+
+	path := filepath.Join(directory, "test.warc")
+	data := bytes.Replace(output.Bytes(), []byte("Goodbye, World"), []byte("Goodbye, Earth"), 1)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write WARC file: %v", err)
+	}
+
+	invalid, err = ValidateFile(path)
+	if err != nil {
+		t.Fatalf("failed to validate WARC file: %v", err)
+	}
+
+	if len(invalid) != 1 || invalid[0].Offset == 0 || invalid[0].RecordID == "" {
+		t.Fatalf("expected the second record to be invalid, got %+v", invalid)
+	}
+
+	problems := strings.Join(invalid[0].Problems, "\n")
+	if !strings.Contains(problems, "WARC-Block-Digest") || !strings.Contains(problems, "WARC-Payload-Digest") {
+		t.Errorf("expected digest problems, got %q", problems)
+	}
+}
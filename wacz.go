@@ -0,0 +1,546 @@
+package warc
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// waczVersion is the version of the WACZ specification followed
+const waczVersion = "1.1.1"
+
+// Signatures of the zip records written to WACZ packages
+const (
+	zipLocalHeaderSignature     = 0x04034b50
+	zipDataDescriptorSignature  = 0x08074b50
+	zipDirectoryHeaderSignature = 0x02014b50
+	zipDirectoryEndSignature    = 0x06054b50
+	zipDirectory64EndSignature  = 0x06064b50
+	zipDirectory64LocSignature  = 0x07064b50
+)
+
+// WACZWriter writes records straight into a WACZ package, the zip format
+// replayed by ReplayWeb.page: each record is compressed in its own gzip
+// member of a WARC file stored uncompressed in the package, and indexed
+// as it is written, so that no packaging step is needed afterwards.
+//
+// The records are written to a WARC file of the package until Flush is
+// called, which adds the index of the file to the package and makes the
+// package readable as it is, the next records being written to a new
+// WARC file. If the writer isn't closed, e.g. after a crash, the package
+// can be read up to its last Flush once repaired with RepairWACZ.
+type WACZWriter struct {
+	// Title of the package, written in its datapackage.json
+	Title string
+	// Collection the records are part of, written in the collection
+	// field of their CDXJ lines, see RotatorSettings.Collection
+	Collection string
+
+	output    *countingWriter
+	files     []zipFile
+	resources []waczResource
+	part      *waczPart
+	parts     int
+	pages     []waczPage
+	created   time.Time
+	closed    bool
+}
+
+// waczPart is the WARC file of the package the records are written
+// to, with the index entries of its records
+type waczPart struct {
+	file    zipFile
+	data    *countingWriter
+	crc32   hash.Hash32
+	sha256  hash.Hash
+	writer  *Writer
+	entries []CatalogEntry
+}
+
+// zipFile is a file stored uncompressed in a zip package
+type zipFile struct {
+	name   string
+	offset int64
+	crc32  uint32
+	size   int64
+	// descriptor is true if the CRC-32 and the size
+	// follow the data rather than its local header
+	descriptor bool
+}
+
+// waczPage is a line of the pages/pages.jsonl file
+type waczPage struct {
+	URL   string `json:"url"`
+	TS    string `json:"ts"`
+	Title string `json:"title,omitempty"`
+}
+
+// waczResource is a file of the package, as listed in datapackage.json
+type waczResource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int64  `json:"bytes"`
+}
+
+// NewWACZWriter creates a WACZ package writing to writer
+func NewWACZWriter(writer io.Writer) (*WACZWriter, error) {
+	return &WACZWriter{
+		output:  &countingWriter{writer: writer},
+		created: time.Now().UTC(),
+	}, nil
+}
+
+// WriteRecord writes a record in its own gzip member and indexes it,
+// the successful HTML responses being listed as pages of the package
+func (w *WACZWriter) WriteRecord(record *Record) (recordID string, err error) {
+	if w.closed {
+		return "", errors.New("WACZ writer already closed")
+	}
+
+	if w.part == nil {
+		if err := w.beginPart(); err != nil {
+			return "", err
+		}
+	}
+
+	entry := newCatalogEntry(record)
+	entry.Offset = w.part.data.count
+	entry.File = path.Base(w.part.file.name)
+	entry.Collection = w.Collection
+
+	recordID, err = w.part.writer.WriteRecord(record, FlushMember())
+	if err != nil {
+		return recordID, err
+	}
+
+	entry.complete(record)
+	entry.Length = w.part.data.count - entry.Offset
+
+	switch record.Header.Get("WARC-Type") {
+	case "response", "resource", "revisit":
+		w.part.entries = append(w.part.entries, entry)
+	}
+
+	if record.Header.Get("WARC-Type") == "response" && entry.Status == 200 && entry.MediaType == "text/html" {
+		if date, err := ParseDate(entry.Date); err == nil {
+			w.pages = append(w.pages, waczPage{URL: entry.URL, TS: date.UTC().Format(time.RFC3339)})
+		}
+	}
+
+	return recordID, nil
+}
+
+// Flush ends the WARC file the records are written to and adds its index
+// to the package, then writes the pages, the datapackage.json and the
+// central directory of the package as it is, so that it can be read up to
+// there even if the writer is never closed, see RepairWACZ.
+func (w *WACZWriter) Flush() error {
+	if w.closed {
+		return errors.New("WACZ writer already closed")
+	}
+
+	if err := w.endPart(); err != nil {
+		return err
+	}
+
+	return w.writeDirectory()
+}
+
+// Close flushes the package, which must not be written to afterwards,
+// the underlying writer isn't closed
+func (w *WACZWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	w.closed = true
+	return nil
+}
+
+// beginPart starts a new WARC file in the package
+func (w *WACZWriter) beginPart() error {
+	w.parts++
+
+	part := &waczPart{
+		file: zipFile{
+			name:       "archive/data-" + strconv.Itoa(w.parts) + ".warc.gz",
+			offset:     w.output.count,
+			descriptor: true,
+		},
+		crc32:  crc32.NewIEEE(),
+		sha256: sha256.New(),
+	}
+
+	if err := w.writeLocalHeader(part.file); err != nil {
+		return err
+	}
+
+	// The offsets of the records are counted from the start of the file
+	part.data = &countingWriter{writer: io.MultiWriter(w.output, part.crc32, part.sha256)}
+
+	members, err := NewMemberWriter(part.data, CompressionGZIP)
+	if err != nil {
+		return err
+	}
+
+	part.writer, err = NewWriter(members, path.Base(part.file.name), "")
+	if err != nil {
+		return err
+	}
+
+	w.part = part
+	return nil
+}
+
+// endPart ends the WARC file the records are written to, if
+// any, and adds the index of its records to the package
+func (w *WACZWriter) endPart() error {
+	part := w.part
+	if part == nil {
+		return nil
+	}
+	w.part = nil
+
+	part.file.crc32 = part.crc32.Sum32()
+	part.file.size = part.data.count
+
+	// The data descriptor has 64 bits sizes once they exceed 32 bits
+	descriptor := new(zipBuffer)
+	descriptor.uint32(zipDataDescriptorSignature)
+	descriptor.uint32(part.file.crc32)
+	if part.file.size >= math.MaxUint32 {
+		descriptor.uint64(uint64(part.file.size))
+		descriptor.uint64(uint64(part.file.size))
+	} else {
+		descriptor.uint32(uint32(part.file.size))
+		descriptor.uint32(uint32(part.file.size))
+	}
+	if _, err := w.output.Write(descriptor.Bytes()); err != nil {
+		return err
+	}
+
+	w.files = append(w.files, part.file)
+	w.resources = append(w.resources, waczResource{
+		Name:  path.Base(part.file.name),
+		Path:  part.file.name,
+		Hash:  "sha256:" + hex.EncodeToString(part.sha256.Sum(nil)),
+		Bytes: part.file.size,
+	})
+
+	// The index is sorted by SURT key and timestamp
+	var index []string
+	for _, entry := range part.entries {
+		line, err := entry.CDXJ()
+		if err != nil {
+			continue
+		}
+		index = append(index, line+"\n")
+	}
+	sort.Strings(index)
+
+	indexPath := "indexes/index-" + strconv.Itoa(w.parts) + ".cdxj"
+	file, resource, err := w.writeFile(indexPath, []byte(strings.Join(index, "")))
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, file)
+	w.resources = append(w.resources, resource)
+
+	return nil
+}
+
+// writeDirectory writes the pages, the datapackage.json and the central
+// directory of the package, which are written again by the next Flush
+func (w *WACZWriter) writeDirectory() error {
+	pages := new(bytes.Buffer)
+	header, _ := json.Marshal(map[string]string{"format": "json-pages-1.0", "id": "pages", "title": "All Pages"})
+	pages.WriteString(string(header) + "\n")
+	for _, page := range w.pages {
+		line, err := json.Marshal(page)
+		if err != nil {
+			return err
+		}
+		pages.WriteString(string(line) + "\n")
+	}
+
+	pagesFile, pagesResource, err := w.writeFile("pages/pages.jsonl", pages.Bytes())
+	if err != nil {
+		return err
+	}
+
+	datapackage, err := json.MarshalIndent(map[string]interface{}{
+		"profile":      "data-package",
+		"wacz_version": waczVersion,
+		"title":        w.Title,
+		"created":      w.created.Format(time.RFC3339),
+		"modified":     time.Now().UTC().Format(time.RFC3339),
+		"software":     "github.com/fairuse/warc",
+		"mainPageURL":  w.mainPageURL(),
+		"resources":    append(append([]waczResource(nil), w.resources...), pagesResource),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	datapackageFile, _, err := w.writeFile("datapackage.json", datapackage)
+	if err != nil {
+		return err
+	}
+
+	files := append(append([]zipFile(nil), w.files...), pagesFile, datapackageFile)
+
+	directory := new(zipBuffer)
+	directoryOffset := w.output.count
+	for _, file := range files {
+		directory.directoryHeader(file, w.created)
+	}
+	directory.directoryEnd(len(files), directoryOffset, int64(directory.Len()))
+
+	_, err = w.output.Write(directory.Bytes())
+	return err
+}
+
+// mainPageURL returns the URL of the first page, if any
+func (w *WACZWriter) mainPageURL() string {
+	if len(w.pages) == 0 {
+		return ""
+	}
+	return w.pages[0].URL
+}
+
+// writeFile adds a file to the package, returning
+// its resource as listed in datapackage.json
+func (w *WACZWriter) writeFile(name string, data []byte) (zipFile, waczResource, error) {
+	file := zipFile{
+		name:   name,
+		offset: w.output.count,
+		crc32:  crc32.ChecksumIEEE(data),
+		size:   int64(len(data)),
+	}
+
+	if err := w.writeLocalHeader(file); err != nil {
+		return file, waczResource{}, err
+	}
+
+	if _, err := w.output.Write(data); err != nil {
+		return file, waczResource{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return file, waczResource{
+		Name:  path.Base(name),
+		Path:  name,
+		Hash:  "sha256:" + hex.EncodeToString(sum[:]),
+		Bytes: file.size,
+	}, nil
+}
+
+// writeLocalHeader writes the header preceding the data of a file
+func (w *WACZWriter) writeLocalHeader(file zipFile) error {
+	modTime, modDate := msDosTimeDate(w.created)
+
+	header := new(zipBuffer)
+	header.uint32(zipLocalHeaderSignature)
+	header.uint16(20)
+	if file.descriptor {
+		header.uint16(0x8)
+		header.uint16(zip.Store)
+		header.uint16(modTime)
+		header.uint16(modDate)
+		header.uint32(0)
+		header.uint32(0)
+		header.uint32(0)
+	} else {
+		header.uint16(0)
+		header.uint16(zip.Store)
+		header.uint16(modTime)
+		header.uint16(modDate)
+		header.uint32(file.crc32)
+		header.uint32(uint32(file.size))
+		header.uint32(uint32(file.size))
+	}
+	header.uint16(uint16(len(file.name)))
+	header.uint16(0)
+	header.WriteString(file.name)
+
+	_, err := w.output.Write(header.Bytes())
+	return err
+}
+
+// RepairWACZ truncates a WACZ package whose writer wasn't closed, e.g.
+// after a crash, after the central directory written by its last Flush,
+// so that it can be read up to there
+func RepairWACZ(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	// The ends of central directory are looked for from the end of the
+	// package, until one of them ends a readable package
+	signature := []byte{0x50, 0x4b, 0x05, 0x06}
+	const window = 64 * 1024
+	buffer := make([]byte, window+len(signature)-1)
+
+	for end := size; end > 0; {
+		start := end - window
+		if start < 0 {
+			start = 0
+		}
+
+		length := end - start + int64(len(signature)) - 1
+		if start+length > size {
+			length = size - start
+		}
+
+		block := buffer[:length]
+		if _, err := file.ReadAt(block, start); err != nil && err != io.EOF {
+			return err
+		}
+
+		for i := bytes.LastIndex(block, signature); i >= 0; i = bytes.LastIndex(block[:i], signature) {
+			// The comment of the end of central directory is empty
+			candidate := start + int64(i) + 22
+			if candidate > size {
+				continue
+			}
+
+			if _, err := zip.NewReader(io.NewSectionReader(file, 0, candidate), candidate); err == nil {
+				return file.Truncate(candidate)
+			}
+		}
+
+		end = start
+	}
+
+	return errors.New("No central directory found in WACZ package: " + path)
+}
+
+// zipBuffer builds the little-endian records of zip packages
+type zipBuffer struct {
+	bytes.Buffer
+}
+
+func (b *zipBuffer) uint16(v uint16) {
+	binary.Write(b, binary.LittleEndian, v)
+}
+
+func (b *zipBuffer) uint32(v uint32) {
+	binary.Write(b, binary.LittleEndian, v)
+}
+
+func (b *zipBuffer) uint64(v uint64) {
+	binary.Write(b, binary.LittleEndian, v)
+}
+
+// directoryHeader adds the central directory header of a file, with
+// its sizes and offset in a zip64 extra field if they exceed 32 bits
+func (b *zipBuffer) directoryHeader(file zipFile, modified time.Time) {
+	modTime, modDate := msDosTimeDate(modified)
+	zip64 := file.size >= math.MaxUint32 || file.offset >= math.MaxUint32
+
+	version := uint16(20)
+	size, offset := uint32(file.size), uint32(file.offset)
+	extraLength := uint16(0)
+	if zip64 {
+		version = 45
+		size, offset = math.MaxUint32, math.MaxUint32
+		extraLength = 28
+	}
+
+	flags := uint16(0)
+	if file.descriptor {
+		flags = 0x8
+	}
+
+	b.uint32(zipDirectoryHeaderSignature)
+	b.uint16(version)
+	b.uint16(version)
+	b.uint16(flags)
+	b.uint16(zip.Store)
+	b.uint16(modTime)
+	b.uint16(modDate)
+	b.uint32(file.crc32)
+	b.uint32(size)
+	b.uint32(size)
+	b.uint16(uint16(len(file.name)))
+	b.uint16(extraLength)
+	b.uint16(0)
+	b.uint16(0)
+	b.uint16(0)
+	b.uint32(0)
+	b.uint32(offset)
+	b.WriteString(file.name)
+
+	if zip64 {
+		b.uint16(0x1)
+		b.uint16(24)
+		b.uint64(uint64(file.size))
+		b.uint64(uint64(file.size))
+		b.uint64(uint64(file.offset))
+	}
+}
+
+// directoryEnd adds the end of central directory, preceded by its zip64
+// record and locator if the directory exceeds the limits of 32 bits zip
+func (b *zipBuffer) directoryEnd(count int, offset int64, size int64) {
+	if count >= math.MaxUint16 || offset >= math.MaxUint32 || size >= math.MaxUint32 {
+		end64Offset := offset + size
+
+		b.uint32(zipDirectory64EndSignature)
+		b.uint64(44)
+		b.uint16(45)
+		b.uint16(45)
+		b.uint32(0)
+		b.uint32(0)
+		b.uint64(uint64(count))
+		b.uint64(uint64(count))
+		b.uint64(uint64(size))
+		b.uint64(uint64(offset))
+
+		b.uint32(zipDirectory64LocSignature)
+		b.uint32(0)
+		b.uint64(uint64(end64Offset))
+		b.uint32(1)
+
+		count, offset, size = math.MaxUint16, math.MaxUint32, math.MaxUint32
+	}
+
+	b.uint32(zipDirectoryEndSignature)
+	b.uint16(0)
+	b.uint16(0)
+	b.uint16(uint16(count))
+	b.uint16(uint16(count))
+	b.uint32(uint32(size))
+	b.uint32(uint32(offset))
+	b.uint16(0)
+}
+
+// msDosTimeDate returns the MS-DOS time and date of t, as written in zip packages
+func msDosTimeDate(t time.Time) (uint16, uint16) {
+	modTime := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	modDate := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	return modTime, modDate
+}
@@ -0,0 +1,215 @@
+package warc
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Tests for the WACZWriter type
+func TestWACZWriter(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	writer, err := NewWACZWriter(output)
+	if err != nil {
+		t.Fatalf("failed to create WACZ writer: %v", err)
+	}
+	writer.Title = "Test"
+	writer.Collection = "tests"
+
+	request := NewRecord()
+	request.Header.Set("WARC-Type", "request")
+	request.Header.Set("WARC-Target-URI", "https://example.com/")
+	request.Content = strings.NewReader("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+	response := NewRecord()
+	response.Header.Set("WARC-Type", "response")
+	response.Header.Set("WARC-Target-URI", "https://example.com/")
+	response.Header.Set("Content-Type", "application/http; msgtype=response")
+	response.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 13\r\n\r\n<p>Hello!</p>")
+
+	for _, record := range []*Record{request, response} {
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close WACZ writer: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("failed to read WACZ package: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		files[file.Name], err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+	}
+
+	for _, name := range []string{"archive/data-1.warc.gz", "indexes/index-1.cdxj", "pages/pages.jsonl", "datapackage.json"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected %s in the package", name)
+		}
+	}
+
+	// The response is the only indexed record, and
+	// can be read from the offset in the index
+	index := strings.Split(strings.TrimSpace(string(files["indexes/index-1.cdxj"])), "\n")
+	if len(index) != 1 || !strings.HasPrefix(index[0], "com,example)/ ") {
+		t.Fatalf("unexpected index %q", index)
+	}
+
+	var fields cdxjFields
+	if err := json.Unmarshal([]byte(index[0][strings.Index(index[0], "{"):]), &fields); err != nil {
+		t.Fatalf("failed to parse index line: %v", err)
+	}
+	if fields.Status != "200" || fields.MIME != "text/html" || fields.Collection != "tests" {
+		t.Errorf("unexpected index fields %+v", fields)
+	}
+
+	var offset, length int
+	json.Unmarshal([]byte(fields.Offset), &offset)
+	json.Unmarshal([]byte(fields.Length), &length)
+	data := files["archive/data-1.warc.gz"]
+
+	member, err := gzip.NewReader(bytes.NewReader(data[offset : offset+length]))
+	if err != nil {
+		t.Fatalf("failed to read record member: %v", err)
+	}
+	member.Multistream(false)
+	record, err := ioutil.ReadAll(member)
+	if err != nil {
+		t.Fatalf("failed to read record member: %v", err)
+	}
+	if !bytes.Contains(record, []byte("Warc-Type: response")) {
+		t.Errorf("expected the response record at offset %d, got %q", offset, record)
+	}
+
+	pages := strings.Split(strings.TrimSpace(string(files["pages/pages.jsonl"])), "\n")
+	if len(pages) != 2 || !strings.Contains(pages[1], `"url":"https://example.com/"`) {
+		t.Errorf("unexpected pages %q", pages)
+	}
+
+	var datapackage struct {
+		Resources []waczResource `json:"resources"`
+	}
+	if err := json.Unmarshal(files["datapackage.json"], &datapackage); err != nil {
+		t.Fatalf("failed to parse datapackage.json: %v", err)
+	}
+
+	for _, resource := range datapackage.Resources {
+		sum := sha256.Sum256(files[resource.Path])
+		if resource.Hash != "sha256:"+hex.EncodeToString(sum[:]) || resource.Bytes != int64(len(files[resource.Path])) {
+			t.Errorf("unexpected hash or size of %s: %+v", resource.Path, resource)
+		}
+	}
+	if len(datapackage.Resources) != 3 {
+		t.Errorf("expected 3 resources, got %d", len(datapackage.Resources))
+	}
+}
+
+// Tests that a WACZ package can be read up to its last
+// Flush once repaired, if its writer isn't closed
+func TestWACZWriterFlush(t *testing.T) {
+	directory, err := ioutil.TempDir("", "warc-wacz-*")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "test.wacz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create WACZ package: %v", err)
+	}
+	defer file.Close()
+
+	writer, err := NewWACZWriter(file)
+	if err != nil {
+		t.Fatalf("failed to create WACZ writer: %v", err)
+	}
+
+	for _, url := range []string{"https://example.com/", "https://example.org/", "https://example.net/"} {
+		response := NewRecord()
+		response.Header.Set("WARC-Type", "response")
+		response.Header.Set("WARC-Target-URI", url)
+		response.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + url)
+
+		if _, err := writer.WriteRecord(response); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+
+		// The last record is written after the last Flush, as if the
+		// process crashed before closing the writer
+		if url != "https://example.net/" {
+			if err := writer.Flush(); err != nil {
+				t.Fatalf("failed to flush WACZ writer: %v", err)
+			}
+		}
+	}
+
+	if err := RepairWACZ(path); err != nil {
+		t.Fatalf("failed to repair WACZ package: %v", err)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("failed to read repaired WACZ package: %v", err)
+	}
+	defer archive.Close()
+
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		files[file.Name], err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+	}
+
+	if len(files) != 6 {
+		t.Errorf("expected 2 WARC files, their indexes, the pages and the datapackage.json, got %d files", len(files))
+	}
+
+	// Each index is written once its WARC file is flushed
+	for i, url := range []string{"https://example.com/", "https://example.org/"} {
+		index := string(files["indexes/index-"+strconv.Itoa(i+1)+".cdxj"])
+		if strings.Count(index, "\n") != 1 || !strings.Contains(index, `"url":"`+url+`"`) {
+			t.Errorf("expected %s in index %d, got %q", url, i+1, index)
+		}
+	}
+
+	var datapackage map[string]interface{}
+	if err := json.Unmarshal(files["datapackage.json"], &datapackage); err != nil {
+		t.Fatalf("failed to parse datapackage.json: %v", err)
+	}
+	if resources, ok := datapackage["resources"].([]interface{}); !ok || len(resources) != 5 {
+		t.Errorf("expected 5 resources, got %v", datapackage["resources"])
+	}
+	if _, ok := datapackage["countOfPages"]; ok {
+		t.Error("unexpected field of datapackage.json not in the WACZ specification")
+	}
+}
@@ -5,8 +5,16 @@ This module is based on nlevitt's WARC module (https://github.com/nlevitt/warc).
 package warc
 
 import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // RotatorSettings is used to store the settings
@@ -19,6 +27,26 @@ type RotatorSettings struct {
 	// recommend to name files this way:
 	// Prefix-Timestamp-Serial-Crawlhost.warc.gz
 	Prefix string
+	// Hostname is the host name written in the WARC file names and in
+	// the warcinfo records, the one reported by the kernel by default,
+	// which is meaningless in containers
+	Hostname string
+	// TimeZone of the timestamps of the WARC file names, UTC by default
+	TimeZone *time.Location
+	// TimestampResolution of the timestamps of the WARC file names,
+	// from time.Second to time.Nanosecond, time.Millisecond by default
+	TimestampResolution time.Duration
+	// Collection the WARC files are part of, it is written in the
+	// isPartOf field of the warcinfo record of every file, and in the
+	// collection field of the CDXJ lines of their records, see CDXJ
+	Collection string
+	// CrawlID identifies the crawl the WARC files are written for, it is
+	// written in the crawlID field of the warcinfo record of every file,
+	// so that archives mixing many crawls can be disaggregated
+	CrawlID string
+	// CrawlIDField makes the rotator set the CrawlIDField of every
+	// record to the crawl ID of its batch, or to CrawlID
+	CrawlIDField bool
 	// Compression algorithm to use
 	Compression string
 	// WarcSize is in MegaBytes
@@ -26,6 +54,207 @@ type RotatorSettings struct {
 	// Directory where the created WARC files will be stored,
 	// default will be the current directory
 	OutputDirectory string
+	// TempDirectory, if set, is where WARC files are written until they
+	// are finalized, e.g. a fast scratch disk. They are then moved to
+	// the output directory, even if it is on another file system.
+	TempDirectory string
+	// SpilloverDirectories are used in order once the output directory
+	// is full, i.e. when its free space is below MinFreeSpace or when
+	// the WARC files it contains reach DirectoryQuota. The switch to the
+	// next directory happens when the WARC file is rotated.
+	SpilloverDirectories []string
+	// MinFreeSpace is in MegaBytes, it is only checked on
+	// systems where the free space can be retrieved
+	MinFreeSpace float64
+	// DirectoryQuota is in MegaBytes
+	DirectoryQuota float64
+	// IdentifyPayloadType sets the WARC-Identified-Payload-Type field
+	// of response and resource records, see Record.IdentifyPayloadType
+	IdentifyPayloadType bool
+	// IdentificationPool, if set, gets a copy of each response and resource
+	// record as it is written, to identify its payload type with a more
+	// precise identifier than sniffing, e.g. a TikaIdentifier, without
+	// blocking the writes. Records are skipped when its queue is full.
+	IdentificationPool *IdentificationPool
+	// Simhash makes the rotator write a metadata record with the simhash
+	// of each textual payload after its record, so that near-duplicates
+	// can be found, see Record.PayloadSimhash
+	Simhash bool
+	// FinalizeHook, if set, is called with the path of each WARC file
+	// once it has been closed and renamed, e.g. to produce a detached
+	// signature of the file
+	FinalizeHook func(path string)
+	// FailAfter makes the rotator tolerate write failures: a batch that
+	// fails is dropped from the file, its Done channel receiving false, so
+	// that it can be sent again without duplicating records, and the next
+	// batch is written to a new file. After FailAfter consecutive failed
+	// batches, the rotator shuts down, see Err. Zero makes the rotator
+	// shut down on the first failure.
+	FailAfter int
+	// FailOnDiskFull makes the rotator shut down as soon as a write fails
+	// because the disk is full, instead of retrying up to FailAfter times
+	FailOnDiskFull bool
+	// CoalesceLatency is the maximum time a written batch waits for the
+	// batches queued after it to be written, before the file is flushed
+	// and its Done channel notified, so that bursts of batches are
+	// flushed at once. Zero flushes the file after each batch.
+	CoalesceLatency time.Duration
+	// CheckpointPath, if set, is where the state of the rotator is saved
+	// after each flush and when its channel is closed, the digests of a
+	// MemoryDedupStore being saved each time a WARC file is closed, see
+	// ResumeRotator
+	CheckpointPath string
+	// CrawlReport makes the rotator write a metadata record with the
+	// statistics of every host, see HostStats, at the end of the last
+	// WARC file when its channel is closed
+	CrawlReport bool
+	// ExtractionPool, if set, gets a copy of each response and resource
+	// record as it is written, e.g. to index fresh crawls with an
+	// ElasticsearchSink. Records are skipped when its queue is full.
+	ExtractionPool *ExtractionPool
+	// EnrichmentPolicy, if set, selects the response and resource records
+	// given to the ExtractionPool and to the EnrichmentHook, see
+	// SamplingPolicy. All of them are selected otherwise.
+	EnrichmentPolicy EnrichmentPolicy
+	// EnrichmentHook, if set, is called with each record selected for
+	// enrichment once it is written, e.g. to queue the URL for a
+	// screenshot whose record refers to its WARC-Record-ID. It is called
+	// by the rotator, so it must not block nor send records to it.
+	EnrichmentHook func(record *Record)
+	// Catalog, if set, stores every record written, the
+	// records of each batch in a single transaction
+	Catalog *Catalog
+	// Dedup, if set, makes the rotator write a revisit record with the
+	// identical-payload-digest profile instead of each response record
+	// whose payload digest is in the store, whatever its URL. The response
+	// records written are added to the store once their batch is flushed,
+	// the identical payloads of the batches flushed together, see
+	// CoalesceLatency, being all written in full.
+	Dedup DedupStore
+	// DigestAlgorithm is the algorithm of the WARC-Block-Digest and
+	// WARC-Payload-Digest of the records written, sha1 by default,
+	// see RegisterDigestAlgorithm
+	DigestAlgorithm string
+	// CDXJ makes the rotator write the CDXJ index of each WARC file next
+	// to it once the file is closed, named after the file with a .cdxj
+	// extension added, so that it can be replayed by pywb without an
+	// indexing pass. Records without a valid WARC-Target-URI aren't
+	// indexed.
+	CDXJ bool
+	// SkippableFrames makes the rotator precede each record of ZSTD
+	// compressed files by a skippable frame holding its size, see
+	// MemberWriter.SkippableFrames
+	SkippableFrames bool
+	// AnomalyDetector, if set, watches the records written, an
+	// AnomalyDetected event being emitted and AnomalyHook called
+	// for each anomaly it finds, see WindowDetector
+	AnomalyDetector AnomalyDetector
+	// AnomalyHook, if set, is called from the rotator's
+	// goroutine with each anomaly found
+	AnomalyHook func(Anomaly)
+
+	// rotator is the state of the last rotator started with the
+	// settings, or of the next one if none was started yet
+	rotatorMu sync.Mutex
+	rotator   *rotatorState
+}
+
+// rotatorState is the state of a rotator, created for each rotator started
+// with NewWARCRotator so that RotatorSettings can be reused. The methods of
+// RotatorSettings reporting on a rotator, e.g. Events or HostStats, report
+// on the last one started.
+type rotatorState struct {
+	settings *RotatorSettings
+	started  bool
+
+	events   rotatorEvents
+	health   rotatorHealth
+	stats    rotatorStats
+	failures rotatorFailures
+	warcinfo warcinfoUpdate
+
+	// firstSerial is the serial number of the first WARC file, set by
+	// ResumeRotator
+	firstSerial int
+}
+
+// currentRotator returns the state of the last rotator started
+// with the settings, or of the next one if none was started yet
+func (s *RotatorSettings) currentRotator() *rotatorState {
+	s.rotatorMu.Lock()
+	defer s.rotatorMu.Unlock()
+
+	if s.rotator == nil {
+		s.rotator = &rotatorState{settings: s}
+	}
+	return s.rotator
+}
+
+// nextRotator returns the state of the next rotator started with
+// the settings, a new one if the current one was started already
+func (s *RotatorSettings) nextRotator() *rotatorState {
+	s.rotatorMu.Lock()
+	defer s.rotatorMu.Unlock()
+
+	if s.rotator == nil || s.rotator.started {
+		s.rotator = &rotatorState{settings: s}
+	}
+	return s.rotator
+}
+
+// warcinfoUpdate is the content of the warcinfo records written by the
+// rotator, and the one set by SetWarcinfoContent waiting to be used
+type warcinfoUpdate struct {
+	mu      sync.Mutex
+	content Header
+	pending Header
+}
+
+// SetWarcinfoContent replaces the content of the warcinfo record while the
+// rotator is running, e.g. when the operator or the crawl configuration
+// changes. If the content changed, the current WARC file is rotated before
+// the next batch is written, so that the warcinfo record of each file
+// describes the records it contains. WarcinfoContent isn't modified.
+func (s *RotatorSettings) SetWarcinfoContent(content Header) {
+	rotator := s.currentRotator()
+
+	rotator.warcinfo.mu.Lock()
+	defer rotator.warcinfo.mu.Unlock()
+
+	rotator.warcinfo.pending = content.Clone()
+}
+
+// warcinfoContent returns the content of the warcinfo records written
+func (r *rotatorState) warcinfoContent() Header {
+	r.warcinfo.mu.Lock()
+	defer r.warcinfo.mu.Unlock()
+
+	return r.warcinfo.content
+}
+
+// takeWarcinfoContent makes the content set by SetWarcinfoContent, with
+// its default fields added, the content of the warcinfo records written,
+// returning true if it differs from the previous one
+func (r *rotatorState) takeWarcinfoContent() (bool, error) {
+	r.warcinfo.mu.Lock()
+	defer r.warcinfo.mu.Unlock()
+
+	content := r.warcinfo.pending
+	if content == nil {
+		return false, nil
+	}
+	r.warcinfo.pending = nil
+
+	if err := addWarcinfoFields(r.settings, content); err != nil {
+		return false, err
+	}
+
+	if reflect.DeepEqual(content, r.warcinfo.content) {
+		return false, nil
+	}
+
+	r.warcinfo.content = content
+	return true, nil
 }
 
 // NewWARCRotator creates and return a channel that can be used
@@ -41,157 +270,722 @@ func (s *RotatorSettings) NewWARCRotator() (recordWriterChannel chan *RecordBatc
 		return recordWriterChannel, done, err
 	}
 
+	// Each rotator has its own state, starting afresh
+	rotator := s.nextRotator()
+	s.rotatorMu.Lock()
+	rotator.started = true
+	s.rotatorMu.Unlock()
+
+	// The rotator writes its own copy of the content, see SetWarcinfoContent
+	rotator.warcinfo.mu.Lock()
+	rotator.warcinfo.content = s.WarcinfoContent.Clone()
+	rotator.warcinfo.mu.Unlock()
+
 	// Start the record writer in a goroutine
 	// TODO: support for pool of recordWriter?
-	go recordWriter(s, recordWriterChannel, done)
+	rotator.health.start()
+	go recordWriter(rotator, recordWriterChannel, done)
 
 	return recordWriterChannel, done, nil
 }
 
-func recordWriter(settings *RotatorSettings, records chan *RecordBatch, done chan bool) {
-	var serial = 1
-	var currentFileName string = generateWarcFileName(settings.Prefix, settings.Compression, serial)
-	var currentWarcinfoRecordID string
+// rotatorBufferSize is the size of the buffer the records
+// of a batch are written to before being written to the file
+const rotatorBufferSize = 64 * 1024
 
-	// Create and open the initial file
-	warcFile, err := os.Create(settings.OutputDirectory + currentFileName)
+// pendingDigest is a payload digest added to the Dedup store
+// once the record written with it is flushed
+type pendingDigest struct {
+	digest   string
+	original RefersTo
+}
+
+// writtenRecord is a record written by the rotator, counted in
+// the host statistics once it is flushed, with its status code
+type writtenRecord struct {
+	record *Record
+	status int
+}
+
+// rotatorFile is a WARC file being written by recordWriter
+type rotatorFile struct {
+	settings         *RotatorSettings
+	directory        string
+	name             string
+	file             *os.File
+	buffer           *bufio.Writer
+	counter          *countingWriter
+	writer           *Writer
+	warcinfoRecordID string
+	// index are the entries of the records written to the file,
+	// written as its CDXJ index when it is closed
+	index []CatalogEntry
+}
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// openRotatorFile creates a new WARC file in directory
+// and writes its warcinfo record
+func openRotatorFile(settings *RotatorSettings, warcinfo Header, directory string, serial int) (*rotatorFile, error) {
+	name, err := GenerateWarcFileName(settings, serial, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rotatorFile{
+		settings:  settings,
+		directory: directory,
+		name:      name + ".open",
+	}
+
+	file, err := os.Create(f.path())
+	if err != nil {
+		return nil, err
+	}
+
+	// The members of the records of a batch are buffered, so that tiny
+	// records don't cost a write to the file each
+	buffer := bufio.NewWriterSize(file, rotatorBufferSize)
+
+	// The members are counted to know the offsets of the records
+	counter := &countingWriter{writer: buffer}
+
+	// Each record is written in its own compressed member
+	members, err := NewMemberWriter(counter, settings.Compression)
 	if err != nil {
-		panic(err)
+		file.Close()
+		return nil, err
 	}
+	members.SkippableFrames = settings.SkippableFrames
 
-	// Initialize WARC writer
-	warcWriter, err := NewWriter(warcFile, currentFileName, settings.Compression)
+	warcWriter, err := NewWriter(members, f.name, "")
 	if err != nil {
-		panic(err)
+		file.Close()
+		return nil, err
 	}
+	warcWriter.DigestAlgorithm = settings.DigestAlgorithm
+
+	f.file = file
+	f.buffer = buffer
+	f.counter = counter
+	f.writer = warcWriter
 
 	// Write the info record
-	currentWarcinfoRecordID, err = warcWriter.WriteInfoRecord(settings.WarcinfoContent)
+	f.warcinfoRecordID, err = warcWriter.WriteInfoRecord(warcinfo, FlushMember())
 	if err != nil {
-		panic(err)
+		file.Close()
+		return nil, err
 	}
 
-	// If compression is enabled, we close the record's GZIP chunk
-	if settings.Compression != "" {
-		if settings.Compression == "GZIP" {
-			warcWriter.GZIPWriter.Close()
-			warcWriter, err = NewWriter(warcFile, currentFileName, settings.Compression)
-			if err != nil {
-				panic(err)
+	if err := buffer.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// path returns the path of the file while it is being written
+func (f *rotatorFile) path() string {
+	if f.settings.TempDirectory != "" {
+		return f.settings.TempDirectory + f.name
+	}
+	return f.directory + f.name
+}
+
+// finalPath returns the path of the file once it is finalized
+func (f *rotatorFile) finalPath() string {
+	return f.directory + strings.TrimSuffix(f.name, ".open")
+}
+
+// writeRecord writes a record to the file, in its own compressed member,
+// flush must be called for it to be written to the file
+func (f *rotatorFile) writeRecord(record *Record, opts ...WriteOption) (recordID string, err error) {
+	return f.writer.WriteRecord(record, append(opts, FlushMember())...)
+}
+
+// flush writes the buffered records to the file
+func (f *rotatorFile) flush() error {
+	return f.buffer.Flush()
+}
+
+// truncate drops the data written to the file from offset, e.g. the
+// records of a batch that failed, the data before offset being flushed.
+// The file must be closed afterwards.
+func (f *rotatorFile) truncate(offset int64) error {
+	flushErr := f.flush()
+
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > offset {
+		if err := f.file.Truncate(offset); err != nil {
+			return err
+		}
+	}
+
+	// The records dropped aren't indexed either
+	for i, entry := range f.index {
+		if entry.Offset >= offset {
+			f.index = f.index[:i]
+			break
+		}
+	}
+
+	return flushErr
+}
+
+// close closes the file, moves it to its final path without
+// the .open suffix, then calls the FinalizeHook
+func (f *rotatorFile) close() error {
+	if err := f.flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if err := moveFile(f.path(), f.finalPath()); err != nil {
+		return err
+	}
+
+	if f.settings.CDXJ {
+		if err := f.writeIndex(); err != nil {
+			return err
+		}
+	}
+
+	if f.settings.FinalizeHook != nil {
+		f.settings.FinalizeHook(f.finalPath())
+	}
+
+	return nil
+}
+
+// writeIndex writes the CDXJ index of the file next to it, sorted
+// as expected by pywb
+func (f *rotatorFile) writeIndex() error {
+	var lines []string
+	for _, entry := range f.index {
+		line, err := entry.CDXJ()
+		if err != nil {
+			continue
+		}
+		lines = append(lines, line+"\n")
+	}
+	sort.Strings(lines)
+
+	// The index is written to a temporary file first, so
+	// that a partial index is never left behind
+	path := f.finalPath() + ".cdxj"
+	if err := ioutil.WriteFile(path+".open", []byte(strings.Join(lines, "")), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".open", path)
+}
+
+// nextOutputDirectory returns the index of the directory the next WARC
+// file is written to, switching to the next spillover directory while
+// the current one is full
+func nextOutputDirectory(settings *RotatorSettings, current int) int {
+	directories := append([]string{settings.OutputDirectory}, settings.SpilloverDirectories...)
+
+	for current < len(directories)-1 && isDirectoryFull(settings, directories[current]) {
+		log.Printf("warc: output directory %s is full, switching to %s", directories[current], directories[current+1])
+		current++
+	}
+
+	return current
+}
+
+// outputDirectory returns the directory at index, 0 being
+// the output directory and the others the spillover ones
+func (s *RotatorSettings) outputDirectory(index int) string {
+	if index == 0 {
+		return s.OutputDirectory
+	}
+	return s.SpilloverDirectories[index-1]
+}
+
+// fail emits a WriteError event for err then returns it,
+// for recordWriter to apply the failure policy to it
+func fail(rotator *rotatorState, path string, err error) error {
+	rotator.health.failed(err)
+	rotator.emit(RotatorEvent{Type: WriteError, Path: path, Err: err})
+	return err
+}
+
+func recordWriter(rotator *rotatorState, records chan *RecordBatch, done chan bool) {
+	settings := rotator.settings
+
+	var serial = 1
+	if rotator.firstSerial > 1 {
+		serial = rotator.firstSerial
+	}
+	var directory = nextOutputDirectory(settings, 0)
+	var warcFile *rotatorFile
+	var shutdown bool
+
+	// openFile creates and opens a new file
+	openFile := func() error {
+		var err error
+		warcFile, err = openRotatorFile(settings, rotator.warcinfoContent(), settings.outputDirectory(directory), serial)
+		if err != nil {
+			return fail(rotator, "", err)
+		}
+		rotator.emit(RotatorEvent{Type: FileOpened, Path: warcFile.path()})
+		rotator.health.opened(warcFile.directory)
+		return nil
+	}
+
+	// closeFile closes the file and renames it
+	closeFile := func() error {
+		if err := warcFile.close(); err != nil {
+			return fail(rotator, warcFile.path(), err)
+		}
+		rotator.emit(RotatorEvent{Type: FileClosed, Path: warcFile.finalPath()})
+
+		if err := rotator.saveCheckpointDigests(); err != nil {
+			return fail(rotator, "", err)
+		}
+		return nil
+	}
+
+	// handleFailure applies the failure policy: the file the failure
+	// happened in is closed as is, a new one is opened for the next
+	// batch unless the rotator shuts down
+	handleFailure := func(err error) {
+		if warcFile != nil {
+			if warcFile.close() == nil {
+				rotator.emit(RotatorEvent{Type: FileClosed, Path: warcFile.finalPath()})
+			}
+			warcFile = nil
+		}
+		shutdown = rotator.recordFailure(err)
+	}
+
+	// pending are the batches written but not flushed yet, see CoalesceLatency,
+	// with the offset of their first record, the catalog entries of their
+	// records, the payload digests to deduplicate and the records to count
+	// in the host statistics
+	type pendingBatch struct {
+		batch   *RecordBatch
+		offset  int64
+		entries []CatalogEntry
+		digests []pendingDigest
+		written []writtenRecord
+		start   time.Time
+	}
+	var pending []pendingBatch
+
+	// reportPending reports the pending batches in the Health of the rotator
+	reportPending := func() {
+		var records int
+		for _, p := range pending {
+			records += len(p.batch.Records)
+		}
+		rotator.health.queued(len(pending), records)
+	}
+
+	// flushFile flushes the pending batches to the file, saves the
+	// checkpoint and adds their entries to the catalog
+	flushFile := func() error {
+		if err := warcFile.flush(); err != nil {
+			return fail(rotator, warcFile.path(), err)
+		}
+
+		// The checkpoint counts the records being flushed
+		var written []writtenRecord
+		for _, p := range pending {
+			written = append(written, p.written...)
+		}
+
+		if err := rotator.saveCheckpoint(serial, rotator.stats.listWith(written)); err != nil {
+			return fail(rotator, warcFile.path(), err)
+		}
+
+		// The entries of all the batches are added at once, so that
+		// none of them is in the catalog if it fails
+		if settings.Catalog != nil {
+			var entries []CatalogEntry
+			for _, p := range pending {
+				entries = append(entries, p.entries...)
 			}
-		} else if settings.Compression == "ZSTD" {
-			warcWriter.ZSTDWriter.Close()
-			warcWriter, err = NewWriter(warcFile, currentFileName, settings.Compression)
+
+			if err := settings.Catalog.Add(entries); err != nil {
+				return fail(rotator, warcFile.path(), err)
+			}
+		}
+
+		return nil
+	}
+
+	// flushPending flushes the file, then acknowledges the pending batches,
+	// which are dropped from the file if they can't be acknowledged
+	flushPending := func() {
+		if len(pending) == 0 {
+			return
+		}
+
+		// The file the batches were written to was closed after a failure
+		if warcFile == nil {
+			for _, p := range pending {
+				if p.batch.Done != nil {
+					p.batch.Done <- false
+				}
+			}
+			pending = nil
+			reportPending()
+			return
+		}
+
+		err := flushFile()
+		if err != nil {
+			if truncateErr := warcFile.truncate(pending[0].offset); truncateErr != nil {
+				rotator.emit(RotatorEvent{Type: WriteError, Path: warcFile.path(), Err: truncateErr})
+			}
+			handleFailure(err)
+		} else {
+			rotator.recordSuccess()
+			rotator.health.written()
+
+			// The records are in the file, a digest missing from the
+			// store only makes a later duplicate written in full
+			for _, p := range pending {
+				for _, w := range p.written {
+					rotator.stats.add(w.record, w.status)
+				}
+
+				for _, d := range p.digests {
+					if err := settings.Dedup.AddDigest(d.digest, d.original); err != nil {
+						rotator.emit(RotatorEvent{Type: WriteError, Path: warcFile.path(), Err: err})
+					}
+				}
+			}
+		}
+
+		for _, p := range pending {
+			if duration := time.Since(p.start); err == nil && duration > backpressureThreshold {
+				rotator.emit(RotatorEvent{Type: Backpressure, Path: warcFile.path(), Duration: duration})
+			}
+
+			if p.batch.Done != nil {
+				p.batch.Done <- err == nil
+			}
+		}
+		pending = nil
+		reportPending()
+	}
+
+	// closeLastFile writes the crawl report to the last file, closes
+	// it and saves the checkpoint once the channel is closed
+	closeLastFile := func() error {
+		if settings.CrawlReport {
+			report, err := newCrawlReportRecord(rotator.stats.list())
 			if err != nil {
-				panic(err)
+				return fail(rotator, warcFile.path(), err)
+			}
+			report.Header.Set("WARC-Warcinfo-ID", "<urn:uuid:"+warcFile.warcinfoRecordID+">")
+
+			if _, err := warcFile.writeRecord(report); err != nil {
+				return fail(rotator, warcFile.path(), err)
 			}
 		}
+
+		// We close the file and rename it
+		if err := closeFile(); err != nil {
+			return err
+		}
+
+		if err := rotator.saveCheckpoint(serial, rotator.stats.list()); err != nil {
+			return fail(rotator, "", err)
+		}
+		return nil
+	}
+
+	// Create and open the initial file
+	if err := openFile(); err != nil {
+		handleFailure(err)
 	}
 
 	for {
-		recordBatch, more := <-records
-		if more {
-			if isFileSizeExceeded(settings.OutputDirectory+currentFileName, settings.WarcSize) {
-				// WARC file size exceeded settings.WarcSize
-				// The WARC file is renamed to remove the .open suffix
-				err := os.Rename(settings.OutputDirectory+currentFileName, strings.TrimSuffix(settings.OutputDirectory+currentFileName, ".open"))
-				if err != nil {
-					panic(err)
-				}
-
-				// We flush the data and close the file
-				warcWriter.FileWriter.Flush()
-				if settings.Compression != "" {
-					if settings.Compression == "GZIP" {
-						warcWriter.GZIPWriter.Close()
-					} else if settings.Compression == "ZSTD" {
-						warcWriter.ZSTDWriter.Close()
-					}
+		// The pending batches are flushed once they waited too long
+		if len(pending) > 0 && time.Since(pending[0].start) >= settings.CoalesceLatency {
+			flushPending()
+		}
+
+		// Batches already queued are written before the pending ones
+		// are flushed, otherwise the file is flushed before waiting
+		var recordBatch *RecordBatch
+		var more bool
+		if len(pending) > 0 {
+			select {
+			case recordBatch, more = <-records:
+			default:
+				flushPending()
+				recordBatch, more = <-records
+			}
+		} else {
+			recordBatch, more = <-records
+		}
+
+		if !more {
+			flushPending()
+
+			// Channel has been closed
+			if warcFile != nil {
+				if err := closeLastFile(); err != nil {
+					handleFailure(err)
 				}
-				warcFile.Close()
+			}
+			rotator.health.stop()
+			rotator.events.close()
 
-				// Increment the file's serial number, then create the new file
+			done <- rotator.failures.get() == nil
+
+			return
+		}
+
+		// Once the rotator is shut down, the batches are dropped
+		if shutdown {
+			if recordBatch.Done != nil {
+				recordBatch.Done <- false
+			}
+			continue
+		}
+
+		var entries []CatalogEntry
+		var digests []pendingDigest
+		var written []writtenRecord
+		var batchFile *rotatorFile
+		var offset int64
+		start := time.Now()
+
+		err := func() error {
+			// A new file is opened after a failure
+			if warcFile == nil {
 				serial++
-				currentFileName = generateWarcFileName(settings.Prefix, settings.Compression, serial)
-				warcFile, err = os.Create(settings.OutputDirectory + currentFileName)
-				if err != nil {
-					panic(err)
+				directory = nextOutputDirectory(settings, directory)
+				if err := openFile(); err != nil {
+					return err
 				}
+			}
+
+			var err error
 
-				// Initialize new WARC writer
-				warcWriter, err = NewWriter(warcFile, currentFileName, settings.Compression)
-				if err != nil {
-					panic(err)
+			var reason string
+			exceeded, err := isFileSizeExceeded(warcFile.path(), settings.WarcSize)
+			if err != nil {
+				return fail(rotator, warcFile.path(), err)
+			}
+			if exceeded {
+				reason = "WARC size exceeded"
+			}
+			// The files keep the previous content if the new one is invalid
+			changed, err := rotator.takeWarcinfoContent()
+			if err != nil {
+				rotator.emit(RotatorEvent{Type: WriteError, Path: warcFile.path(), Err: err})
+			}
+			if changed {
+				reason = "warcinfo changed"
+			}
+
+			if reason != "" {
+				rotator.emit(RotatorEvent{Type: RotationTriggered, Path: warcFile.path(), Reason: reason})
+
+				// The batches written to the WARC file are flushed before it
+				// is closed and renamed to remove the .open suffix, the file
+				// being closed already if they failed
+				flushPending()
+				if warcFile != nil {
+					if err := closeFile(); err != nil {
+						return err
+					}
 				}
 
-				// Write the info record
-				currentWarcinfoRecordID, err := warcWriter.WriteInfoRecord(settings.WarcinfoContent)
-				if err != nil {
-					panic(err)
+				// Increment the file's serial number, then create the new file
+				serial++
+				directory = nextOutputDirectory(settings, directory)
+				if err := openFile(); err != nil {
+					return err
 				}
-				_ = currentWarcinfoRecordID
+			}
 
-				// If compression is enabled, we close the record's GZIP chunk
-				if settings.Compression != "" {
-					if settings.Compression == "GZIP" {
-						warcWriter.GZIPWriter.Close()
-					} else if settings.Compression == "ZSTD" {
-						warcWriter.ZSTDWriter.Close()
+			// The records written are dropped from there if the batch fails
+			batchFile = warcFile
+			offset = warcFile.counter.count
+
+			// Sniff the payload types before any record is written
+			if settings.IdentifyPayloadType {
+				for _, record := range recordBatch.Records {
+					if err := record.identifyPayloadType(SniffingIdentifier{}); err != nil {
+						return fail(rotator, warcFile.path(), err)
 					}
 				}
 			}
 
+			// The methods are read before the content of the requests is consumed
+			methods := requestMethods(recordBatch.Records)
+
 			// Write all the records of the record batch
-			for _, record := range recordBatch.Records {
-				warcWriter, err = NewWriter(warcFile, currentFileName, settings.Compression)
-				if err != nil {
-					panic(err)
+			for i, record := range recordBatch.Records {
+				record.Header.Set("WARC-Date", recordBatch.CaptureTime)
+				record.Header.Set("WARC-Warcinfo-ID", "<urn:uuid:"+warcFile.warcinfoRecordID+">")
+
+				if settings.CrawlIDField && record.Header.Get(CrawlIDField) == "" {
+					if recordBatch.CrawlID != "" {
+						record.Header.Set(CrawlIDField, recordBatch.CrawlID)
+					} else if settings.CrawlID != "" {
+						record.Header.Set(CrawlIDField, settings.CrawlID)
+					}
 				}
 
-				record.Header.Set("WARC-Date", recordBatch.CaptureTime)
-				record.Header.Set("WARC-Warcinfo-ID", "<urn:uuid:"+currentWarcinfoRecordID+">")
+				// Identical payloads already written are replaced by revisits
+				var digest string
+				if settings.Dedup != nil {
+					record, digest, err = dedupRecord(settings.Dedup, record, settings.DigestAlgorithm)
+					if err != nil {
+						return fail(rotator, warcFile.path(), err)
+					}
+					recordBatch.Records[i] = record
+				}
 
-				_, err := warcWriter.WriteRecord(record)
-				if err != nil {
-					panic(err)
+				// The simhash is computed before the content is consumed
+				var simhash uint64
+				var hasSimhash bool
+				if settings.Simhash {
+					simhash, hasSimhash, err = record.PayloadSimhash()
+					if err != nil {
+						return fail(rotator, warcFile.path(), err)
+					}
+				}
+
+				// The captures to enrich are selected before the content is consumed
+				warcType := record.Header.Get("WARC-Type")
+				enrich := warcType == "response" || warcType == "resource"
+				if enrich && settings.EnrichmentPolicy != nil {
+					enrich = settings.EnrichmentPolicy.Enrich(record)
 				}
 
-				// If compression is enabled, we close the record's GZIP chunk
-				if settings.Compression != "" {
-					if settings.Compression == "GZIP" {
-						warcWriter.GZIPWriter.Close()
-					} else if settings.Compression == "ZSTD" {
-						warcWriter.ZSTDWriter.Close()
+				// The copy given to the extraction pool is made before the
+				// content is consumed, and submitted once the record ID is set
+				var extracted *Record
+				if settings.ExtractionPool != nil && enrich {
+					extracted, err = record.Clone()
+					if err != nil {
+						return fail(rotator, warcFile.path(), err)
 					}
 				}
-			}
-			warcWriter.FileWriter.Flush()
 
-			if recordBatch.Done != nil {
-				recordBatch.Done <- true
-			}
-		} else {
-			// Channel has been closed
-			// We flush the data, close the file, and rename it
-			warcWriter.FileWriter.Flush()
-			if settings.Compression != "" {
-				if settings.Compression == "GZIP" {
-					warcWriter.GZIPWriter.Close()
-				} else if settings.Compression == "ZSTD" {
-					warcWriter.ZSTDWriter.Close()
+				// The copy given to the identification pool too
+				var identified *Record
+				if settings.IdentificationPool != nil && (warcType == "response" || warcType == "resource") {
+					identified, err = record.Clone()
+					if err != nil {
+						return fail(rotator, warcFile.path(), err)
+					}
 				}
-			}
-			warcFile.Close()
 
-			// The WARC file is renamed to remove the .open suffix
-			err := os.Rename(settings.OutputDirectory+currentFileName, strings.TrimSuffix(settings.OutputDirectory+currentFileName, ".open"))
-			if err != nil {
-				panic(err)
+				// The status code is read before the content is consumed
+				status := recordStatusCode(record)
+
+				var entry CatalogEntry
+				if settings.Catalog != nil || settings.CDXJ {
+					entry = newCatalogEntry(record)
+					entry.Offset = warcFile.counter.count
+					entry.Collection = settings.Collection
+				}
+
+				method := methods[record.Header.Get("WARC-Record-ID")]
+				if _, err := warcFile.writeRecord(record, RequestMethod(method)); err != nil {
+					return fail(rotator, warcFile.path(), err)
+				}
+
+				if settings.Catalog != nil || settings.CDXJ {
+					entry.complete(record)
+					entry.File = strings.TrimSuffix(warcFile.name, ".open")
+					entry.Length = warcFile.counter.count - entry.Offset
+					entries = append(entries, entry)
+
+					// The entry is indexed with the file it is written to
+					if settings.CDXJ {
+						warcFile.index = append(warcFile.index, entry)
+					}
+				}
+
+				if digest != "" {
+					digests = append(digests, pendingDigest{digest: digest, original: NewRefersTo(record)})
+				}
+
+				written = append(written, writtenRecord{record: record, status: status})
+
+				if settings.AnomalyDetector != nil {
+					rotator.observe(record, status)
+				}
+
+				if extracted != nil {
+					extracted.Header = record.Header.Clone()
+					settings.ExtractionPool.Submit(extracted)
+				}
+
+				if identified != nil {
+					identified.Header = record.Header.Clone()
+					settings.IdentificationPool.Submit(identified)
+				}
+
+				if enrich && settings.EnrichmentHook != nil {
+					settings.EnrichmentHook(record)
+				}
+
+				if hasSimhash {
+					metadata := newSimhashRecord(record, simhash)
+					metadata.Header.Set("WARC-Date", recordBatch.CaptureTime)
+					metadata.Header.Set("WARC-Warcinfo-ID", "<urn:uuid:"+warcFile.warcinfoRecordID+">")
+
+					if _, err := warcFile.writeRecord(metadata); err != nil {
+						return fail(rotator, warcFile.path(), err)
+					}
+				}
 			}
 
-			done <- true
+			return nil
+		}()
+		if err != nil {
+			// The records of the batch written before the failure are
+			// dropped, the batches before this one are in the file
+			if batchFile != nil && batchFile == warcFile {
+				if err := warcFile.truncate(offset); err != nil {
+					rotator.emit(RotatorEvent{Type: WriteError, Path: warcFile.path(), Err: err})
+				}
+			}
+			flushPending()
+			handleFailure(err)
+			if recordBatch.Done != nil {
+				recordBatch.Done <- false
+			}
+			continue
+		}
 
-			return
+		// The batch is flushed with the next queued ones
+		pending = append(pending, pendingBatch{batch: recordBatch, offset: offset, entries: entries, digests: digests, written: written, start: start})
+		reportPending()
+		if settings.CoalesceLatency <= 0 {
+			flushPending()
 		}
 	}
 }
@@ -0,0 +1,448 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for the FinalizeHook rotator setting
+func TestRotatorFinalizeHook(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	var finalized []string
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FinalizeHook = func(path string) {
+		finalized = append(finalized, path)
+	}
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	record := NewRecord()
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	if len(finalized) != 1 {
+		t.Fatalf("expected 1 finalized file, got %d", len(finalized))
+	}
+
+	if strings.HasSuffix(finalized[0], ".open") {
+		t.Errorf("expected finalized file without .open suffix, got %q", finalized[0])
+	}
+
+	// Read back the finalized file
+	file, err := os.Open(finalized[0])
+	if err != nil {
+		t.Fatalf("failed to open finalized file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	warcinfo, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected warcinfo record, got %v", err)
+	}
+
+	resource, err := reader.ReadRecord(false)
+	if err != nil {
+		t.Fatalf("expected resource record, got %v", err)
+	}
+
+	if resource.Header.Get("WARC-Warcinfo-ID") != warcinfo.Header.Get("WARC-Record-ID") {
+		t.Errorf("expected WARC-Warcinfo-ID %q, got %q", warcinfo.Header.Get("WARC-Record-ID"), resource.Header.Get("WARC-Warcinfo-ID"))
+	}
+
+	content, err := ioutil.ReadAll(resource.Content)
+	if err != nil {
+		t.Fatalf("failed to read record content: %v", err)
+	}
+
+	if string(content) != "Hello, World!" {
+		t.Errorf("expected %q, got %q", "Hello, World!", content)
+	}
+
+	if _, err := reader.ReadRecord(false); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+// Tests for the SpilloverDirectories rotator setting
+func TestRotatorSpillover(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = filepath.Join(outputDirectory, "primary")
+	rotatorSettings.SpilloverDirectories = []string{filepath.Join(outputDirectory, "secondary")}
+	// Rotate after each batch, and consider a directory full
+	// as soon as it contains a WARC file
+	rotatorSettings.WarcSize = 0.000001
+	rotatorSettings.DirectoryQuota = 0.000001
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		record := NewRecord()
+		record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		records <- batch
+	}
+
+	close(records)
+	<-done
+
+	for directory, expected := range map[string]int{"primary": 1, "secondary": 3} {
+		paths, err := filepath.Glob(filepath.Join(outputDirectory, directory, "*.warc.gz"))
+		if err != nil {
+			t.Fatalf("failed to list %s directory: %v", directory, err)
+		}
+
+		if len(paths) != expected {
+			t.Errorf("expected %d WARC files in %s directory, got %d", expected, directory, len(paths))
+		}
+	}
+}
+
+// Tests that the WARC files written in the temp directory
+// are moved to the output directory once finalized
+func TestRotatorTempDirectory(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = filepath.Join(outputDirectory, "output")
+	rotatorSettings.TempDirectory = filepath.Join(outputDirectory, "temp")
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	record := NewRecord()
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	openPaths, err := filepath.Glob(filepath.Join(outputDirectory, "temp", "*.warc.gz.open"))
+	if err != nil {
+		t.Fatalf("failed to list temp directory: %v", err)
+	}
+
+	if len(openPaths) != 1 {
+		t.Errorf("expected 1 open WARC file in temp directory, got %d", len(openPaths))
+	}
+
+	close(records)
+	<-done
+
+	for directory, expected := range map[string]int{"output": 1, "temp": 0} {
+		paths, err := filepath.Glob(filepath.Join(outputDirectory, directory, "*.warc.gz*"))
+		if err != nil {
+			t.Fatalf("failed to list %s directory: %v", directory, err)
+		}
+
+		if len(paths) != expected {
+			t.Errorf("expected %d WARC files in %s directory, got %d", expected, directory, len(paths))
+		}
+	}
+}
+
+// Tests that the rotator emits events when
+// opening, rotating and closing WARC files
+func TestRotatorEvents(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.WarcSize = 0.000001
+	events := rotatorSettings.Events()
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	// The warcinfo record alone exceeds WarcSize, so
+	// the batch is written after a rotation
+	record := NewRecord()
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+	records <- batch
+
+	close(records)
+	<-done
+
+	expected := []RotatorEventType{FileOpened, RotationTriggered, FileClosed, FileOpened, FileClosed}
+	for i, eventType := range expected {
+		select {
+		case event := <-events:
+			if event.Type != eventType {
+				t.Errorf("event %d: expected type %d, got %d", i, eventType, event.Type)
+			}
+			if event.Path == "" {
+				t.Errorf("event %d: expected a path", i)
+			}
+		default:
+			t.Fatalf("expected %d events, got %d", len(expected), i)
+		}
+	}
+}
+
+// Tests that the settings of a rotator can be reused for another
+// one, the second rotator starting with its own events, stats and
+// failures
+func TestRotatorSettingsReuse(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.FailAfter = 1
+
+	// The first rotator shuts down after its first failure
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start first rotator: %v", err)
+	}
+
+	sendPayloads(records, []string{"ok", "fail"}, errors.New("fail"))
+	close(records)
+	<-done
+
+	if rotatorSettings.Err() == nil {
+		t.Fatalf("expected the first rotator to shut down")
+	}
+
+	records, done, err = rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start second rotator: %v", err)
+	}
+	events := rotatorSettings.Events()
+
+	written := sendPayloads(records, []string{"ok", "ok"}, errors.New("fail"))
+	close(records)
+	<-done
+
+	if !written[0] || !written[1] {
+		t.Errorf("expected the batches of the second rotator to be written, got %v", written)
+	}
+
+	if err := rotatorSettings.Err(); err != nil {
+		t.Errorf("expected no error for the second rotator, got %v", err)
+	}
+
+	hosts := rotatorSettings.HostStats()
+	if len(hosts) != 1 || hosts[0].Records != 2 {
+		t.Errorf("expected the stats of the second rotator only, got %+v", hosts)
+	}
+
+	expected := []RotatorEventType{FileOpened, FileClosed}
+	for i, eventType := range expected {
+		event, ok := <-events
+		if !ok {
+			t.Fatalf("expected %d events, got %d", len(expected), i)
+		}
+		if event.Type != eventType {
+			t.Errorf("event %d: expected type %d, got %d", i, eventType, event.Type)
+		}
+	}
+
+	if _, ok := <-events; ok {
+		t.Errorf("expected the events channel to be closed")
+	}
+}
+
+// Tests that changing the warcinfo content at runtime rotates the WARC file
+func TestRotatorSetWarcinfoContent(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.WarcinfoContent.Set("operator", "day shift")
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	for _, operator := range []string{"day shift", "night shift", "night shift"} {
+		content := NewHeader()
+		content.Set("operator", operator)
+		rotatorSettings.SetWarcinfoContent(content)
+
+		record := NewRecord()
+		record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		records <- batch
+	}
+
+	close(records)
+	<-done
+
+	// The settings aren't modified by the rotator
+	if operator := rotatorSettings.WarcinfoContent.Get("operator"); operator != "day shift" {
+		t.Errorf("expected WarcinfoContent unchanged, got operator %q", operator)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil {
+		t.Fatalf("failed to list output directory: %v", err)
+	}
+	sort.Strings(paths)
+
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 WARC files, got %d", len(paths))
+	}
+
+	for i, expected := range []string{"day shift", "night shift"} {
+		file, err := os.Open(paths[i])
+		if err != nil {
+			t.Fatalf("failed to open WARC file: %v", err)
+		}
+
+		reader, err := NewReader(file)
+		if err != nil {
+			t.Fatalf("warc.NewReader failed: %v", err)
+		}
+
+		warcinfo, err := reader.Warcinfo()
+		if err != nil {
+			t.Fatalf("failed to read warcinfo: %v", err)
+		}
+
+		if warcinfo.Get("operator") != expected {
+			t.Errorf("expected operator %q in %s, got %q", expected, paths[i], warcinfo.Get("operator"))
+		}
+
+		reader.Close()
+		file.Close()
+	}
+}
+
+// Tests that batches queued back to back are all written
+// and acknowledged when CoalesceLatency is set
+func TestRotatorCoalesceLatency(t *testing.T) {
+	outputDirectory, err := ioutil.TempDir("", "warc-rotator-*")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDirectory)
+
+	rotatorSettings := NewRotatorSettings()
+	rotatorSettings.OutputDirectory = outputDirectory
+	rotatorSettings.CoalesceLatency = time.Hour
+
+	records, done, err := rotatorSettings.NewWARCRotator()
+	if err != nil {
+		t.Fatalf("failed to start rotator: %v", err)
+	}
+
+	var batches []*RecordBatch
+	for i := 0; i < 10; i++ {
+		record := NewRecord()
+		record.Header.Set("WARC-Target-URI", "http://example.com/"+strconv.Itoa(i))
+		record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+		batch := NewRecordBatch()
+		batch.Records = append(batch.Records, record)
+		batch.Done = make(chan bool, 1)
+		records <- batch
+
+		batches = append(batches, batch)
+	}
+
+	// The last batch is flushed although no batch follows it
+	for i, batch := range batches {
+		if !<-batch.Done {
+			t.Errorf("expected batch %d to be written", i)
+		}
+	}
+
+	close(records)
+	<-done
+
+	paths, err := filepath.Glob(filepath.Join(outputDirectory, "*.warc.gz"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %v, %v", paths, err)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open WARC file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	reader.ReadRecord(false)
+	for i := 0; i < 10; i++ {
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			t.Fatalf("failed to read record %d: %v", i, err)
+		}
+
+		if target := record.Header.Get("WARC-Target-URI"); target != "http://example.com/"+strconv.Itoa(i) {
+			t.Errorf("expected record %d, got %s", i, target)
+		}
+	}
+}
@@ -4,15 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
-	"fmt"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/klauspost/compress/zstd"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -21,17 +19,81 @@ type Writer struct {
 	FileName    string
 	Compression string
 	GZIPWriter  *gzip.Writer
-	ZSTDWriter  *zstd.Encoder
-	FileWriter  *bufio.Writer
+	ZSTDWriter  *zstdEncoder
+	// CompressionWriter is the writer compressing the data, whatever the
+	// compression algorithm, closing it ends the compressed member
+	CompressionWriter io.WriteCloser
+	FileWriter        *bufio.Writer
+	// StrictSpec makes WriteRecord reject the records violating the WARC
+	// specification, see Record.Validate. Otherwise they are written and
+	// their violations are listed in their Problems.
+	StrictSpec bool
+	// DigestAlgorithm is the algorithm of the WARC-Block-Digest of the
+	// records written, sha1 by default, see RegisterDigestAlgorithm
+	DigestAlgorithm string
+
+	// output is the writer the compressed members are written to
+	output io.Writer
+}
+
+// WriteOption controls how a record is written by Writer.WriteRecord
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	flushMember   bool
+	noFlush       bool
+	requestMethod string
+}
+
+// FlushMember makes WriteRecord write the record in its own compressed
+// member, as expected by the readers of WARC files seeking to records:
+// the compression writer is closed after the record, ending the member,
+// and a new one is started for the next record. If the Writer writes to a
+// MemberWriter, the record is written between its Begin and End calls.
+// It has no effect on uncompressed writers.
+func FlushMember() WriteOption {
+	return func(options *writeOptions) {
+		options.flushMember = true
+	}
+}
+
+// NoFlush makes WriteRecord keep the end of the record in the Writer's
+// buffer, rather than flushing it to the underlying writer, e.g. to write
+// tiny records in a row. It is ignored when the member is flushed.
+func NoFlush() WriteOption {
+	return func(options *writeOptions) {
+		options.noFlush = true
+	}
+}
+
+// RequestMethod gives WriteRecord the method of the request answered by a
+// response record, e.g. HEAD, whose response declares the Content-Length
+// of a body it doesn't have, so that the record isn't annotated with
+// DeclaredContentLengthField. The rotator infers it from the request
+// record concurrent to the response in its batch.
+func RequestMethod(method string) WriteOption {
+	return func(options *writeOptions) {
+		options.requestMethod = method
+	}
 }
 
 // RecordBatch is a structure that contains a bunch of
 // records to be written at the same time, and a common
-// capture timestamp
+// capture timestamp.
+// Once a batch has been sent to the rotator, it is owned by the
+// rotator: the caller must not mutate it or its records anymore,
+// use Clone beforehand if the records need to be reused.
+// The records of a batch are written contiguously to the same WARC file,
+// in the order of Records, so the caller decides whether requests come
+// before or after their responses. WARC-Concurrent-To fields refer to
+// WARC-Record-ID values and stay valid whatever the order.
 type RecordBatch struct {
 	Records     []*Record
 	Done        chan bool
 	CaptureTime string
+	// CrawlID, if set, overrides RotatorSettings.CrawlID
+	// for the records of the batch
+	CrawlID string
 }
 
 // Record represents a WARC record.
@@ -39,6 +101,58 @@ type Record struct {
 	Header      Header
 	Content     io.Reader
 	PayloadPath string
+	// RawHeader holds the version line and header fields of the record
+	// exactly as they were read, including the empty line ending them.
+	// It is only set by the Reader, and ignored by WriteRecord.
+	RawHeader []byte
+	// Problems are the violations of the WARC specification found when
+	// the record was read or written without StrictSpec
+	Problems []string
+}
+
+// Clone returns a deep copy of the record. The content is read into
+// memory so that both records can be consumed independently, the
+// original record's Content is replaced accordingly.
+func (r *Record) Clone() (*Record, error) {
+	clone := &Record{
+		Header:      r.Header.Clone(),
+		PayloadPath: r.PayloadPath,
+	}
+
+	if r.RawHeader != nil {
+		clone.RawHeader = append([]byte(nil), r.RawHeader...)
+	}
+
+	if r.Content != nil {
+		data, err := ioutil.ReadAll(r.Content)
+		if err != nil {
+			return nil, err
+		}
+		r.Content = bytes.NewReader(data)
+		clone.Content = bytes.NewReader(data)
+	}
+
+	return clone, nil
+}
+
+// Clone returns a deep copy of the record batch, the Done channel
+// isn't copied.
+func (b *RecordBatch) Clone() (*RecordBatch, error) {
+	clone := &RecordBatch{
+		Records:     make([]*Record, 0, len(b.Records)),
+		CaptureTime: b.CaptureTime,
+		CrawlID:     b.CrawlID,
+	}
+
+	for _, record := range b.Records {
+		recordClone, err := record.Clone()
+		if err != nil {
+			return nil, err
+		}
+		clone.Records = append(clone.Records, recordClone)
+	}
+
+	return clone, nil
 }
 
 // WriteRecord writes a record to the underlying WARC file.
@@ -50,13 +164,20 @@ type Record struct {
 // 	Content
 // 	CLRF
 // 	CLRF
-func (w *Writer) WriteRecord(r *Record) (recordID string, err error) {
+// The record is flushed to the underlying writer, opts can change how,
+// see FlushMember and NoFlush.
+func (w *Writer) WriteRecord(r *Record, opts ...WriteOption) (recordID string, err error) {
+	var options writeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	// Generate record ID
 	recordID = uuid.NewV4().String()
 
 	// Add the mandatories headers
 	if r.Header.Get("WARC-Date") == "" {
-		r.Header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+		r.Header.Set("WARC-Date", FormatDate(time.Now(), Version10))
 	}
 
 	if r.Header.Get("WARC-Type") == "" {
@@ -67,111 +188,228 @@ func (w *Writer) WriteRecord(r *Record) (recordID string, err error) {
 		r.Header.Set("WARC-Record-ID", "<urn:uuid:"+recordID+">")
 	}
 
-	_, err = io.WriteString(w.FileWriter, "WARC/1.0\r\n")
-	if err != nil {
+	r.Problems = nil
+	if err := r.Validate(); err != nil {
+		if w.StrictSpec {
+			return recordID, err
+		}
+		r.Problems = err.(*ValidationError).Problems
+	}
+
+	// Nothing is written with an unsupported digest algorithm
+	if _, err := lookupDigestAlgorithm(w.DigestAlgorithm); err != nil {
 		return recordID, err
 	}
 
-	// If PayloadPath isn't empty, it means that the payload we need to write
-	// lives on disk
+	// Response and resource records get the digest of their
+	// payload, as expected by the indexers of WARC files
+	if r.Header.Get("WARC-Payload-Digest") == "" {
+		setPayloadDigest(r, w.DigestAlgorithm)
+	}
+
+	// The block and its digest are read before anything is
+	// written, so that a failure doesn't leave a truncated record
+	var block io.Reader
 	if r.PayloadPath != "" {
+		// If PayloadPath isn't empty, it means that the payload we need
+		// to write lives on disk
 		file, err := os.Open(r.PayloadPath)
 		if err != nil {
 			return recordID, err
 		}
 		defer file.Close()
 
-		// Write headers
 		fileStats, err := file.Stat()
 		if err != nil {
 			return recordID, err
 		}
 		r.Header.Set("Content-Length", strconv.Itoa(int(fileStats.Size())))
 
+		if err := annotateContentLength(r, file, options.requestMethod); err != nil {
+			return recordID, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return recordID, err
+		}
+
 		// Generate WARC-Block-Digest
-		digest, err := GetSHA1FromFile(r.PayloadPath)
-		if err == nil {
-			r.Header.Set("WARC-Block-Digest", "sha1:"+digest)
+		digest, err := computeDigest(w.DigestAlgorithm, file)
+		if err != nil {
+			return recordID, err
 		}
+		r.Header.Set("WARC-Block-Digest", digest)
 
-		// Write headers
-		for key, value := range r.Header {
-			_, err = io.WriteString(w.FileWriter, strings.Title(key)+": "+value+"\r\n")
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return recordID, err
+		}
+		block = file
+	} else {
+		// A record without content, like the response to
+		// a HEAD request, has an empty block
+		var data []byte
+		if r.Content != nil {
+			data, err = ioutil.ReadAll(r.Content)
 			if err != nil {
 				return recordID, err
 			}
 		}
 
-		_, err = io.WriteString(w.FileWriter, "\r\n")
+		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		digest, err := computeDigest(w.DigestAlgorithm, bytes.NewReader(data))
 		if err != nil {
 			return recordID, err
 		}
+		r.Header.Set("WARC-Block-Digest", digest)
 
-		_, err = io.Copy(w.FileWriter, file)
-		if err != nil {
+		if err := annotateContentLength(r, bytes.NewReader(data), options.requestMethod); err != nil {
 			return recordID, err
 		}
-	} else {
-		data, err := ioutil.ReadAll(r.Content)
-		if err != nil {
+		block = bytes.NewReader(data)
+	}
+
+	if options.flushMember {
+		if err := w.beginMember(); err != nil {
 			return recordID, err
 		}
+	}
 
-		// Write headers
-		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
-		r.Header.Set("WARC-Block-Digest", "sha1:"+GetSHA1(data))
-
-		for key, value := range r.Header {
-			_, err = io.WriteString(w.FileWriter, strings.Title(key)+": "+value+"\r\n")
-			if err != nil {
-				return recordID, err
-			}
-		}
+	_, err = io.WriteString(w.FileWriter, Version10+"\r\n")
+	if err != nil {
+		return recordID, err
+	}
 
-		_, err = io.WriteString(w.FileWriter, "\r\n"+string(data))
+	// Write headers
+	for _, key := range r.Header.canonicalKeys() {
+		_, err = io.WriteString(w.FileWriter, strings.Title(key)+": "+r.Header[key]+"\r\n")
 		if err != nil {
 			return recordID, err
 		}
 	}
 
+	_, err = io.WriteString(w.FileWriter, "\r\n")
+	if err != nil {
+		return recordID, err
+	}
+
+	_, err = io.Copy(w.FileWriter, block)
+	if err != nil {
+		return recordID, err
+	}
+
 	_, err = io.WriteString(w.FileWriter, "\r\n\r\n")
 	if err != nil {
 		return recordID, err
 	}
 
+	if options.flushMember {
+		return recordID, w.endMember()
+	}
+
 	// Flush data
-	w.FileWriter.Flush()
+	if !options.noFlush {
+		w.FileWriter.Flush()
+	}
 
 	return recordID, nil
 }
 
+// beginMember starts the member of a record
+// written to a MemberWriter, if not started yet
+func (w *Writer) beginMember() error {
+	if members, ok := w.output.(*MemberWriter); ok && members.member == nil {
+		return members.Begin()
+	}
+	return nil
+}
+
+// endMember flushes the record written and ends its compressed member,
+// the following records being written in a new one
+func (w *Writer) endMember() error {
+	if err := w.FileWriter.Flush(); err != nil {
+		return err
+	}
+
+	if members, ok := w.output.(*MemberWriter); ok {
+		return members.End()
+	}
+
+	if w.CompressionWriter == nil {
+		return nil
+	}
+
+	if w.output == nil {
+		return errors.New("Writer has no underlying writer, it must be created with NewWriter")
+	}
+
+	if err := w.CompressionWriter.Close(); err != nil {
+		return err
+	}
+
+	// Reuse the compression writer for the next member if possible
+	if resetter, ok := w.CompressionWriter.(writerResetter); ok {
+		resetter.Reset(w.output)
+		return nil
+	}
+
+	codec, err := lookupCompression(w.Compression)
+	if err != nil {
+		return err
+	}
+
+	compressionWriter, err := codec.newWriter(w.output)
+	if err != nil {
+		return err
+	}
+	w.CompressionWriter = compressionWriter
+	w.FileWriter.Reset(compressionWriter)
+
+	return nil
+}
+
+// WriteRawRecord writes a record verbatim to the underlying WARC file,
+// headerBytes must contain the version line and the header fields
+// terminated by an empty line, e.g. the RawHeader of a record read with
+// a Reader. The record isn't re-serialized and no digest is computed,
+// so the original bytes are preserved bit-for-bit.
+func (w *Writer) WriteRawRecord(headerBytes []byte, block io.Reader) error {
+	_, err := w.FileWriter.Write(headerBytes)
+	if err != nil {
+		return err
+	}
+
+	if block != nil {
+		_, err = io.Copy(w.FileWriter, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w.FileWriter, "\r\n\r\n")
+	if err != nil {
+		return err
+	}
+
+	return w.FileWriter.Flush()
+}
+
 // WriteInfoRecord method can be used to write informations record to the WARC file
-func (w *Writer) WriteInfoRecord(payload map[string]string) (recordID string, err error) {
+func (w *Writer) WriteInfoRecord(payload map[string]string, opts ...WriteOption) (recordID string, err error) {
 	// Initialize the record
 	infoRecord := NewRecord()
 
 	// Set the headers
-	infoRecord.Header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	infoRecord.Header.Set("WARC-Date", FormatDate(time.Now(), Version10))
 	infoRecord.Header.Set("WARC-Filename", strings.TrimSuffix(w.FileName, ".open"))
 	infoRecord.Header.Set("WARC-Type", "warcinfo")
 	infoRecord.Header.Set("Content-Type", "application/warc-fields")
 
 	// Write the payload
 	warcInfoContent := new(bytes.Buffer)
-	for k, v := range payload {
-		warcInfoContent.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	if err := WriteWarcFields(warcInfoContent, payload); err != nil {
+		return "", err
 	}
 	infoRecord.Content = warcInfoContent
 
-	// Generate WARC-Block-Digest
-	infoRecord.Header.Set("WARC-Block-Digest", "sha1:"+GetSHA1(warcInfoContent.Bytes()))
-
 	// Finally, write the record and flush the data
-	recordID, err = w.WriteRecord(infoRecord)
-	if err != nil {
-		return recordID, err
-	}
-
-	w.FileWriter.Flush()
-	return recordID, err
+	return w.WriteRecord(infoRecord, opts...)
 }
@@ -0,0 +1,271 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests for the RecordBatch.Clone method
+func TestRecordBatchClone(t *testing.T) {
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "resource")
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	batch := NewRecordBatch()
+	batch.Records = append(batch.Records, record)
+
+	clone, err := batch.Clone()
+	if err != nil {
+		t.Fatalf("failed to clone record batch: %v", err)
+	}
+
+	clone.Records[0].Header.Set("WARC-Type", "metadata")
+	if record.Header.Get("WARC-Type") != "resource" {
+		t.Error("Modifying the clone modified the original header")
+	}
+
+	for _, r := range []*Record{record, clone.Records[0]} {
+		content, err := ioutil.ReadAll(r.Content)
+		if err != nil {
+			t.Fatalf("failed to read record content: %v", err)
+		}
+		if string(content) != "Hello, World!" {
+			t.Errorf("expected %q, got %q", "Hello, World!", content)
+		}
+	}
+}
+
+// Tests for the Writer.WriteRawRecord method
+func TestWriteRawRecord(t *testing.T) {
+	file, err := os.Open("testdata/test.warc.gz")
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("warc.NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	buffer := new(bytes.Buffer)
+	writer, err := NewWriter(buffer, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+
+	for {
+		record, err := reader.ReadRecord(false)
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("failed to read record: %v", err)
+			}
+			break
+		}
+
+		if err := writer.WriteRawRecord(record.RawHeader, record.Content); err != nil {
+			t.Fatalf("failed to write raw record: %v", err)
+		}
+	}
+
+	// The copy must be identical to the decompressed original
+	file.Seek(0, io.SeekStart)
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+
+	original, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	if !bytes.Equal(original, buffer.Bytes()) {
+		t.Error("raw copy differs from the original records")
+	}
+}
+
+// Tests for the canonical order of the header fields written by WriteRecord
+func TestWriteRecordHeaderOrder(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer, err := NewWriter(buffer, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to initialize a new writer: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("X-Custom-B", "b")
+	record.Header.Set("X-Custom-A", "a")
+	record.Header.Set("WARC-Target-URI", "https://example.com/")
+	record.Header.Set("WARC-Date", "2020-12-21T23:58:40Z")
+	record.Header.Set("WARC-Record-ID", "<urn:uuid:640799f1-71b7-47b5-8725-3d7619e93920>")
+	record.Content = bytes.NewReader([]byte("Hello, World!"))
+
+	if _, err := writer.WriteRecord(record); err != nil {
+		t.Fatalf("failed to write record: %v", err)
+	}
+
+	expected := "WARC/1.0\r\n" +
+		"Warc-Type: resource\r\n" +
+		"Warc-Record-Id: <urn:uuid:640799f1-71b7-47b5-8725-3d7619e93920>\r\n" +
+		"Warc-Date: 2020-12-21T23:58:40Z\r\n" +
+		"Warc-Target-Uri: https://example.com/\r\n" +
+		"Content-Length: 13\r\n" +
+		"Warc-Block-Digest: sha1:" + GetSHA1([]byte("Hello, World!")) + "\r\n" +
+		"Warc-Payload-Digest: sha1:" + GetSHA1([]byte("Hello, World!")) + "\r\n" +
+		"X-Custom-A: a\r\n" +
+		"X-Custom-B: b\r\n" +
+		"\r\n" +
+		"Hello, World!\r\n\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buffer.String())
+	}
+}
+
+// Tests that the records written with FlushMember
+// are in their own gzip member
+func TestWriteRecordFlushMember(t *testing.T) {
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc.gz", "GZIP")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	bodies := []string{"Hello, World!", "Goodbye, World!"}
+	for _, body := range bodies {
+		record := NewRecord()
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader(body)
+		if _, err := writer.WriteRecord(record, FlushMember()); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+
+	gzipReader, err := gzip.NewReader(output)
+	if err != nil {
+		t.Fatalf("failed to create gzip reader: %v", err)
+	}
+
+	members := 0
+	for {
+		gzipReader.Multistream(false)
+
+		content, err := ioutil.ReadAll(gzipReader)
+		if err != nil {
+			t.Fatalf("failed to read member: %v", err)
+		}
+
+		if !strings.HasSuffix(string(content), bodies[members]+"\r\n\r\n") {
+			t.Errorf("expected member %d to hold %q, got %q", members, bodies[members], content)
+		}
+		members++
+
+		if err := gzipReader.Reset(output); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to reset gzip reader: %v", err)
+		}
+	}
+
+	if members != len(bodies) {
+		t.Errorf("expected %d members, got %d", len(bodies), members)
+	}
+}
+
+// Tests that the records written with NoFlush stay buffered
+func TestWriteRecordNoFlush(t *testing.T) {
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.Content = strings.NewReader("Hello, World!")
+	if _, err := writer.WriteRecord(record, NoFlush()); err != nil {
+		t.Fatalf("failed to write record: %v", err)
+	}
+
+	if output.Len() != 0 {
+		t.Errorf("expected the record to be buffered, got %d bytes written", output.Len())
+	}
+
+	if err := writer.FileWriter.Flush(); err != nil {
+		t.Fatalf("failed to flush writer: %v", err)
+	}
+
+	if !strings.HasSuffix(output.String(), "Hello, World!\r\n\r\n") {
+		t.Errorf("expected the record once flushed, got %q", output.String())
+	}
+}
+
+// Tests that the payload digest of response records
+// only covers the entity body, without its chunking
+func TestWriteRecordPayloadDigest(t *testing.T) {
+	writer, err := NewWriter(new(bytes.Buffer), "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	for _, block := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nHello, World!",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n7\r\nHello, \r\n6\r\nWorld!\r\n0\r\n\r\n",
+	} {
+		record := NewRecord()
+		record.Header.Set("WARC-Type", "response")
+		record.Header.Set("WARC-Target-URI", "http://example.com/")
+		record.Content = strings.NewReader(block)
+		if _, err := writer.WriteRecord(record); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+
+		if expected := "sha1:" + GetSHA1([]byte(block)); record.Header.Get("WARC-Block-Digest") != expected {
+			t.Errorf("expected block digest %s, got %s", expected, record.Header.Get("WARC-Block-Digest"))
+		}
+		if expected := "sha1:" + GetSHA1([]byte("Hello, World!")); record.Header.Get("WARC-Payload-Digest") != expected {
+			t.Errorf("expected payload digest %s, got %s", expected, record.Header.Get("WARC-Payload-Digest"))
+		}
+	}
+
+	// Records without a payload get no payload digest
+	metadata := NewRecord()
+	metadata.Header.Set("WARC-Type", "metadata")
+	metadata.Content = strings.NewReader("via: http://example.com/")
+	if _, err := writer.WriteRecord(metadata); err != nil {
+		t.Fatalf("failed to write record: %v", err)
+	}
+	if metadata.Header.Get("WARC-Payload-Digest") != "" {
+		t.Errorf("expected no payload digest for a metadata record, got %s", metadata.Header.Get("WARC-Payload-Digest"))
+	}
+}
+
+// Tests that nothing is written when the
+// payload of a record can't be read
+func TestWriteRecordMissingPayloadPath(t *testing.T) {
+	output := new(bytes.Buffer)
+	writer, err := NewWriter(output, "test.warc", "")
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	record := NewRecord()
+	record.Header.Set("WARC-Target-URI", "http://example.com/")
+	record.PayloadPath = filepath.Join(os.TempDir(), "warc-missing-payload")
+	if _, err := writer.WriteRecord(record); err == nil {
+		t.Fatal("expected an error for a missing payload")
+	}
+
+	writer.FileWriter.Flush()
+	if output.Len() != 0 {
+		t.Errorf("expected nothing written, got %q", output.String())
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !nozstd
+// +build !nozstd
+
+package warc
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdEncoder is the type of Writer.ZSTDWriter
+type zstdEncoder = zstd.Encoder
+
+// The zstd compression and content encoding are built in unless the
+// nozstd build tag is set, to leave out github.com/klauspost/compress
+func init() {
+	registerCompression(CompressionZSTD, ".zst",
+		func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		newZSTDReader)
+
+	contentDecoders["zstd"] = NewContentDecoderFunc(newZSTDReader)
+}
+
+// newZSTDWriter returns a writer compressing the data written to it into w
+func newZSTDWriter(w io.Writer) (*zstdEncoder, error) {
+	return zstd.NewWriter(w)
+}
+
+// newZSTDReader returns a reader decompressing the data read from r
+func newZSTDReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
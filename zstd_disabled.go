@@ -0,0 +1,29 @@
+//go:build nozstd
+// +build nozstd
+
+package warc
+
+import "io"
+
+// zstdEncoder is the type of Writer.ZSTDWriter, wrapping the zstd
+// compression registered with RegisterCompression, if any, as the
+// built-in one is left out by the nozstd build tag
+type zstdEncoder struct {
+	io.WriteCloser
+}
+
+// newZSTDWriter returns a writer compressing the data written
+// to it into w with the registered zstd compression
+func newZSTDWriter(w io.Writer) (*zstdEncoder, error) {
+	codec, err := lookupCompression(CompressionZSTD)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := codec.newWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zstdEncoder{writer}, nil
+}
@@ -0,0 +1,38 @@
+//go:build !nozstd
+// +build !nozstd
+
+package warc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Tests the decoding of zstd content encoded payloads
+func TestRecordPayloadDigestsZSTD(t *testing.T) {
+	body := "Hello, World!"
+	expected := "sha1:" + GetSHA1([]byte(body))
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("failed to create zstd encoder: %v", err)
+	}
+	encoded := string(encoder.EncodeAll([]byte(body), nil))
+
+	record := NewRecord()
+	record.Header.Set("WARC-Type", "response")
+	record.Content = strings.NewReader("HTTP/1.1 200 OK\r\nContent-Encoding: zstd\r\n" +
+		"Content-Length: " + strconv.Itoa(len(encoded)) + "\r\n\r\n" + encoded)
+
+	digests, err := record.PayloadDigests()
+	if err != nil {
+		t.Fatalf("failed to compute payload digests: %v", err)
+	}
+
+	if digests.Decoded != expected {
+		t.Errorf("expected decoded digest %s, got %s", expected, digests.Decoded)
+	}
+}